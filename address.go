@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// ValidateAddress checks that addr is a 0x-prefixed, 40 hex digit (160-bit) address. Upper,
+// lower and mixed case digits are all accepted; an EIP-55 checksum is not verified.
+func ValidateAddress(addr string) error {
+	if len(addr) < 2 || addr[:2] != "0x" {
+		return fmt.Errorf("%w: %q has no 0x prefix", ErrInvalidAddress, addr)
+	}
+	digits := addr[2:]
+	if len(digits) != 40 {
+		return fmt.Errorf("%w: %q has %d hex digits, want 40", ErrInvalidAddress, addr, len(digits))
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return fmt.Errorf("%w: %q is not hex", ErrInvalidAddress, addr)
+	}
+	return nil
+}
+
+// MustValidateAddress is like ValidateAddress but panics if addr is invalid
+func MustValidateAddress(addr string) {
+	if err := ValidateAddress(addr); err != nil {
+		panic(err)
+	}
+}
+
+// checkAddresses validates every address with ValidateAddress, or only rejects empty ones
+// when LaxAddressValidation is set. The caller must hold t.mu.
+func (t *StockToken) checkAddresses(addresses ...string) error {
+	for _, address := range addresses {
+		if t.LaxAddressValidation {
+			if address == "" {
+				return fmt.Errorf("%w: address is empty", ErrInvalidAddress)
+			}
+			continue
+		}
+		if err := ValidateAddress(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
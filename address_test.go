@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	hexAlice = "0x52908400098527886E0F7030069857D2E4169EE7"
+	hexBob   = "0x8617e340b3d01fa5f11f306f4090fd50e238070d"
+)
+
+func TestValidateAddress(t *testing.T) {
+	for _, test := range []struct {
+		addr  string
+		valid bool
+	}{
+		{hexAlice, true},
+		{hexBob, true},
+		{"0x" + strings.Repeat("0", 40), true},
+		{"", false},
+		{"0x", false},
+		{"52908400098527886E0F7030069857D2E4169EE7", false},
+		{"0X52908400098527886E0F7030069857D2E4169EE7", false},
+		{"0x52908400098527886E0F7030069857D2E4169EE", false},
+		{"0x52908400098527886E0F7030069857D2E4169EE77", false},
+		{"0x52908400098527886E0F7030069857D2E4169EEG", false},
+		{"0xALICE", false},
+	} {
+		err := ValidateAddress(test.addr)
+		if test.valid && err != nil {
+			t.Errorf("ValidateAddress(%q) = %v, want nil", test.addr, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("ValidateAddress(%q) = %v, want %v", test.addr, err, ErrInvalidAddress)
+		}
+	}
+}
+
+func TestMustValidateAddress(t *testing.T) {
+	MustValidateAddress(hexAlice)
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("MustValidateAddress panicked with %v, want %v", err, ErrInvalidAddress)
+		}
+	}()
+	MustValidateAddress("0xALICE")
+	t.Error("MustValidateAddress accepted a shorthand address")
+}
+
+func TestStrictAddressValidation(t *testing.T) {
+	st, err := NewStockToken("TSLA", "Tesla, Inc.", defaultDecimals, "$100.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, hexAlice, 10)
+	if err := ow.Wrap(st, hexAlice, tokens(2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer(hexAlice, "0xCONTRACT", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, run := range map[string]func() error{
+		"Mint":     func() error { return st.Mint("0xBOB", 1) },
+		"Interact": func() error { return st.Interact(hexAlice, "0xBOB", tokens(1), nil) },
+		"Approve":  func() error { return st.Approve(hexAlice, "0xBOB", tokens(1)) },
+		"Wrap":     func() error { return ow.Wrap(st, "0xBOB", tokens(1), nil) },
+		"Unwrap":   func() error { return ow.Unwrap(st, "0xBOB", tokens(1), nil) },
+		"Claim":    func() error { return ow.Claim(st, "0xCONTRACT", "0xBOB", tokens(1)) },
+		"AddSubscription": func() error {
+			_, err := st.AddSubscription("0xBOB", 1, time.Hour, time.Now())
+			return err
+		},
+		"IssueWarrant": func() error {
+			_, err := st.IssueWarrant("0xBOB", big.NewInt(100), tokens(1), time.Now().Add(time.Hour))
+			return err
+		},
+		"IssueConvertibleNote": func() error {
+			_, err := st.IssueConvertibleNote("0xBOB", big.NewInt(100), 0, time.Now().Add(time.Hour), big.NewInt(100))
+			return err
+		},
+		"ProportionalTransfer": func() error { return st.ProportionalTransfer(100, "0xBOB") },
+		"SetWithholdingTaxBps": func() error { return st.SetWithholdingTaxBps("0xBOB", 100) },
+	} {
+		if err := run(); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%s with a shorthand address: err = %v, want %v", name, err, ErrInvalidAddress)
+		}
+	}
+	checkBalance(t, st, hexAlice, tokens(8))
+
+	if err := st.Interact(hexAlice, hexBob, tokens(1), nil); err != nil {
+		t.Errorf("Interact between valid addresses: %v", err)
+	}
+	if err := ow.Unwrap(st, hexBob, tokens(1), nil); err != nil {
+		t.Errorf("Unwrap to a valid address: %v", err)
+	}
+	checkBalance(t, st, hexBob, tokens(2))
+
+	// Lax validation accepts shorthand addresses, but still not empty ones
+	st.LaxAddressValidation = true
+	if err := st.Mint("0xBOB", 1); err != nil {
+		t.Errorf("lax Mint to a shorthand address: %v", err)
+	}
+	if err := st.Mint("", 1); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("lax Mint to an empty address: err = %v, want %v", err, ErrInvalidAddress)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Approve lets spender transfer up to amount of owner's tokens. It replaces any previous allowance.
+func (t *StockToken) Approve(owner, spender string, amount *big.Int) error {
+	if owner == "" || spender == "" {
+		return errors.New("owner and spender must be set")
+	}
+	if amount == nil || amount.Sign() < 0 {
+		return fmt.Errorf("%w: allowance must be non-negative", ErrInvalidAmount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(owner, spender); err != nil {
+		return err
+	}
+	t.allowances = setAllowance(t.allowances, owner, spender, amount)
+	return nil
+}
+
+// Allowance returns how much of owner's tokens spender may still transfer
+func (t *StockToken) Allowance(owner, spender string) *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.allowance(owner, spender)
+}
+
+// allowance is Allowance for callers that already hold t.mu
+func (t *StockToken) allowance(owner, spender string) *big.Int {
+	return allowanceOf(t.allowances, owner, spender)
+}
+
+// TransferFrom moves amount from from to to on behalf of spender, using up spender's allowance
+func (t *StockToken) TransferFrom(spender, from, to string, amount *big.Int) error {
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(from, to); err != nil {
+		return err
+	}
+	if err := t.checkTransfer(from, amount); err != nil {
+		return err
+	}
+
+	allowance := t.allowances[from][spender]
+	if allowance == nil || allowance.Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s may spend %s of %s's tokens", ErrAllowanceExceeded, spender, formatTokens(t.allowance(from, spender), t.Precision), from)
+	}
+
+	if err := t.transfer(from, to, amount); err != nil {
+		return err
+	}
+	allowance.Sub(allowance, amount)
+	return nil
+}
+
+// Approve lets spender transfer up to amount of owner's wrapped tokens. It replaces any
+// previous allowance. Allowances are in wrapped units, which a rebase of the underlying does
+// not change, so UpdateExchangeRate leaves them as they are.
+func (ow *OndoWrappedStock) Approve(owner, spender string, amount *big.Int) error {
+	if owner == "" || spender == "" {
+		return errors.New("owner and spender must be set")
+	}
+	if amount == nil || amount.Sign() < 0 {
+		return fmt.Errorf("%w: allowance must be non-negative", ErrInvalidAmount)
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.allowances = setAllowance(ow.allowances, owner, spender, amount)
+	return nil
+}
+
+// Allowance returns how much of owner's wrapped tokens spender may still transfer
+func (ow *OndoWrappedStock) Allowance(owner, spender string) *big.Int {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return allowanceOf(ow.allowances, owner, spender)
+}
+
+// TransferFrom moves amount of wrapped tokens from from to to on behalf of spender, using up
+// spender's allowance
+func (ow *OndoWrappedStock) TransferFrom(spender, from, to string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+	if to == "" {
+		return errors.New("recipient address is empty")
+	}
+
+	defer ow.emitEvents()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	allowance := ow.allowances[from][spender]
+	if allowance == nil || allowance.Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s may spend %s of %s's wrapped tokens", ErrAllowanceExceeded, spender, formatTokens(allowanceOf(ow.allowances, from, spender), ow.Precision), from)
+	}
+
+	if err := ow.transfer(from, to, amount); err != nil {
+		return err
+	}
+	allowance.Sub(allowance, amount)
+	return nil
+}
+
+// allowanceOf returns a copy of spender's allowance from owner, zero if there is none
+func allowanceOf(allowances map[string]map[string]*big.Int, owner, spender string) *big.Int {
+	if allowance := allowances[owner][spender]; allowance != nil {
+		return new(big.Int).Set(allowance)
+	}
+	return big.NewInt(0)
+}
+
+// setAllowance stores a copy of amount as spender's allowance from owner, creating the maps
+// as needed, and returns allowances
+func setAllowance(allowances map[string]map[string]*big.Int, owner, spender string, amount *big.Int) map[string]map[string]*big.Int {
+	if allowances == nil {
+		allowances = make(map[string]map[string]*big.Int)
+	}
+	if allowances[owner] == nil {
+		allowances[owner] = make(map[string]*big.Int)
+	}
+	allowances[owner][spender] = new(big.Int).Set(amount)
+	return allowances
+}
+
+// scaleAllowances multiplies every allowance by multiplierNum/multiplierDen, rounding down, so
+// allowances keep pace with balances when a rebase changes nominal amounts
+func scaleAllowances(allowances map[string]map[string]*big.Int, multiplierNum, multiplierDen *big.Int) {
+	for _, spenders := range allowances {
+		for _, allowance := range spenders {
+			allowance.Mul(allowance, multiplierNum)
+			allowance.Div(allowance, multiplierDen)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestTransferFrom(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		approve       *big.Int
+		spend         []*big.Int
+		wantErr       error
+		wantAllowance *big.Int
+		wantAlice     *big.Int
+	}{
+		{"full spend", tokens(5), []*big.Int{tokens(5)}, nil, big.NewInt(0), tokens(5)},
+		{"partial spend", tokens(5), []*big.Int{tokens(2)}, nil, tokens(3), tokens(8)},
+		{"two partial spends", tokens(5), []*big.Int{tokens(2), tokens(3)}, nil, big.NewInt(0), tokens(5)},
+		{"over-spend", tokens(5), []*big.Int{tokens(6)}, ErrAllowanceExceeded, tokens(5), tokens(10)},
+		{"over-spend after partial spend", tokens(5), []*big.Int{tokens(4), tokens(2)}, ErrAllowanceExceeded, tokens(1), tokens(6)},
+		{"no approval", nil, []*big.Int{tokens(1)}, ErrAllowanceExceeded, big.NewInt(0), tokens(10)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			st := newTestToken(t)
+			mustMint(t, st, "0xALICE", 10)
+			if test.approve != nil {
+				if err := st.Approve("0xALICE", "0xSPENDER", test.approve); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var err error
+			for _, amount := range test.spend {
+				if err = st.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", amount); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("TransferFrom error = %v, want %v", err, test.wantErr)
+			}
+			if got := st.Allowance("0xALICE", "0xSPENDER"); got.Cmp(test.wantAllowance) != 0 {
+				t.Errorf("allowance = %s, want %s", got, test.wantAllowance)
+			}
+			checkBalance(t, st, "0xALICE", test.wantAlice)
+			checkSane(t, st)
+		})
+	}
+}
+
+func TestAllowanceScalesWithRebase(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		action RebaseAction
+		want   *big.Int
+	}{
+		{"2-for-1 split", StockSplit{Numerator: big.NewInt(2), Denominator: big.NewInt(1)}, tokens(6)},
+		{"1-for-3 reverse split", StockSplit{Numerator: big.NewInt(1), Denominator: big.NewInt(3)}, big.NewInt(1_000_000)},
+		// $5 a share on $100 pays out 5% more shares
+		{"dividend", Dividend{cashAmount: big.NewInt(500), sharePrice: big.NewInt(10000)}, big.NewInt(3_150_000)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			st := newTestToken(t)
+			mustMint(t, st, "0xALICE", 10)
+			if err := st.Approve("0xALICE", "0xSPENDER", tokens(3)); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Rebase(test.action); err != nil {
+				t.Fatal(err)
+			}
+			if got := st.Allowance("0xALICE", "0xSPENDER"); got.Cmp(test.want) != 0 {
+				t.Errorf("allowance = %s, want %s", got, test.want)
+			}
+			// The scaled allowance can be spent in full, and no more
+			if err := st.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", new(big.Int).Add(test.want, big.NewInt(1))); !errors.Is(err, ErrAllowanceExceeded) {
+				t.Errorf("over-spend error = %v, want %v", err, ErrAllowanceExceeded)
+			}
+			if err := st.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", test.want); err != nil {
+				t.Fatal(err)
+			}
+			checkBalance(t, st, "0xBOB", test.want)
+		})
+	}
+}
+
+func TestWrappedAllowanceUnchangedByRateUpdate(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Approve("0xALICE", "0xSPENDER", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The split doubles the exchange rate, but wrapped balances and allowances stay put
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if ow.exchangeRate.Cmp(tokens(2)) != 0 {
+		t.Fatalf("exchange rate = %s, want %s", ow.exchangeRate, tokens(2))
+	}
+	if got := ow.Allowance("0xALICE", "0xSPENDER"); got.Cmp(tokens(3)) != 0 {
+		t.Errorf("allowance after the rate update = %s, want %s", got, tokens(3))
+	}
+	// Meanwhile an underlying allowance doubles with the split
+	if err := st.Approve("0xBOB", "0xSPENDER", tokens(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.Allowance("0xBOB", "0xSPENDER"); got.Cmp(tokens(6)) != 0 {
+		t.Errorf("underlying allowance after the split = %s, want %s", got, tokens(6))
+	}
+	if got := ow.Allowance("0xALICE", "0xSPENDER"); got.Cmp(tokens(3)) != 0 {
+		t.Errorf("wrapped allowance after a second update = %s, want %s", got, tokens(3))
+	}
+
+	if err := ow.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", tokens(4)); !errors.Is(err, ErrAllowanceExceeded) {
+		t.Errorf("wrapped over-spend: err = %v, want %v", err, ErrAllowanceExceeded)
+	}
+	if err := ow.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", tokens(3)); err != nil {
+		t.Fatal(err)
+	}
+	if ow.balances["0xBOB"].Cmp(tokens(4)) != 0 || ow.Allowance("0xALICE", "0xSPENDER").Sign() != 0 {
+		t.Errorf("0xBOB holds %s wrapped with %s allowance left, want %s and none", ow.balances["0xBOB"], ow.Allowance("0xALICE", "0xSPENDER"), tokens(4))
+	}
+}
+
+func TestScaleAllowances(t *testing.T) {
+	allowances := setAllowance(nil, "0xALICE", "0xBOB", big.NewInt(10))
+	allowances = setAllowance(allowances, "0xALICE", "0xCAROL", big.NewInt(7))
+	allowances = setAllowance(allowances, "0xDAVE", "0xBOB", big.NewInt(1))
+	scaleAllowances(allowances, big.NewInt(3), big.NewInt(2))
+	for _, want := range []struct {
+		owner, spender string
+		amount         int64
+	}{
+		{"0xALICE", "0xBOB", 15},
+		{"0xALICE", "0xCAROL", 10},
+		{"0xDAVE", "0xBOB", 1},
+	} {
+		if got := allowanceOf(allowances, want.owner, want.spender); got.Cmp(big.NewInt(want.amount)) != 0 {
+			t.Errorf("%s -> %s allowance = %s, want %d", want.owner, want.spender, got, want.amount)
+		}
+	}
+}
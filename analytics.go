@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+)
+
+// DilutionProtection returns how many additional shares protectedAddress must receive to keep
+// its ownership percentage unchanged after newSharesMinted are issued. Nothing is minted.
+func (t *StockToken) DilutionProtection(protectedAddress string, newSharesMinted *big.Int) (*big.Int, error) {
+	if newSharesMinted == nil || newSharesMinted.Sign() < 0 {
+		return nil, fmt.Errorf("%w: new shares minted must be non-negative", ErrInvalidAmount)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	protected := t.balances[protectedAddress]
+	if protected == nil || protected.Sign() == 0 {
+		return big.NewInt(0), nil
+	}
+
+	// adjustment = protectedBalance * newSharesMinted / (totalSupply - protectedBalance)
+	others := new(big.Int).Sub(t.totalSupply, protected)
+	if others.Sign() <= 0 {
+		return nil, errors.New("protected address holds the entire supply")
+	}
+
+	adjustment := new(big.Int).Mul(protected, newSharesMinted)
+	adjustment.Div(adjustment, others)
+	return adjustment, nil
+}
+
+// HoldersByTier groups holders by minimum-balance thresholds. Key i holds addresses with
+// tiers[i] <= balance < tiers[i+1]; the last tier is unbounded. It fails if a threshold is
+// nil or the thresholds are not sorted ascending.
+func (t *StockToken) HoldersByTier(tiers []*big.Int) (map[int][]string, error) {
+	for i, tier := range tiers {
+		if tier == nil {
+			return nil, fmt.Errorf("tier %d threshold is nil", i)
+		}
+		if i > 0 && tier.Cmp(tiers[i-1]) < 0 {
+			return nil, fmt.Errorf("tiers must be sorted ascending, but tier %d is below tier %d", i, i-1)
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := make(map[int][]string)
+	for _, address := range t.holders {
+		balance := t.balances[address]
+		if balance.Sign() <= 0 {
+			continue
+		}
+
+		// First tier whose threshold is above the balance, minus one
+		tier := sort.Search(len(tiers), func(i int) bool { return tiers[i].Cmp(balance) > 0 }) - 1
+		if tier < 0 {
+			continue
+		}
+		result[tier] = append(result[tier], address)
+	}
+	return result, nil
+}
+
+// TotalHolders returns the number of addresses with a positive balance, removing any zero
+// balances it finds along the way. It walks the whole balance map, so it is O(n) in the
+// number of addresses.
+func (t *StockToken) TotalHolders() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return pruneZeroBalances(t.balances, &t.holders)
+}
+
+// Holders returns every address with a positive balance, sorted
+func (t *StockToken) Holders() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return positiveHolders(t.balances, t.holders)
+}
+
+// TotalHolders returns the number of addresses with a positive wrapped balance, removing any
+// zero balances it finds along the way. It is O(n) in the number of addresses.
+func (ow *OndoWrappedStock) TotalHolders() int {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return pruneZeroBalances(ow.balances, &ow.holders)
+}
+
+// Holders returns every address with a positive wrapped balance, sorted
+func (ow *OndoWrappedStock) Holders() []string {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return positiveHolders(ow.balances, ow.holders)
+}
+
+// pruneZeroBalances deletes zero balances, and their addresses from holders, and returns how
+// many positive balances remain
+func pruneZeroBalances(balances map[string]*big.Int, holders *holderIndex) int {
+	for address, balance := range balances {
+		if balance.Sign() == 0 {
+			delete(balances, address)
+			holders.remove(address)
+		}
+	}
+	return len(balances)
+}
+
+// positiveHolders returns the addresses in index with a positive balance, in index order
+func positiveHolders(balances map[string]*big.Int, index holderIndex) []string {
+	holders := make([]string, 0, len(index))
+	for _, address := range index {
+		if balances[address].Sign() > 0 {
+			holders = append(holders, address)
+		}
+	}
+	return holders
+}
+
+// dividendActionTypes are the RebaseEvent action types that pay a dividend
+var dividendActionTypes = map[string]bool{
+	"dividend":             true,
+	"capped_dividend":      true,
+	"dividend_with_record": true,
+	"compound_dividend":    true,
+}
+
+// CumulativeDividendYield returns the total yield of every dividend in RebaseHistory for a
+// holder since inception, with each dividend paid in shares compounding on the last:
+// prod(1 + yield_i) - 1. It fails if a dividend was recorded without its yield, as in a
+// history encoded before yields were kept.
+func (t *StockToken) CumulativeDividendYield() (*big.Rat, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return cumulativeDividendYield(t.RebaseHistory)
+}
+
+// cumulativeDividendYield compounds the dividend yields recorded in history
+func cumulativeDividendYield(history []RebaseEvent) (*big.Rat, error) {
+	growth := big.NewRat(1, 1)
+	for i, event := range history {
+		if event.DividendYield == nil {
+			if dividendActionTypes[event.ActionType] || slices.ContainsFunc(event.Actions, func(action string) bool { return dividendActionTypes[action] }) {
+				return nil, fmt.Errorf("rebase %d: %s has no recorded dividend yield", i, event.ActionType)
+			}
+			continue
+		}
+		growth.Mul(growth, new(big.Rat).Add(event.DividendYield, big.NewRat(1, 1)))
+	}
+	return growth.Sub(growth, big.NewRat(1, 1)), nil
+}
+
+// PeerComparisonReport compares a token with a peer. Each field is the token's metric over
+// the peer's minus one, so 0 means level and 1/4 means a quarter higher.
+type PeerComparisonReport struct {
+	RelativePriceChange        *big.Rat // share price
+	RelativeHolderCount        float64  // addresses with a positive balance
+	RelativeMarketCap          *big.Rat // total supply valued at the share price
+	RelativeTotalDividendYield *big.Rat // CumulativeDividendYield
+}
+
+// PeerComparison compares t's share price, holder count, market cap and cumulative dividend
+// yield with other's. It fails if other has no holders, no supply or no dividend yield to
+// compare against, or if either token's dividend yield cannot be worked out.
+func (t *StockToken) PeerComparison(other *StockToken) (*PeerComparisonReport, error) {
+	if other == nil {
+		return nil, fmt.Errorf("%w: no peer to compare with", ErrTokenMismatch)
+	}
+	yield, err := t.CumulativeDividendYield()
+	if err != nil {
+		return nil, err
+	}
+	otherYield, err := other.CumulativeDividendYield()
+	if err != nil {
+		return nil, fmt.Errorf("peer %s: %w", other.Symbol, err)
+	}
+	holders, otherHolders := t.TotalHolders(), other.TotalHolders()
+	if otherHolders == 0 {
+		return nil, fmt.Errorf("%w: peer %s has no holders", ErrInvalidAmount, other.Symbol)
+	}
+	marketCap, otherMarketCap := t.marketCap(), other.marketCap()
+	if otherMarketCap.Sign() == 0 {
+		return nil, fmt.Errorf("%w: peer %s has no supply", ErrInvalidAmount, other.Symbol)
+	}
+	if otherYield.Sign() == 0 {
+		return nil, fmt.Errorf("%w: peer %s has paid no dividends", ErrInvalidAmount, other.Symbol)
+	}
+
+	return &PeerComparisonReport{
+		RelativePriceChange:        relativeTo(new(big.Rat).SetInt(t.SharePrice()), new(big.Rat).SetInt(other.SharePrice())),
+		RelativeHolderCount:        float64(holders)/float64(otherHolders) - 1,
+		RelativeMarketCap:          relativeTo(marketCap, otherMarketCap),
+		RelativeTotalDividendYield: relativeTo(yield, otherYield),
+	}, nil
+}
+
+// marketCap returns the total supply valued at the share price, in cents
+func (t *StockToken) marketCap() *big.Rat {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	value := new(big.Rat).SetInt(new(big.Int).Mul(t.totalSupply, t.sharePrice))
+	return value.Quo(value, new(big.Rat).SetInt(t.Precision))
+}
+
+// relativeTo returns x/y - 1. y must not be zero.
+func relativeTo(x, y *big.Rat) *big.Rat {
+	r := new(big.Rat).Quo(x, y)
+	return r.Sub(r, big.NewRat(1, 1))
+}
+
+// NominalRealReturn splits the return on a holding into price appreciation and dividends, so
+// that TotalReturn = (1 + CapitalGain) * (1 + DividendReturn) - 1
+type NominalRealReturn struct {
+	CapitalGain    *big.Rat
+	DividendReturn *big.Rat
+	TotalReturn    *big.Rat
+}
+
+// NominalVsRealReturn returns the return since snapshot inceptionSnapshotID on a holding of
+// address's at the time, kept through every later rebase. DividendReturn is the cumulative
+// dividend yield of the rebases since the snapshot. TotalReturn is the change in value of the
+// holding, from the share price and the balance scaling recorded by CumulativeMultiplier, and
+// CapitalGain the rest: the change in share price, adjusted for splits and returns of capital.
+// It fails if address held nothing when the snapshot was taken.
+func (t *StockToken) NominalVsRealReturn(address string, inceptionSnapshotID SnapshotID) (*NominalRealReturn, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if err := t.checkSnapshot(inceptionSnapshotID); err != nil {
+		return nil, err
+	}
+	held := valueAt(t.balanceCheckpoints[address], t.balances[address], inceptionSnapshotID)
+	held.Add(held, valueAt(t.stakedCheckpoints[address], t.stakedBalances[address], inceptionSnapshotID))
+	if held.Sign() == 0 {
+		return nil, fmt.Errorf("%w: %s held no %s at snapshot %d", ErrInsufficientBalance, address, t.Symbol, inceptionSnapshotID)
+	}
+	mark := t.snapshotMarks[inceptionSnapshotID-1]
+
+	dividendReturn, err := cumulativeDividendYield(t.RebaseHistory[mark.historyLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	// One share at the snapshot has grown to rebaseMultiplier/mark.rebaseMultiplier shares
+	growth := new(big.Rat).Quo(t.rebaseMultiplier, mark.rebaseMultiplier)
+	growth.Mul(growth, new(big.Rat).SetFrac(t.sharePrice, mark.sharePrice))
+	capitalGain := new(big.Rat).Quo(growth, new(big.Rat).Add(dividendReturn, big.NewRat(1, 1)))
+	return &NominalRealReturn{
+		CapitalGain:    capitalGain.Sub(capitalGain, big.NewRat(1, 1)),
+		DividendReturn: dividendReturn,
+		TotalReturn:    growth.Sub(growth, big.NewRat(1, 1)),
+	}, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestHoldersByTier(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xSMALL", 1)
+	mustMint(t, st, "0xMID", 50)
+	mustMint(t, st, "0xLARGE", 500)
+
+	tiers, err := st.HoldersByTier([]*big.Int{tokens(10), tokens(100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tiers); got != "map[0:[0xMID] 1:[0xLARGE]]" {
+		t.Errorf("tiers = %s, want map[0:[0xMID] 1:[0xLARGE]]", got)
+	}
+}
+
+func TestHoldersByTierRejectsBadTiers(t *testing.T) {
+	st := newTestToken(t)
+	if _, err := st.HoldersByTier([]*big.Int{tokens(100), tokens(10)}); err == nil {
+		t.Error("unsorted tiers accepted")
+	}
+	if _, err := st.HoldersByTier([]*big.Int{tokens(10), nil}); err == nil {
+		t.Error("nil tier accepted")
+	}
+}
+
+func TestDilutionProtection(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 90)
+
+	// 20 new shares raise the supply by 20%
+	adjustment, err := st.DilutionProtection("0xALICE", tokens(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Div(new(big.Int).Mul(tokens(10), tokens(20)), tokens(90))
+	if adjustment.Cmp(want) != 0 {
+		t.Errorf("adjustment = %s, want %s", adjustment, want)
+	}
+
+	// Issuing the adjustment on top keeps 0xALICE at 10%, to within rounding
+	held := new(big.Int).Add(tokens(10), adjustment)
+	supply := new(big.Int).Add(tokens(120), adjustment)
+	share, _ := new(big.Rat).SetFrac(held, supply).Float64()
+	if share < 0.0999999 || share > 0.1000001 {
+		t.Errorf("protected share = %f, want 0.1", share)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+
+	if adjustment, err := st.DilutionProtection("0xNOBODY", tokens(20)); err != nil || adjustment.Sign() != 0 {
+		t.Errorf("adjustment for a non-holder = %v, %v, want 0", adjustment, err)
+	}
+	if _, err := st.DilutionProtection("0xALICE", big.NewInt(-1)); err == nil {
+		t.Error("DilutionProtection accepted negative new shares")
+	}
+}
+
+func TestTotalHolders(t *testing.T) {
+	st := newTestToken(t)
+	count := func(want int) {
+		t.Helper()
+		if got := st.TotalHolders(); got != want {
+			t.Errorf("TotalHolders = %d, want %d", got, want)
+		}
+	}
+	count(0)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 10)
+	count(2)
+
+	// A transfer to an existing holder does not add one
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); err != nil {
+		t.Fatal(err)
+	}
+	count(2)
+	if err := st.Burn("0xALICE", tokens(9)); err != nil {
+		t.Fatal(err)
+	}
+	count(1)
+
+	// A stray zero balance is not counted, and is cleaned up
+	st.balances["0xZERO"] = big.NewInt(0)
+	st.holders.insert("0xZERO")
+	if got := st.Holders(); len(got) != 1 || got[0] != "0xBOB" {
+		t.Errorf("Holders = %v, want [0xBOB]", got)
+	}
+	count(1)
+	checkHolders(t, st.SortedHolders(), st.balances, "0xBOB")
+}
+
+func TestWrappedTotalHolders(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xBOB", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if got := ow.TotalHolders(); got != 2 {
+		t.Errorf("TotalHolders = %d, want 2", got)
+	}
+	if err := ow.Transfer("0xBOB", "0xALICE", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if got, holders := ow.TotalHolders(), ow.Holders(); got != 1 || len(holders) != 1 || holders[0] != "0xALICE" {
+		t.Errorf("TotalHolders = %d and Holders = %v, want only 0xALICE", got, holders)
+	}
+}
+
+// BenchmarkTotalHolders counts 100k holders. TotalHolders walks every balance looking for
+// zeros, so its cost grows linearly with the number of addresses.
+func BenchmarkTotalHolders(b *testing.B) {
+	st := newTestToken(b)
+	for i := 0; i < 100_000; i++ {
+		address := fmt.Sprintf("0xHOLDER%06d", i)
+		st.balances[address] = big.NewInt(1)
+		st.holders.insert(address)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if st.TotalHolders() != 100_000 {
+			b.Fatal("wrong holder count")
+		}
+	}
+}
+
+func TestCumulativeDividendYield(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	quarterly := Dividend{cashAmount: big.NewInt(150), sharePrice: big.NewInt(10000)}
+	for i := 0; i < 4; i++ {
+		if err := st.Rebase(quarterly); err != nil {
+			t.Fatal(err)
+		}
+		// A split pays no dividend and leaves the yield alone
+		if i == 1 {
+			if err := st.Rebase(StockSplit{big.NewInt(2), big.NewInt(1)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	yield, err := st.CumulativeDividendYield()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (1.015)^4 - 1, exactly
+	want := new(big.Rat).SetFrac(big.NewInt(1015*1015*1015*1015-1000*1000*1000*1000), big.NewInt(1000*1000*1000*1000))
+	if yield.Cmp(want) != 0 {
+		t.Errorf("CumulativeDividendYield = %s, want %s", yield.FloatString(6), want.FloatString(6))
+	}
+	if got := yield.FloatString(4); got != "0.0614" {
+		t.Errorf("CumulativeDividendYield = %s, want 0.0614", got)
+	}
+
+	// A dividend recorded without its yield, as in an older encoding, cannot be counted
+	st.RebaseHistory[0].DividendYield = nil
+	if _, err := st.CumulativeDividendYield(); err == nil {
+		t.Error("CumulativeDividendYield succeeded with a dividend missing its yield")
+	}
+}
+
+func TestCumulativeDividendYieldCompoundsBatches(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	if yield, err := st.CumulativeDividendYield(); err != nil || yield.Sign() != 0 {
+		t.Fatalf("CumulativeDividendYield with no dividends = %v, %v; want 0", yield, err)
+	}
+	err := st.BatchRebase([]RebaseAction{
+		Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)},
+		StockSplit{big.NewInt(2), big.NewInt(1)},
+		CompoundDividend{[]Dividend{{cashAmount: big.NewInt(200), sharePrice: big.NewInt(10000)}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	yield, err := st.CumulativeDividendYield()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1.01 * 1.02 - 1
+	if want := big.NewRat(302, 10000); yield.Cmp(want) != 0 {
+		t.Errorf("CumulativeDividendYield = %s, want %s", yield.RatString(), want.RatString())
+	}
+}
+
+func TestPeerComparison(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	mustMint(t, st, "0xBOB", 50)
+	mustMint(t, st, "0xCAROL", 50)
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(200), sharePrice: big.NewInt(10000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$80.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.LaxAddressValidation = true
+	if _, err := st.PeerComparison(peer); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("comparison with an empty peer: err = %v, want ErrInvalidAmount", err)
+	}
+	mustMint(t, peer, "0xALICE", 100)
+	mustMint(t, peer, "0xBOB", 60)
+	if _, err := st.PeerComparison(peer); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("comparison with a peer paying no dividends: err = %v, want ErrInvalidAmount", err)
+	}
+	if err := peer.Rebase(Dividend{cashAmount: big.NewInt(80), sharePrice: big.NewInt(8000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := st.PeerComparison(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// $100 against $80
+	if want := big.NewRat(1, 4); report.RelativePriceChange.Cmp(want) != 0 {
+		t.Errorf("RelativePriceChange = %s, want %s", report.RelativePriceChange.RatString(), want.RatString())
+	}
+	// Three holders against two
+	if report.RelativeHolderCount != 0.5 {
+		t.Errorf("RelativeHolderCount = %v, want 0.5", report.RelativeHolderCount)
+	}
+	// 204 tokens at $100 against 161.6 at $80
+	marketCap := new(big.Rat).SetFrac(new(big.Int).Mul(st.TotalSupply(), big.NewInt(100)), new(big.Int).Mul(peer.TotalSupply(), big.NewInt(80)))
+	if want := marketCap.Sub(marketCap, big.NewRat(1, 1)); report.RelativeMarketCap.Cmp(want) != 0 {
+		t.Errorf("RelativeMarketCap = %s, want %s", report.RelativeMarketCap.FloatString(6), want.FloatString(6))
+	}
+	if got := report.RelativeMarketCap.FloatString(4); got != "0.5780" {
+		t.Errorf("RelativeMarketCap = %s, want 0.5780", got)
+	}
+	// A 2% yield against 1%
+	if want := big.NewRat(1, 1); report.RelativeTotalDividendYield.Cmp(want) != 0 {
+		t.Errorf("RelativeTotalDividendYield = %s, want %s", report.RelativeTotalDividendYield.RatString(), want.RatString())
+	}
+}
+
+func TestNominalVsRealReturn(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	inception := st.Snapshot()
+	mustMint(t, st, "0xBOB", 100)
+
+	// $100 rises to $110, pays 2%, splits 2-for-1 to $55, rises to $60 and pays 1%
+	if err := st.SetSharePrice("$110.00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(220), sharePrice: big.NewInt(11000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(StockSplit{big.NewInt(2), big.NewInt(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetSharePrice("$60.00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(60), sharePrice: big.NewInt(6000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := st.NominalVsRealReturn("0xALICE", inception)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each share of $100 is now two of $60
+	if want := big.NewRat(1, 5); ret.CapitalGain.Cmp(want) != 0 {
+		t.Errorf("CapitalGain = %s, want %s", ret.CapitalGain.RatString(), want.RatString())
+	}
+	// 1.02 * 1.01 - 1
+	if want := big.NewRat(302, 10000); ret.DividendReturn.Cmp(want) != 0 {
+		t.Errorf("DividendReturn = %s, want %s", ret.DividendReturn.RatString(), want.RatString())
+	}
+	compound := new(big.Rat).Mul(ret.CapitalGain, ret.DividendReturn)
+	compound.Add(compound, ret.CapitalGain).Add(compound, ret.DividendReturn)
+	if ret.TotalReturn.Cmp(compound) != 0 {
+		t.Errorf("TotalReturn = %s, want CapitalGain + DividendReturn + CapitalGain*DividendReturn = %s", ret.TotalReturn.RatString(), compound.RatString())
+	}
+	// Alice's 100 tokens worth $10,000 are now 206.04 worth $12,362.40
+	value := new(big.Rat).SetFrac(new(big.Int).Mul(st.BalanceOf("0xALICE"), big.NewInt(60)), tokens(100*100))
+	if want := value.Sub(value, big.NewRat(1, 1)); ret.TotalReturn.Cmp(want) != 0 {
+		t.Errorf("TotalReturn = %s, want %s", ret.TotalReturn.FloatString(6), want.FloatString(6))
+	}
+
+	if _, err := st.NominalVsRealReturn("0xBOB", inception); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("return for a later holder: err = %v, want ErrInsufficientBalance", err)
+	}
+	if _, err := st.NominalVsRealReturn("0xALICE", inception+1); err == nil {
+		t.Error("return since an unknown snapshot succeeded")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// MintEntry is one mint in a BatchMint. Shares is a decimal amount such as "2.5".
+type MintEntry struct {
+	Address string
+	Shares  string
+}
+
+// TransferEntry is one transfer in a StockToken BatchTransfer
+type TransferEntry struct {
+	From   string
+	To     string
+	Amount *big.Int
+}
+
+// BatchEntryError is the error for the entry at Index in a batch
+type BatchEntryError struct {
+	Index int
+	Err   error
+}
+
+func (e BatchEntryError) Error() string {
+	return fmt.Sprintf("entry %d: %v", e.Index, e.Err)
+}
+
+func (e BatchEntryError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError lists the entries that made a batch fail. No entry of a failed batch is applied.
+type BatchError struct {
+	Errors []BatchEntryError
+}
+
+func (e *BatchError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, entryErr := range e.Errors {
+		messages[i] = entryErr.Error()
+	}
+	return "batch failed: " + strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.Is and errors.As match any entry's error
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, entryErr := range e.Errors {
+		errs[i] = entryErr
+	}
+	return errs
+}
+
+// BatchMint mints every entry under a single lock. Either every entry is minted or, if any
+// entry is invalid, none are and a *BatchError lists the invalid entries. While the token is
+// paused a batch can only mint to the owner. One "batch_mint" event with the total minted is
+// emitted instead of one per entry.
+func (t *StockToken) BatchMint(entries []MintEntry) error {
+	if len(entries) == 0 {
+		return errors.New("empty batch")
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	amounts := make([]*big.Int, len(entries))
+	addresses := make([]string, len(entries))
+	total := big.NewInt(0)
+	batchErr := &BatchError{}
+	for i, entry := range entries {
+		if err := t.checkAddresses(entry.Address); err != nil {
+			batchErr.Errors = append(batchErr.Errors, BatchEntryError{i, err})
+			continue
+		}
+		amount, err := ParseTokens(entry.Shares, t.Precision)
+		if err == nil && amount.Sign() == 0 {
+			err = fmt.Errorf("%w: mint amount must be positive", ErrInvalidAmount)
+		}
+		if err != nil {
+			batchErr.Errors = append(batchErr.Errors, BatchEntryError{i, err})
+			continue
+		}
+		amounts[i] = amount
+		addresses[i] = entry.Address
+		total.Add(total, amount)
+	}
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+	if err := t.checkMint(total, addresses...); err != nil {
+		return err
+	}
+
+	mark := len(t.hooks.pending)
+	for i, entry := range entries {
+		t.mint(entry.Address, amounts[i])
+	}
+	t.hooks.collapse(mark, "batch_mint", total, t.now())
+	return nil
+}
+
+// BatchTransfer applies every transfer in order under a single lock, charging transfer fees as
+// usual. Either every transfer succeeds or none are applied and a *BatchError lists the entries
+// that failed. One "batch_transfer" event with the total transferred is emitted.
+func (t *StockToken) BatchTransfer(entries []TransferEntry) error {
+	if len(entries) == 0 {
+		return errors.New("empty batch")
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Entries are checked against the balances from before the batch, so each sender's amounts
+	// and fees are summed and the running total checked against its vested balance. Otherwise
+	// several entries that each fit in the vested part could together spend unvested tokens.
+	batchErr := &BatchError{}
+	sent := make(map[string]*big.Int)
+	now := t.now()
+	for i, entry := range entries {
+		if err := t.checkAddresses(entry.From, entry.To); err != nil {
+			batchErr.Errors = append(batchErr.Errors, BatchEntryError{i, err})
+			continue
+		}
+		if err := t.checkTransfer(entry.From, entry.Amount); err != nil {
+			batchErr.Errors = append(batchErr.Errors, BatchEntryError{i, err})
+			continue
+		}
+		if sent[entry.From] == nil {
+			sent[entry.From] = big.NewInt(0)
+		}
+		sent[entry.From].Add(sent[entry.From], entry.Amount)
+		sent[entry.From].Add(sent[entry.From], t.transactionFee(entry.Amount))
+		if err := t.checkVesting(entry.From, sent[entry.From], now); err != nil {
+			batchErr.Errors = append(batchErr.Errors, BatchEntryError{i, err})
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return batchErr
+	}
+
+	// Balances depend on earlier entries, so apply in order and roll back on the first failure
+	balances := make(map[string]*big.Int, len(t.balances))
+	for address, balance := range t.balances {
+		balances[address] = new(big.Int).Set(balance)
+	}
+	mark := len(t.hooks.pending)
+
+	total := big.NewInt(0)
+	for i, entry := range entries {
+		if err := t.transfer(entry.From, entry.To, entry.Amount); err != nil {
+			t.setBalances(balances)
+			t.hooks.pending = t.hooks.pending[:mark]
+			return &BatchError{Errors: []BatchEntryError{{i, err}}}
+		}
+		total.Add(total, entry.Amount)
+	}
+	t.hooks.collapse(mark, "batch_transfer", total, t.now())
+	return nil
+}
+
+// BatchRebaseError is the error for the action at Index in a BatchRebase
+type BatchRebaseError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchRebaseError) Error() string {
+	return fmt.Sprintf("batch rebase failed at action %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchRebaseError) Unwrap() error {
+	return e.Err
+}
+
+// BatchRebase applies actions in order under a single write lock, e.g. a split announced
+// together with a special dividend. The actions work on a copy of the ledger that is only
+// committed once all of them succeed; if any fails, nothing changes and a *BatchRebaseError
+// gives its index. A StockMerger or SpinOffAction cannot be batched, as it changes another
+// token.
+//
+// One "batch_rebase" event is emitted and one RebaseEvent, listing the actions, is recorded
+// and published. OnRebase is still called once per action.
+func (t *StockToken) BatchRebase(actions []RebaseAction) error {
+	if len(actions) == 0 {
+		return errors.New("empty batch")
+	}
+
+	actions = slices.Clone(actions)
+	for i, action := range actions {
+		if rebasePartner(action) != nil {
+			return &BatchRebaseError{i, fmt.Errorf("a %s cannot be part of a batch rebase", rebaseActionType(action))}
+		}
+		refreshed, err := t.refreshDividendPrice(action)
+		if err != nil {
+			return &BatchRebaseError{i, err}
+		}
+		actions[i] = refreshed
+	}
+
+	for _, action := range actions {
+		announceRebase(action)
+	}
+	defer t.emitEvents()
+
+	event, err := t.batchRebase(actions)
+	if err != nil {
+		return err
+	}
+
+	if t.OnRebase != nil {
+		for _, action := range actions {
+			t.OnRebase(t, action)
+		}
+	}
+	t.publishRebase(event)
+	return nil
+}
+
+// batchRebase applies actions to a copy of the ledger under the write lock and commits it if
+// every action succeeds
+func (t *StockToken) batchRebase(actions []RebaseAction) (event RebaseEvent, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isPaused {
+		return RebaseEvent{}, ErrTokenPaused
+	}
+
+	preTotalSupply := new(big.Int).Set(t.totalSupply)
+	committed := t.copyLedger()
+	defer func() {
+		if r := recover(); r != nil {
+			t.restoreLedger(committed)
+			panic(r)
+		}
+	}()
+
+	types := make([]string, len(actions))
+	for i, action := range actions {
+		if err := t.applyAction(action); err != nil {
+			t.restoreLedger(committed)
+			return RebaseEvent{}, &BatchRebaseError{i, err}
+		}
+		types[i] = rebaseActionType(action)
+	}
+	t.rebaseCount += len(actions)
+
+	event = RebaseEvent{
+		ActionType:      "batch_rebase",
+		Timestamp:       t.now(),
+		PreTotalSupply:  preTotalSupply,
+		PostTotalSupply: new(big.Int).Set(t.totalSupply),
+		BalanceDiff:     balanceDiff(committed.balances, t.balances),
+		Actions:         types,
+		DividendYield:   dividendYield(actions...),
+	}
+	t.RebaseHistory = append(t.RebaseHistory, event)
+	t.hooks.record("batch_rebase", "", "", new(big.Int).Sub(event.PostTotalSupply, preTotalSupply), event.Timestamp)
+	return event, nil
+}
+
+// ledgerState is the token state a rebase other than a merger can change
+type ledgerState struct {
+	balances         map[string]*big.Int
+	stakedBalances   map[string]*big.Int
+	allowances       map[string]map[string]*big.Int
+	vestingSchedules map[string][]*VestingSchedule
+	taxWithheld      map[string]*big.Int
+	totalSupply      *big.Int
+	sharePrice       *big.Int
+	rebaseMultiplier *big.Rat
+	splitCount       int
+	dividendCount    int
+	rebaseCount      int
+	historyLen       int // entries in RebaseHistory before the copy, later ones are dropped on restore
+	pendingEvents    int // events queued before the copy, later ones are dropped on restore
+}
+
+// copyLedger puts deep copies of the state a rebase can change in place of the originals and
+// returns the originals, so the copies can be changed and then kept or discarded with
+// restoreLedger. The caller must hold t.mu.
+func (t *StockToken) copyLedger() ledgerState {
+	committed := ledgerState{
+		balances:         t.balances,
+		stakedBalances:   t.stakedBalances,
+		allowances:       t.allowances,
+		vestingSchedules: t.vestingSchedules,
+		taxWithheld:      t.TaxWithheld,
+		totalSupply:      t.totalSupply,
+		sharePrice:       t.sharePrice,
+		rebaseMultiplier: t.rebaseMultiplier,
+		splitCount:       t.splitCount,
+		dividendCount:    t.dividendCount,
+		rebaseCount:      t.rebaseCount,
+		historyLen:       len(t.RebaseHistory),
+		pendingEvents:    len(t.hooks.pending),
+	}
+
+	t.balances = copyAmounts(t.balances)
+	if t.stakedBalances != nil {
+		t.stakedBalances = copyAmounts(t.stakedBalances)
+	}
+	if t.allowances != nil {
+		t.allowances = make(map[string]map[string]*big.Int, len(committed.allowances))
+		for owner, spenders := range committed.allowances {
+			t.allowances[owner] = copyAmounts(spenders)
+		}
+	}
+	if t.vestingSchedules != nil {
+		t.vestingSchedules = make(map[string][]*VestingSchedule, len(committed.vestingSchedules))
+		for address, schedules := range committed.vestingSchedules {
+			for _, s := range schedules {
+				schedule := *s
+				schedule.TotalAmount = copyAmount(s.TotalAmount)
+				t.vestingSchedules[address] = append(t.vestingSchedules[address], &schedule)
+			}
+		}
+	}
+	if t.TaxWithheld != nil {
+		t.TaxWithheld = copyAmounts(t.TaxWithheld)
+	}
+	t.totalSupply = new(big.Int).Set(t.totalSupply)
+	t.sharePrice = new(big.Int).Set(t.sharePrice)
+	return committed
+}
+
+// restoreLedger puts back the state returned by copyLedger. The caller must hold t.mu.
+func (t *StockToken) restoreLedger(committed ledgerState) {
+	// Not setBalances: the committed balances are the ones already checkpointed
+	t.balances = committed.balances
+	t.holders = newHolderIndex(committed.balances)
+	t.stakedBalances = committed.stakedBalances
+	t.allowances = committed.allowances
+	t.vestingSchedules = committed.vestingSchedules
+	t.TaxWithheld = committed.taxWithheld
+	t.totalSupply = committed.totalSupply
+	t.sharePrice = committed.sharePrice
+	t.rebaseMultiplier = committed.rebaseMultiplier
+	t.splitCount = committed.splitCount
+	t.dividendCount = committed.dividendCount
+	t.rebaseCount = committed.rebaseCount
+	t.RebaseHistory = t.RebaseHistory[:committed.historyLen]
+	t.hooks.pending = t.hooks.pending[:committed.pendingEvents]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestBatchMintAllOrNothing(t *testing.T) {
+	st := newTestToken(t)
+	var events []TransferEvent
+	st.RegisterTransferHook(func(event TransferEvent) { events = append(events, event) })
+
+	err := st.BatchMint([]MintEntry{{"0xALICE", "1.5"}, {"", "1"}, {"0xBOB", "0"}})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 || batchErr.Errors[0].Index != 1 || batchErr.Errors[1].Index != 2 {
+		t.Fatalf("err = %v, want a BatchError for entries 1 and 2", err)
+	}
+	if got := st.TotalSupply(); got.Sign() != 0 {
+		t.Errorf("total supply = %s after a rejected batch, want 0", got)
+	}
+
+	if err := st.BatchMint([]MintEntry{{"0xALICE", "1.5"}, {"0xBOB", "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", big.NewInt(1_500_000))
+	checkBalance(t, st, "0xBOB", tokens(2))
+	if len(events) != 1 || events[0].Kind != "batch_mint" || events[0].Amount.Cmp(big.NewInt(3_500_000)) != 0 {
+		t.Errorf("events = %v, want one batch_mint of 3500000", events)
+	}
+}
+
+func TestBatchMintValidatesAddresses(t *testing.T) {
+	st := newTestToken(t)
+	st.LaxAddressValidation = false
+	err := st.BatchMint([]MintEntry{{"0x52908400098527886E0F7030069857D2E4169EE7", "1"}, {"0xREECE", "1"}})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || batchErr.Errors[0].Index != 1 || !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("err = %v, want ErrInvalidAddress for entry 1", err)
+	}
+}
+
+func TestBatchMintWhilePaused(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.BatchMint([]MintEntry{{"0xOWNER", "1"}, {"0xALICE", "1"}}); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("paused batch to the owner and another address: err = %v, want ErrTokenPaused", err)
+	}
+	if err := st.BatchMint([]MintEntry{{"0xOWNER", "1"}, {"0xOWNER", "2"}}); err != nil {
+		t.Errorf("paused batch to the owner only: %v", err)
+	}
+	checkBalance(t, st, "0xOWNER", tokens(3))
+}
+
+func TestBatchMintHonoursCap(t *testing.T) {
+	st := newTestToken(t)
+	st.maxSupply = tokens(2)
+	if err := st.BatchMint([]MintEntry{{"0xALICE", "1"}, {"0xBOB", "1.5"}}); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("err = %v, want ErrSupplyCap", err)
+	}
+}
+
+func TestBatchTransferAllOrNothing(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+
+	// The second entry can only be paid from the first, and the third overdraws
+	err := st.BatchTransfer([]TransferEntry{
+		{"0xALICE", "0xBOB", tokens(6)},
+		{"0xBOB", "0xCAROL", tokens(6)},
+		{"0xALICE", "0xCAROL", tokens(6)},
+	})
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("err = %v, want ErrInsufficientBalance", err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkBalance(t, st, "0xBOB", big.NewInt(0))
+
+	if err := st.BatchTransfer([]TransferEntry{{"0xALICE", "0xBOB", tokens(6)}, {"0xBOB", "0xCAROL", tokens(6)}}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xCAROL", tokens(6))
+	checkSane(t, st)
+}
+
+func TestBatchTransferValidatesAddresses(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	st.LaxAddressValidation = false
+	err := st.BatchTransfer([]TransferEntry{{"0xALICE", "0xBOB", tokens(1)}})
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("err = %v, want ErrInvalidAddress", err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+}
+
+func TestBatchTransferSumsVestingSender(t *testing.T) {
+	st := newLockedToken(t)
+
+	// Each entry fits in the 4 free tokens, but together they would spend 4 unvested ones
+	err := st.BatchTransfer([]TransferEntry{
+		{"0xALICE", "0xBOB", tokens(4)},
+		{"0xALICE", "0xCAROL", tokens(4)},
+	})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrBalanceLocked) {
+		t.Fatalf("err = %v, want a *BatchError with ErrBalanceLocked", err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors[0].Index != 1 {
+		t.Errorf("failed entries = %v, want only entry 1", batchErr.Errors)
+	}
+	checkBalance(t, st, "0xALICE", tokens(14))
+	checkBalance(t, st, "0xBOB", big.NewInt(0))
+
+	if err := st.BatchTransfer([]TransferEntry{{"0xALICE", "0xBOB", tokens(2)}, {"0xALICE", "0xCAROL", tokens(2)}}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkSane(t, st)
+}
+
+// batchEntries returns n mint entries of one token each
+func batchEntries(n int) []MintEntry {
+	entries := make([]MintEntry, n)
+	for i := range entries {
+		entries[i] = MintEntry{fmt.Sprintf("0xHOLDER%05d", i), "1"}
+	}
+	return entries
+}
+
+func BenchmarkBatchMint(b *testing.B) {
+	entries := batchEntries(10_000)
+	for i := 0; i < b.N; i++ {
+		st := newTestToken(b)
+		if err := st.BatchMint(entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSequentialMint(b *testing.B) {
+	entries := batchEntries(10_000)
+	for i := 0; i < b.N; i++ {
+		st := newTestToken(b)
+		for _, entry := range entries {
+			mustMint(b, st, entry.Address, 1)
+		}
+	}
+}
+
+func BenchmarkBatchTransfer(b *testing.B) {
+	entries := make([]TransferEntry, 10_000)
+	for i := range entries {
+		entries[i] = TransferEntry{"0xALICE", fmt.Sprintf("0xHOLDER%05d", i), big.NewInt(1)}
+	}
+	st := newTestToken(b)
+	mustMint(b, st, "0xALICE", 1_000_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := st.BatchTransfer(entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBatchRebaseMatchesSequential(t *testing.T) {
+	actions := []RebaseAction{
+		doubleSplit,
+		Dividend{cashAmount: big.NewInt(250), sharePrice: big.NewInt(5000)},
+		StockSplit{Numerator: big.NewInt(2), Denominator: big.NewInt(3)},
+		ReturnOfCapital{AmountPerShareCents: big.NewInt(100)},
+	}
+	setup := func() *StockToken {
+		st := newTestToken(t)
+		for address, amount := range map[string]string{"0xALICE": "10", "0xBOB": "3.333333", "0xCAROL": "0.000007"} {
+			if err := st.MintFractional(address, amount); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := st.Approve("0xALICE", "0xSPENDER", tokens(1)); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	sequential, batched := setup(), setup()
+	for _, action := range actions {
+		if err := sequential.Rebase(action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var events []TransferEvent
+	batched.RegisterTransferHook(func(event TransferEvent) { events = append(events, event) })
+	if err := batched.BatchRebase(actions); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := balanceDiff(sequential.SnapshotBalances(), batched.SnapshotBalances()); len(diff) != 0 {
+		t.Errorf("batched balances differ from sequential ones by %v", diff)
+	}
+	for _, check := range []struct {
+		name                string
+		sequential, batched fmt.Stringer
+	}{
+		{"total supply", sequential.TotalSupply(), batched.TotalSupply()},
+		{"share price", sequential.SharePrice(), batched.SharePrice()},
+		{"multiplier", sequential.CumulativeMultiplier(), batched.CumulativeMultiplier()},
+		{"allowance", sequential.Allowance("0xALICE", "0xSPENDER"), batched.Allowance("0xALICE", "0xSPENDER")},
+	} {
+		if check.sequential.String() != check.batched.String() {
+			t.Errorf("batched %s = %s, want %s", check.name, check.batched, check.sequential)
+		}
+	}
+	checkSane(t, batched)
+
+	// One history entry and one event cover the whole batch
+	if len(batched.RebaseHistory) != 1 {
+		t.Fatalf("batch recorded %d history entries, want 1", len(batched.RebaseHistory))
+	}
+	entry := batched.RebaseHistory[0]
+	if entry.ActionType != "batch_rebase" || fmt.Sprint(entry.Actions) != "[split dividend split return_of_capital]" {
+		t.Errorf("history entry %s with actions %v", entry.ActionType, entry.Actions)
+	}
+	if len(events) != 1 || events[0].Kind != "batch_rebase" {
+		t.Errorf("batch emitted %v, want one batch_rebase event", events)
+	}
+}
+
+func TestBatchRebaseRejectsWholeBatch(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	before := st.Clone()
+	err := st.BatchRebase([]RebaseAction{
+		doubleSplit,
+		Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)},
+		StockSplit{Numerator: big.NewInt(0), Denominator: big.NewInt(1)},
+	})
+	var batchErr *BatchRebaseError
+	if !errors.As(err, &batchErr) || batchErr.Index != 2 || !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("err = %v, want a BatchRebaseError at index 2 wrapping %v", err, ErrInvalidAmount)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	if st.TotalSupply().Cmp(before.TotalSupply()) != 0 || st.SharePrice().Cmp(before.SharePrice()) != 0 || len(st.RebaseHistory) != 0 {
+		t.Errorf("rejected batch left supply %s, price %s and %d history entries", st.TotalSupply(), st.SharePrice(), len(st.RebaseHistory))
+	}
+	if err := st.BatchRebase(nil); err == nil {
+		t.Error("empty batch accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "time"
+
+// Clock supplies the current time and timers. Tokens use the system clock unless one is set,
+// so tests can substitute a fake clock and move time forward without sleeping.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock used when a token has none set
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clock returns the token's Clock, or the system clock if none is set
+func (t *StockToken) clock() Clock {
+	if t.Clock == nil {
+		return systemClock{}
+	}
+	return t.Clock
+}
+
+// now returns the current time on the token's clock
+func (t *StockToken) now() time.Time {
+	return t.clock().Now()
+}
+
+// clock returns the wrapper's Clock, or the system clock if none is set
+func (ow *OndoWrappedStock) clock() Clock {
+	if ow.Clock == nil {
+		return systemClock{}
+	}
+	return ow.Clock
+}
+
+// now returns the current time on the wrapper's clock
+func (ow *OndoWrappedStock) now() time.Time {
+	return ow.clock().Now()
+}
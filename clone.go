@@ -0,0 +1,246 @@
+package main
+
+import (
+	"math/big"
+	"slices"
+	"time"
+)
+
+// Clone returns an independent deep copy of the token for simulations and backtests. Balances,
+// prices, settings, instruments, snapshots, rebase history, the event log and the attached
+// oracle are copied. Hooks, OnRebase, rebase subscribers and a running scheduler belong to the
+// original and are left empty on the clone.
+func (t *StockToken) Clone() *StockToken {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	c := &StockToken{
+		seq:                    tokenSeq.Add(1),
+		Precision:              new(big.Int).Set(t.Precision),
+		Name:                   t.Name,
+		Symbol:                 t.Symbol,
+		Decimals:               t.Decimals,
+		ticker:                 t.ticker,
+		owner:                  t.owner,
+		totalSupply:            new(big.Int).Set(t.totalSupply),
+		balances:               copyAmounts(t.balances),
+		holders:                slices.Clone(t.holders),
+		rebaseMultiplier:       new(big.Rat).Set(t.rebaseMultiplier),
+		sharePrice:             new(big.Int).Set(t.sharePrice),
+		floorPrice:             copyAmount(t.floorPrice),
+		isPaused:               t.isPaused,
+		dustAddress:            t.dustAddress,
+		treasuryAddress:        t.treasuryAddress,
+		maxSupply:              copyAmount(t.maxSupply),
+		LaxAddressValidation:   t.LaxAddressValidation,
+		YieldMultiplier:        copyRat(t.YieldMultiplier),
+		maxPriceAge:            t.maxPriceAge,
+		priceFeedKey:           slices.Clone(t.priceFeedKey),
+		oracle:                 copyOracle(t.oracle),
+		rightsPrice:            copyAmount(t.rightsPrice),
+		nextWarrantID:          t.nextWarrantID,
+		nextNoteID:             t.nextNoteID,
+		nextSubscriptionPlanID: t.nextSubscriptionPlanID,
+		FeeRecipient:           t.FeeRecipient,
+		flatFee:                copyAmount(t.flatFee),
+		feeBps:                 t.feeBps,
+		feeSplits:              slices.Clone(t.feeSplits),
+		nextSubscriptionID:     t.nextSubscriptionID,
+		nextSnapshotID:         t.nextSnapshotID,
+		checkpointedAll:        t.checkpointedAll,
+		rebaseCount:            t.rebaseCount,
+		splitCount:             t.splitCount,
+		dividendCount:          t.dividendCount,
+	}
+	if t.EventLog != nil {
+		c.EventLog = t.EventLog.clone()
+		c.hooks.log = c.EventLog
+	}
+	if t.stakedBalances != nil {
+		c.stakedBalances = copyAmounts(t.stakedBalances)
+	}
+	if t.RightsBalance != nil {
+		c.RightsBalance = copyAmounts(t.RightsBalance)
+	}
+	if t.TaxWithheld != nil {
+		c.TaxWithheld = copyAmounts(t.TaxWithheld)
+	}
+	if t.UnclaimedDividends != nil {
+		c.UnclaimedDividends = copyAmounts(t.UnclaimedDividends)
+	}
+	if t.allowances != nil {
+		c.allowances = make(map[string]map[string]*big.Int, len(t.allowances))
+		for owner, spenders := range t.allowances {
+			c.allowances[owner] = copyAmounts(spenders)
+		}
+	}
+	c.balanceCheckpoints = copyCheckpoints(t.balanceCheckpoints)
+	c.stakedCheckpoints = copyCheckpoints(t.stakedCheckpoints)
+	for _, mark := range t.snapshotMarks {
+		mark.sharePrice = copyAmount(mark.sharePrice)
+		mark.rebaseMultiplier = copyRat(mark.rebaseMultiplier)
+		c.snapshotMarks = append(c.snapshotMarks, mark)
+	}
+
+	for _, record := range t.priceHistory {
+		record.PriceCents = copyAmount(record.PriceCents)
+		c.priceHistory = append(c.priceHistory, record)
+	}
+	for _, event := range t.RebaseHistory {
+		event.PreTotalSupply = copyAmount(event.PreTotalSupply)
+		event.PostTotalSupply = copyAmount(event.PostTotalSupply)
+		if event.BalanceDiff != nil {
+			event.BalanceDiff = copyAmounts(event.BalanceDiff)
+		}
+		event.DividendYield = copyRat(event.DividendYield)
+		c.RebaseHistory = append(c.RebaseHistory, event)
+	}
+
+	if t.warrants != nil {
+		c.warrants = make(map[int]*Warrant, len(t.warrants))
+		for id, w := range t.warrants {
+			warrant := *w
+			warrant.StrikePrice = copyAmount(w.StrikePrice)
+			warrant.Quantity = copyAmount(w.Quantity)
+			c.warrants[id] = &warrant
+		}
+	}
+	if t.notes != nil {
+		c.notes = make(map[int]*ConvertibleNote, len(t.notes))
+		for id, n := range t.notes {
+			note := *n
+			note.PrincipalCents = copyAmount(n.PrincipalCents)
+			note.ConversionPriceCents = copyAmount(n.ConversionPriceCents)
+			c.notes[id] = &note
+		}
+	}
+	if t.subscriptions != nil {
+		c.subscriptions = make(map[int]*Subscription, len(t.subscriptions))
+		for id, s := range t.subscriptions {
+			subscription := *s
+			c.subscriptions[id] = &subscription
+		}
+	}
+	if t.transferRestrictions != nil {
+		c.transferRestrictions = make(map[string]time.Time, len(t.transferRestrictions))
+		for address, until := range t.transferRestrictions {
+			c.transferRestrictions[address] = until
+		}
+	}
+	if t.vestingSchedules != nil {
+		c.vestingSchedules = make(map[string][]*VestingSchedule, len(t.vestingSchedules))
+		for address, schedules := range t.vestingSchedules {
+			for _, s := range schedules {
+				c.vestingSchedules[address] = append(c.vestingSchedules[address], &VestingSchedule{
+					TotalAmount: copyAmount(s.TotalAmount),
+					StartTime:   copyAmount(s.StartTime),
+					EndTime:     copyAmount(s.EndTime),
+				})
+			}
+		}
+	}
+	if t.withholdingTaxBps != nil {
+		c.withholdingTaxBps = make(map[string]uint, len(t.withholdingTaxBps))
+		for address, bps := range t.withholdingTaxBps {
+			c.withholdingTaxBps[address] = bps
+		}
+	}
+	if t.appliedActions != nil {
+		c.appliedActions = make(map[string]bool, len(t.appliedActions))
+		for actionID := range t.appliedActions {
+			c.appliedActions[actionID] = true
+		}
+	}
+	return c
+}
+
+// Clone returns an independent deep copy of the wrapper and its event log. Hooks are left empty
+// on the clone.
+func (ow *OndoWrappedStock) Clone() *OndoWrappedStock {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	c := &OndoWrappedStock{
+		Precision:           new(big.Int).Set(ow.Precision),
+		Name:                ow.Name,
+		Symbol:              ow.Symbol,
+		Decimals:            ow.Decimals,
+		ticker:              ow.ticker,
+		totalSupply:         new(big.Int).Set(ow.totalSupply),
+		balances:            copyAmounts(ow.balances),
+		holders:             slices.Clone(ow.holders),
+		exchangeRate:        new(big.Int).Set(ow.exchangeRate),
+		treasury:            ow.treasury,
+		FeeBasisPoints:      ow.FeeBasisPoints,
+		FeeRecipient:        ow.FeeRecipient,
+		TransferFeeBps:      ow.TransferFeeBps,
+		MaxRateHistory:      ow.MaxRateHistory,
+		DefaultRoundingMode: ow.DefaultRoundingMode,
+		roundingDust:        copyAmount(ow.roundingDust),
+	}
+	if ow.allowances != nil {
+		c.allowances = make(map[string]map[string]*big.Int, len(ow.allowances))
+		for owner, spenders := range ow.allowances {
+			c.allowances[owner] = copyAmounts(spenders)
+		}
+	}
+	for _, entry := range ow.RateHistory {
+		c.RateHistory = append(c.RateHistory, RateEntry{
+			Timestamp:   entry.Timestamp,
+			Rate:        new(big.Int).Set(entry.Rate),
+			TotalSupply: new(big.Int).Set(entry.TotalSupply),
+		})
+	}
+	if ow.EventLog != nil {
+		c.EventLog = ow.EventLog.clone()
+		c.hooks.log = c.EventLog
+	}
+	return c
+}
+
+// copyAmounts returns a map with the same keys and copies of the amounts
+func copyAmounts(amounts map[string]*big.Int) map[string]*big.Int {
+	result := make(map[string]*big.Int, len(amounts))
+	for key, amount := range amounts {
+		result[key] = new(big.Int).Set(amount)
+	}
+	return result
+}
+
+// copyCheckpoints deep copies snapshot checkpoints, keeping nil as nil
+func copyCheckpoints(checkpoints map[string][]checkpoint) map[string][]checkpoint {
+	if checkpoints == nil {
+		return nil
+	}
+	result := make(map[string][]checkpoint, len(checkpoints))
+	for address, recorded := range checkpoints {
+		for _, cp := range recorded {
+			result[address] = append(result[address], checkpoint{cp.id, new(big.Int).Set(cp.balance)})
+		}
+	}
+	return result
+}
+
+// copyAmount copies amount, keeping nil as nil
+func copyAmount(amount *big.Int) *big.Int {
+	if amount == nil {
+		return nil
+	}
+	return new(big.Int).Set(amount)
+}
+
+// copyRat copies r, keeping nil as nil
+func copyRat(r *big.Rat) *big.Rat {
+	if r == nil {
+		return nil
+	}
+	return new(big.Rat).Set(r)
+}
+
+// copyOracle copies the price held by a StaticOracle. Other oracles are shared.
+func copyOracle(o PriceOracle) PriceOracle {
+	if static, ok := o.(StaticOracle); ok {
+		return StaticOracle{PriceCents: copyAmount(static.PriceCents)}
+	}
+	return o
+}
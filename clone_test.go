@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	ow.UpdateExchangeRate(st)
+	st.AttachOracle(StaticOracle{PriceCents: big.NewInt(5000)})
+	hooked := 0
+	st.RegisterTransferHook(func(TransferEvent) { hooked++ })
+	ow.RegisterTransferHook(func(TransferEvent) { hooked++ })
+	state := func(st *StockToken, ow *OndoWrappedStock) string {
+		return fmt.Sprint(st.balances, st.TotalSupply(), st.SharePrice(), st.CumulativeMultiplier(), len(st.RebaseHistory),
+			ow.balances, ow.totalSupply, ow.exchangeRate, len(ow.RateHistory))
+	}
+	original := state(st, ow)
+
+	cst, cow := st.Clone(), ow.Clone()
+	if got := state(cst, cow); got != original {
+		t.Fatalf("clone state\n%s\nwant\n%s", got, original)
+	}
+
+	// Changing a clone's balances in place, or through its methods, leaves the original alone
+	cst.balances["0xALICE"].SetInt64(0)
+	cow.balances["0xALICE"].SetInt64(0)
+	cst.RebaseHistory[0].PostTotalSupply.SetInt64(0)
+	mustMint(t, cst, "0xCAROL", 1)
+	if err := cst.Rebase(Dividend{cashAmount: big.NewInt(500), sharePrice: big.NewInt(5000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cow.Transfer("0xALICE", "0xBOB", tokens(1)); err == nil {
+		t.Error("transfer of a zeroed clone balance succeeded")
+	}
+	cow.UpdateExchangeRate(cst)
+	if got := state(st, ow); got != original {
+		t.Errorf("original state changed to\n%s\nwant\n%s", got, original)
+	}
+	if got := st.RebaseHistory[0].PostTotalSupply; got.Cmp(tokens(30)) != 0 {
+		t.Errorf("original history supply = %s, want %s", got, tokens(30))
+	}
+
+	// The clone keeps the oracle but none of the hooks
+	if hooked != 0 {
+		t.Errorf("the clone fired %d of the original's hooks", hooked)
+	}
+	if cst.oracle == nil {
+		t.Error("the clone lost the attached oracle")
+	}
+	if err := cst.RefreshPrice(); err != nil || cst.SharePrice().Cmp(big.NewInt(5000)) != 0 {
+		t.Errorf("clone RefreshPrice = %v, price %s, want 5000", err, cst.SharePrice())
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// UniformSplitAction credits the same AmountPerHolder to every address with a positive
+// balance, regardless of how large that balance is. It is recorded in RebaseHistory as a
+// "uniform_split".
+type UniformSplitAction struct {
+	AmountPerHolder *big.Int
+}
+
+// UniformSplit rebases with a UniformSplitAction crediting amountPerHolder to every holder
+func (t *StockToken) UniformSplit(amountPerHolder *big.Int) error {
+	return t.Rebase(UniformSplitAction{AmountPerHolder: amountPerHolder})
+}
+
+// applyUniformSplit mints AmountPerHolder to every holder. The caller must hold t.mu.
+func (t *StockToken) applyUniformSplit(v UniformSplitAction) error {
+	if v.AmountPerHolder == nil || v.AmountPerHolder.Sign() <= 0 {
+		return fmt.Errorf("%w: amount per holder must be positive", ErrInvalidAmount)
+	}
+
+	var recipients []string
+	for _, address := range t.holders {
+		if t.balances[address].Sign() > 0 {
+			recipients = append(recipients, address)
+		}
+	}
+	minted := new(big.Int).Mul(v.AmountPerHolder, big.NewInt(int64(len(recipients))))
+	if err := t.checkMint(minted, recipients...); err != nil {
+		return err
+	}
+
+	for _, address := range recipients {
+		t.mint(address, v.AmountPerHolder)
+	}
+	return nil
+}
+
+// Spinoff mints floor(balance * ratio) child shares to every holder of parent, e.g. a ratio
+// of 1/5 gives one child share per five parent shares. The shares lost to rounding are minted
+// to the child's dust address, so the child supply is floor(parent supply * ratio). The parent
+// is not changed. child must have no supply yet, otherwise ErrNonEmptyChild is returned.
+// A SpinoffEvent is sent to the spinoff hooks of both tokens.
+func Spinoff(parent, child *StockToken, ratio *big.Rat) error {
+	if parent == nil || child == nil {
+		return errors.New("spinoff token is nil")
+	}
+
+	defer parent.emitEvents()
+	defer child.emitEvents()
+	defer lockTokens(parent, child)()
+	return spinoff(parent, child, ratio)
+}
+
+// spinoff is Spinoff for callers that already hold parent.mu and child.mu, taken together
+// with lockTokens
+func spinoff(parent, child *StockToken, ratio *big.Rat) error {
+	if parent == nil || child == nil {
+		return errors.New("spinoff token is nil")
+	}
+	if parent == child {
+		return errors.New("a token cannot spin off into itself")
+	}
+	if ratio == nil || ratio.Sign() <= 0 {
+		return fmt.Errorf("%w: spinoff ratio must be positive", ErrInvalidAmount)
+	}
+	if child.totalSupply.Sign() != 0 {
+		return ErrNonEmptyChild
+	}
+	if child.isPaused {
+		return fmt.Errorf("%w: child %s", ErrTokenPaused, child.ticker)
+	}
+	entitled := new(big.Int).Mul(parent.totalSupply, ratio.Num())
+	entitled.Div(entitled, ratio.Denom())
+	if err := child.checkSupplyCap(entitled); err != nil {
+		return err
+	}
+
+	// Staked parent balances are entitled too, and receive unstaked child shares
+	distributed := big.NewInt(0)
+	for _, balances := range []map[string]*big.Int{parent.balances, parent.stakedBalances} {
+		for _, address := range sortedAddresses(balances) {
+			shares := new(big.Int).Mul(balances[address], ratio.Num())
+			shares.Div(shares, ratio.Denom())
+			if shares.Sign() > 0 {
+				child.mint(address, shares)
+				distributed.Add(distributed, shares)
+			}
+		}
+	}
+
+	dust := new(big.Int).Sub(entitled, distributed)
+	if dust.Sign() > 0 {
+		child.mint(child.dustHolder(), dust)
+	}
+
+	event := SpinoffEvent{
+		Parent:      parent.ticker,
+		Child:       child.ticker,
+		Ratio:       new(big.Rat).Set(ratio),
+		Distributed: distributed,
+		Dust:        dust,
+		Timestamp:   parent.now(),
+	}
+	parent.hooks.recordSpinoff(event)
+	child.hooks.recordSpinoff(event)
+	return nil
+}
+
+// SpinOffAction distributes Child, a token with no supply yet, to the rebased token's holders
+// at Ratio child shares per share, as Spinoff does. As a rebase it is recorded in
+// RebaseHistory as a "spinoff", counted, and passed to OnRebase and rebase subscribers, and a
+// failure leaves both tokens unchanged.
+type SpinOffAction struct {
+	Child *StockToken
+	Ratio *big.Rat
+}
+
+// SpinOffTerms describes a child company for RebaseSpinOff to create. InitialPrice is the
+// child's share price in dollars, e.g. "$12.50".
+type SpinOffTerms struct {
+	ChildTicker  string
+	ChildName    string
+	Ratio        *big.Rat
+	InitialPrice string
+}
+
+// RebaseSpinOff creates the child token described by terms, with the parent's owner, decimals
+// and address validation, and distributes it to the parent's holders by rebasing with a
+// SpinOffAction. It returns the new child.
+func (t *StockToken) RebaseSpinOff(terms SpinOffTerms) (*StockToken, error) {
+	t.mu.RLock()
+	owner, decimals, lax := t.owner, t.Decimals, t.LaxAddressValidation
+	t.mu.RUnlock()
+
+	child, err := NewStockToken(terms.ChildTicker, terms.ChildName, decimals, terms.InitialPrice, owner)
+	if err != nil {
+		return nil, fmt.Errorf("create spinoff child: %w", err)
+	}
+	child.LaxAddressValidation = lax
+	if err := t.Rebase(SpinOffAction{Child: child, Ratio: terms.Ratio}); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// DilutionAction issues NewSharesIssued new shares to the token's treasury address. Existing
+// balances and the share price are unchanged, so every holder's fraction of the supply shrinks
+// by oldSupply / (oldSupply + NewSharesIssued).
+type DilutionAction struct {
+	NewSharesIssued *big.Int
+}
+
+// SetTreasuryAddress sets the address that receives the shares issued by a DilutionAction
+func (t *StockToken) SetTreasuryAddress(address string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(address); err != nil {
+		return err
+	}
+	t.treasuryAddress = address
+	return nil
+}
+
+// applyDilution credits the new shares to the treasury. The caller must hold t.mu.
+func (t *StockToken) applyDilution(v DilutionAction) error {
+	if v.NewSharesIssued == nil || v.NewSharesIssued.Sign() <= 0 {
+		return fmt.Errorf("%w: dilution must issue a positive number of shares", ErrInvalidAmount)
+	}
+	if t.treasuryAddress == "" {
+		return errors.New("no treasury address set for dilution")
+	}
+	if err := t.checkMint(v.NewSharesIssued, t.treasuryAddress); err != nil {
+		return err
+	}
+
+	t.credit(t.treasuryAddress, v.NewSharesIssued)
+	t.totalSupply.Add(t.totalSupply, v.NewSharesIssued)
+	return nil
+}
+
+// SetDustAddress sets the address that receives the rounding dust of splits and spinoffs.
+// An empty address restores DustAddress.
+func (t *StockToken) SetDustAddress(address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dustAddress = address
+}
+
+// dustHolder returns the address that receives rounding dust. The caller must hold t.mu.
+func (t *StockToken) dustHolder() string {
+	if t.dustAddress == "" {
+		return DustAddress
+	}
+	return t.dustAddress
+}
+
+// IssueRights grants every holder the right to buy ratioPerShare new shares per share held,
+// at subscriptionPriceCents per share. Rights stay outstanding until exercised or expired.
+func (t *StockToken) IssueRights(subscriptionPriceCents *big.Int, ratioPerShare *big.Rat) error {
+	if subscriptionPriceCents == nil || subscriptionPriceCents.Sign() <= 0 {
+		return fmt.Errorf("%w: subscription price must be positive", ErrInvalidAmount)
+	}
+	if ratioPerShare == nil || ratioPerShare.Sign() <= 0 {
+		return fmt.Errorf("%w: rights ratio must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isPaused {
+		return ErrTokenPaused
+	}
+	if t.RightsBalance != nil {
+		return errors.New("a rights offering is already outstanding")
+	}
+
+	t.RightsBalance = make(map[string]*big.Int)
+	for _, address := range t.holders {
+		rights := new(big.Int).Mul(t.balances[address], ratioPerShare.Num())
+		rights.Div(rights, ratioPerShare.Denom())
+		if rights.Sign() > 0 {
+			t.RightsBalance[address] = rights
+		}
+	}
+	t.rightsPrice = new(big.Int).Set(subscriptionPriceCents)
+	return nil
+}
+
+// ExerciseRights uses amount of an address's rights to mint the same amount of new shares. It
+// is recorded in the event log as "rights_exercised", with the price and cost in cents.
+func (t *StockToken) ExerciseRights(address string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: rights to exercise must be positive", ErrInvalidAmount)
+	}
+
+	defer t.emitEvents()
+	price, err := t.exerciseRights(address, amount)
+	if err != nil {
+		return err
+	}
+
+	if t.EventLog != nil {
+		cost := new(big.Int).Mul(amount, price)
+		cost.Div(cost, t.Precision)
+		t.EventLog.append("rights_exercised", t.now(), map[string]string{
+			"address": address,
+			"amount":  amount.String(),
+			"price":   price.String(),
+			"cost":    cost.String(),
+		})
+	}
+	return nil
+}
+
+// exerciseRights performs ExerciseRights under the write lock and returns the subscription price paid
+func (t *StockToken) exerciseRights(address string, amount *big.Int) (*big.Int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rights := t.RightsBalance[address]
+	if rights == nil || rights.Cmp(amount) < 0 {
+		return nil, fmt.Errorf("insufficient rights for %s", address)
+	}
+	if err := t.checkMint(amount, address); err != nil {
+		return nil, err
+	}
+
+	rights.Sub(rights, amount)
+	t.mint(address, amount)
+	return new(big.Int).Set(t.rightsPrice), nil
+}
+
+// ExpireRights cancels all outstanding rights
+func (t *StockToken) ExpireRights() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.RightsBalance = nil
+	t.rightsPrice = nil
+}
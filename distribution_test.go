@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestUniformSplitRecordsHistory(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 1)
+	ch := make(chan RebaseEvent, 1)
+	st.SubscribeToRebase(ch)
+	var seen []RebaseAction
+	st.OnRebase = func(_ *StockToken, action RebaseAction) { seen = append(seen, action) }
+
+	if err := st.UniformSplit(tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(12))
+	checkBalance(t, st, "0xBOB", tokens(3))
+	checkSane(t, st)
+
+	// It is counted and passed to OnRebase like any other rebase
+	if st.RebaseCount() != 1 {
+		t.Errorf("RebaseCount = %d, want 1", st.RebaseCount())
+	}
+	if len(seen) != 1 || seen[0].(UniformSplitAction).AmountPerHolder.Cmp(tokens(2)) != 0 {
+		t.Errorf("OnRebase saw %v, want one uniform split of %s", seen, tokens(2))
+	}
+
+	if len(st.RebaseHistory) != 1 {
+		t.Fatalf("rebase history has %d entries, want 1", len(st.RebaseHistory))
+	}
+	event := st.RebaseHistory[0]
+	if event.ActionType != "uniform_split" || event.PreTotalSupply.Cmp(tokens(11)) != 0 || event.PostTotalSupply.Cmp(tokens(15)) != 0 {
+		t.Errorf("event = %s from %s to %s, want uniform_split from %s to %s", event.ActionType, event.PreTotalSupply, event.PostTotalSupply, tokens(11), tokens(15))
+	}
+	for _, address := range []string{"0xALICE", "0xBOB"} {
+		if got := event.BalanceDiff[address]; got.Cmp(tokens(2)) != 0 {
+			t.Errorf("%s diff = %v, want %s", address, got, tokens(2))
+		}
+	}
+	select {
+	case published := <-ch:
+		if published.ActionType != "uniform_split" {
+			t.Errorf("published %s, want uniform_split", published.ActionType)
+		}
+	default:
+		t.Error("uniform split was not published")
+	}
+}
+
+func TestUniformSplitRejectsNonPositive(t *testing.T) {
+	st := newTestToken(t)
+	for _, amount := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		if err := st.UniformSplit(amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("UniformSplit(%v): err = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+	}
+	if st.RebaseCount() != 0 || len(st.RebaseHistory) != 0 {
+		t.Errorf("rejected uniform splits were recorded: count %d, history %d", st.RebaseCount(), len(st.RebaseHistory))
+	}
+}
+
+func TestUniformSplitInBatchAndPassthrough(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 1)
+	ow := NewOndoWrappedStock(st)
+
+	// A uniform split in a batch is undone with the rest of the batch
+	err := st.BatchRebase([]RebaseAction{UniformSplitAction{AmountPerHolder: tokens(1)}, StockSplit{big.NewInt(0), big.NewInt(1)}})
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidAmount)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	if st.TotalSupply().Cmp(tokens(11)) != 0 || st.RebaseCount() != 0 {
+		t.Errorf("failed batch left supply %s and %d rebases", st.TotalSupply(), st.RebaseCount())
+	}
+
+	if err := ow.RebasePassthrough(st, UniformSplitAction{AmountPerHolder: tokens(1)}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xBOB", tokens(2))
+	checkSane(t, st)
+}
+
+func TestRebaseSpinOff(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 3)
+	var events []SpinoffEvent
+	st.RegisterSpinoffHook(func(event SpinoffEvent) { events = append(events, event) })
+	var seen []RebaseAction
+	st.OnRebase = func(_ *StockToken, action RebaseAction) { seen = append(seen, action) }
+	published := make(chan RebaseEvent, 1)
+	st.SubscribeToRebase(published)
+
+	child, err := st.RebaseSpinOff(SpinOffTerms{ChildTicker: "SPIN", ChildName: "Spin Co", Ratio: big.NewRat(1, 2), InitialPrice: "$12.50"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// It is recorded and published like any other rebase
+	if st.RebaseCount() != 1 || len(st.RebaseHistory) != 1 || st.RebaseHistory[0].ActionType != "spinoff" {
+		t.Errorf("RebaseCount = %d, history = %v, want one spinoff", st.RebaseCount(), st.RebaseHistory)
+	}
+	if len(seen) != 1 {
+		t.Errorf("OnRebase saw %v, want one spinoff", seen)
+	} else if action, ok := seen[0].(SpinOffAction); !ok || action.Child != child {
+		t.Errorf("OnRebase saw %v, want the spinoff into SPIN", seen[0])
+	}
+	select {
+	case event := <-published:
+		if event.ActionType != "spinoff" {
+			t.Errorf("published %q, want spinoff", event.ActionType)
+		}
+	default:
+		t.Error("the spinoff was not published to subscribers")
+	}
+	checkBalance(t, child, "0xALICE", tokens(5))
+	checkBalance(t, child, "0xBOB", new(big.Int).Div(tokens(3), big.NewInt(2)))
+	checkSane(t, child)
+	if child.SharePrice().Cmp(big.NewInt(1250)) != 0 || child.owner != "0xOWNER" || child.Decimals != st.Decimals {
+		t.Errorf("child priced at %s cents, owned by %s with %d decimals", child.SharePrice(), child.owner, child.Decimals)
+	}
+	if len(events) != 1 || events[0].Child != "SPIN" {
+		t.Errorf("spinoff events = %v, want one for SPIN", events)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+
+	if _, err := st.RebaseSpinOff(SpinOffTerms{ChildTicker: "BAD", Ratio: big.NewRat(1, 2), InitialPrice: "free"}); err == nil {
+		t.Error("RebaseSpinOff accepted an invalid price")
+	}
+	if _, err := st.RebaseSpinOff(SpinOffTerms{ChildTicker: "BAD", InitialPrice: "$1.00"}); err == nil {
+		t.Error("RebaseSpinOff accepted a nil ratio")
+	}
+	if st.RebaseCount() != 1 {
+		t.Errorf("rejected spinoffs were counted, RebaseCount = %d", st.RebaseCount())
+	}
+}
+
+func TestSpinOffActionRollsBack(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	child, err := NewStockToken("SPIN", "Spin Co", st.Decimals, "$5.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child.maxSupply = tokens(2)
+
+	// Ten child shares are due, over the cap, so neither token changes
+	if err := st.Rebase(SpinOffAction{Child: child, Ratio: big.NewRat(1, 1)}); !errors.Is(err, ErrSupplyCap) {
+		t.Fatalf("spinoff over the child's cap: %v, want ErrSupplyCap", err)
+	}
+	if child.TotalSupply().Sign() != 0 || st.RebaseCount() != 0 || len(st.RebaseHistory) != 0 {
+		t.Errorf("failed spinoff left child supply %s and parent count %d", child.TotalSupply(), st.RebaseCount())
+	}
+	checkSane(t, child)
+
+	if err := st.BatchRebase([]RebaseAction{doubleSplit, SpinOffAction{Child: child, Ratio: big.NewRat(1, 10)}}); err == nil {
+		t.Error("BatchRebase accepted a spinoff")
+	}
+	if err := st.Rebase(SpinOffAction{Child: child, Ratio: big.NewRat(1, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, child, "0xALICE", tokens(1))
+	checkSane(t, st)
+	checkSane(t, child)
+}
+
+func TestRightsOffering(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 4)
+
+	// One right per two shares held, at $80
+	if err := st.IssueRights(big.NewInt(8000), big.NewRat(1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.RightsBalance["0xALICE"]; got.Cmp(tokens(5)) != 0 {
+		t.Errorf("0xALICE rights = %s, want %s", got, tokens(5))
+	}
+	if err := st.IssueRights(big.NewInt(8000), big.NewRat(1, 2)); err == nil {
+		t.Error("a second offering was issued while one is outstanding")
+	}
+
+	if err := st.ExerciseRights("0xALICE", tokens(3)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(13))
+	entries := st.Filter("rights_exercised", time.Time{})
+	if len(entries) != 1 || entries[0].Fields["address"] != "0xALICE" || entries[0].Fields["price"] != "8000" || entries[0].Fields["cost"] != "24000" {
+		t.Errorf("rights_exercised entries = %v, want 0xALICE paying 24000 cents at 8000", entries)
+	}
+	if st.TotalSupply().Cmp(tokens(17)) != 0 {
+		t.Errorf("total supply = %s, want %s", st.TotalSupply(), tokens(17))
+	}
+	checkSane(t, st)
+	if err := st.ExerciseRights("0xALICE", tokens(3)); err == nil {
+		t.Error("exercised more rights than remain")
+	}
+
+	st.ExpireRights()
+	if err := st.ExerciseRights("0xBOB", tokens(1)); err == nil {
+		t.Error("exercised rights after they expired")
+	}
+}
+
+func TestSpinoffDust(t *testing.T) {
+	parent := newTestToken(t)
+	for address, amount := range map[string]string{"0xALICE": "10.000004", "0xBOB": "3.000003", "0xCAROL": "0.000002"} {
+		if err := parent.MintFractional(address, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	child := newTestToken(t)
+	var events []SpinoffEvent
+	child.RegisterSpinoffHook(func(event SpinoffEvent) { events = append(events, event) })
+
+	// One child share for every five parent shares
+	if err := Spinoff(parent, child, big.NewRat(1, 5)); err != nil {
+		t.Fatal(err)
+	}
+	allocations := map[string]*big.Int{"0xALICE": big.NewInt(2_000_000), "0xBOB": big.NewInt(600_000)}
+	sum := big.NewInt(0)
+	for address, want := range allocations {
+		checkBalance(t, child, address, want)
+		sum.Add(sum, want)
+	}
+	// The remainders 4/5, 3/5 and 2/5 of a raw unit add up to one more
+	checkBalance(t, child, DustAddress, big.NewInt(1))
+	checkHolders(t, child.SortedHolders(), child.balances, "0xALICE", "0xBOB", DustAddress)
+	if want := new(big.Int).Add(sum, big.NewInt(1)); child.TotalSupply().Cmp(want) != 0 {
+		t.Errorf("child supply = %s, want %s", child.TotalSupply(), want)
+	}
+	if len(events) != 1 || events[0].Distributed.Cmp(sum) != 0 || events[0].Dust.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("spinoff events = %+v, want one distributing %s with 1 dust", events, sum)
+	}
+	if parent.TotalSupply().Cmp(big.NewInt(13_000_009)) != 0 {
+		t.Errorf("parent supply changed to %s", parent.TotalSupply())
+	}
+	checkSane(t, child)
+
+	if err := Spinoff(parent, child, big.NewRat(1, 5)); !errors.Is(err, ErrNonEmptyChild) {
+		t.Errorf("second spinoff into the same child: err = %v, want %v", err, ErrNonEmptyChild)
+	}
+}
+
+func TestDilution(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 30)
+	mustMint(t, st, "0xBOB", 10)
+	if err := st.Rebase(DilutionAction{NewSharesIssued: tokens(10)}); err == nil {
+		t.Error("dilution without a treasury address succeeded")
+	}
+	if err := st.SetTreasuryAddress("0xTREASURY"); err != nil {
+		t.Fatal(err)
+	}
+
+	share := func(address string) *big.Rat {
+		return new(big.Rat).SetFrac(st.BalanceOf(address), st.TotalSupply())
+	}
+	before := map[string]*big.Rat{"0xALICE": share("0xALICE"), "0xBOB": share("0xBOB")}
+	if err := st.Rebase(DilutionAction{NewSharesIssued: tokens(10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.TotalSupply().Cmp(tokens(50)) != 0 {
+		t.Errorf("total supply = %s, want %s", st.TotalSupply(), tokens(50))
+	}
+	checkBalance(t, st, "0xTREASURY", tokens(10))
+	// Each holder keeps their tokens and their share shrinks by 40/50
+	for address, was := range before {
+		want := new(big.Rat).Mul(was, big.NewRat(4, 5))
+		if got := share(address); got.Cmp(want) != 0 {
+			t.Errorf("%s share = %s, want %s", address, got.RatString(), want.RatString())
+		}
+	}
+	checkBalance(t, st, "0xALICE", tokens(30))
+	checkSane(t, st)
+
+	for _, issued := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		if err := st.Rebase(DilutionAction{NewSharesIssued: issued}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("dilution issuing %v: err = %v, want %v", issued, err, ErrInvalidAmount)
+		}
+	}
+}
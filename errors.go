@@ -0,0 +1,69 @@
+package main
+
+import "errors"
+
+var (
+	// ErrInvalidAmount is returned when an amount argument is nil, zero or negative
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrInsufficientBalance is returned when an address holds less than an operation needs
+	ErrInsufficientBalance = errors.New("insufficient balance")
+
+	// ErrNotContractAddress is returned when an operation requires a 0xCONTRACT address
+	ErrNotContractAddress = errors.New("not a contract address")
+
+	// ErrAllowanceExceeded is returned when a spender transfers more than it was approved for
+	ErrAllowanceExceeded = errors.New("allowance exceeded")
+
+	// ErrFloorPriceBreached is returned when trading while the share price is below the floor price
+	ErrFloorPriceBreached = errors.New("share price is below the floor price")
+
+	// ErrDuplicateAction is returned when a rebase action id has already been applied
+	ErrDuplicateAction = errors.New("rebase action already applied")
+
+	// ErrWarrantExpired is returned when exercising a warrant past its expiry or a second time
+	ErrWarrantExpired = errors.New("warrant expired")
+
+	// ErrTransferRestricted is returned when transferring out of an address that is still locked up
+	ErrTransferRestricted = errors.New("transfer restricted")
+
+	// ErrZeroPrice is returned when a calculation needs a share price that is zero
+	ErrZeroPrice = errors.New("share price is zero")
+
+	// ErrCannotRescueUnderlying is returned when trying to rescue the wrapper's own collateral
+	ErrCannotRescueUnderlying = errors.New("cannot rescue the wrapper's underlying token")
+
+	// ErrStalePrice is returned when an external price is older than the configured max age or
+	// than the last price recorded
+	ErrStalePrice = errors.New("stale price")
+
+	// ErrTokenPaused is returned when moving tokens while the StockToken is paused
+	ErrTokenPaused = errors.New("token is paused")
+
+	// ErrNonEmptyChild is returned when spinning off into a token that already has a supply
+	ErrNonEmptyChild = errors.New("spinoff child token already has a supply")
+
+	// ErrSlippageExceeded is returned when a wrap or unwrap would pay out less than minOut
+	ErrSlippageExceeded = errors.New("slippage exceeded")
+
+	// ErrInvalidAddress is returned when an address is not a 0x-prefixed 160-bit hex address
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrBalanceLocked is returned when transferring tokens that have not vested yet
+	ErrBalanceLocked = errors.New("balance is locked until it vests")
+
+	// ErrSupplyCap is returned when an operation would take the supply above MaxSupply
+	ErrSupplyCap = errors.New("supply cap exceeded")
+
+	// ErrIndexOutOfRange is returned when looking up a rebase history entry that does not exist
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	// ErrNoCap is returned when asking for the mint headroom of a token without a MaxSupply
+	ErrNoCap = errors.New("no supply cap set")
+
+	// ErrTokenMismatch is returned when merging tokens whose tickers or precisions differ
+	ErrTokenMismatch = errors.New("token mismatch")
+
+	// ErrInsufficientHistory is returned when fewer prices have been recorded than asked for
+	ErrInsufficientHistory = errors.New("insufficient price history")
+)
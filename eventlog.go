@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxLogEntries is the number of entries a new token's event log keeps
+const defaultMaxLogEntries = 10_000
+
+// LogEntry is one state change recorded in an EventLog. Topic is the transfer event kind
+// ("mint", "transfer", ...) or "price_update", "merger" or "spinoff". Fields holds the event's
+// values as strings, keyed by names such as "from", "to" and "amount".
+type LogEntry struct {
+	Index     uint64
+	BlockTime time.Time
+	Topic     string
+	Fields    map[string]string
+}
+
+// EventLog stores the state changes of a token for later queries. It has its own lock, so it
+// can be queried while the token is in use.
+type EventLog struct {
+	mu         sync.RWMutex
+	entries    []LogEntry
+	nextIndex  uint64
+	maxEntries int // 0 means unbounded
+}
+
+// newEventLog returns an empty log that keeps the newest defaultMaxLogEntries entries
+func newEventLog() *EventLog {
+	return &EventLog{maxEntries: defaultMaxLogEntries}
+}
+
+// append records an entry, trimming the oldest entries beyond the maximum
+func (l *EventLog) append(topic string, blockTime time.Time, fields map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextIndex++
+	l.entries = append(l.entries, LogEntry{
+		Index:     l.nextIndex,
+		BlockTime: blockTime,
+		Topic:     topic,
+		Fields:    fields,
+	})
+	l.trim()
+}
+
+// trim drops the oldest entries beyond maxEntries. The caller must hold l.mu.
+func (l *EventLog) trim() {
+	if l.maxEntries > 0 && len(l.entries) > l.maxEntries {
+		l.entries = append([]LogEntry(nil), l.entries[len(l.entries)-l.maxEntries:]...)
+	}
+}
+
+// SetMaxEntries keeps only the newest n entries, dropping older ones now and as new entries
+// arrive. Zero or a negative n removes the limit.
+func (l *EventLog) SetMaxEntries(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxEntries = max(n, 0)
+	l.trim()
+}
+
+// Filter returns the entries with topic recorded at or after since, oldest first. An empty
+// topic matches every entry.
+func (l *EventLog) Filter(topic string, since time.Time) []LogEntry {
+	return l.filter(func(entry LogEntry) bool {
+		return (topic == "" || entry.Topic == topic) && !entry.BlockTime.Before(since)
+	})
+}
+
+// FilterByAddress returns the entries that moved tokens from or to address, oldest first
+func (l *EventLog) FilterByAddress(address string) []LogEntry {
+	return l.filter(func(entry LogEntry) bool {
+		return entry.Fields["from"] == address || entry.Fields["to"] == address
+	})
+}
+
+// filter returns copies of the entries that match
+func (l *EventLog) filter(match func(entry LogEntry) bool) []LogEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var result []LogEntry
+	for _, entry := range l.entries {
+		if match(entry) {
+			result = append(result, entry.copy())
+		}
+	}
+	return result
+}
+
+// clone returns an independent copy of the log
+func (l *EventLog) clone() *EventLog {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	c := &EventLog{nextIndex: l.nextIndex, maxEntries: l.maxEntries}
+	for _, entry := range l.entries {
+		c.entries = append(c.entries, entry.copy())
+	}
+	return c
+}
+
+// copy returns the entry with its own Fields map
+func (e LogEntry) copy() LogEntry {
+	fields := make(map[string]string, len(e.Fields))
+	for key, value := range e.Fields {
+		fields[key] = value
+	}
+	e.Fields = fields
+	return e
+}
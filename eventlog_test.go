@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventLogFilter(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 1000)
+	since := time.Now()
+
+	transfers := 0
+	for i := 0; i < 100; i++ {
+		switch i % 3 {
+		case 0:
+			mustMint(t, st, "0xBOB", 1)
+		case 1:
+			if err := st.Interact("0xALICE", "0xCAROL", tokens(1), nil); err != nil {
+				t.Fatal(err)
+			}
+			transfers++
+		case 2:
+			if err := st.Burn("0xALICE", tokens(1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	got := st.Filter("transfer", since)
+	if len(got) != transfers {
+		t.Fatalf("Filter(transfer) returned %d entries, want %d", len(got), transfers)
+	}
+	for _, entry := range got {
+		if entry.Topic != "transfer" || entry.Fields["from"] != "0xALICE" || entry.Fields["to"] != "0xCAROL" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	}
+	if got := st.Filter("mint", time.Time{}); len(got) != 35 {
+		t.Errorf("Filter(mint) returned %d entries, want 35", len(got))
+	}
+	if got := st.FilterByAddress("0xCAROL"); len(got) != transfers {
+		t.Errorf("FilterByAddress returned %d entries, want %d", len(got), transfers)
+	}
+}
+
+func TestEventLogSetMaxEntries(t *testing.T) {
+	st := newTestToken(t)
+	for i := 0; i < 20; i++ {
+		mustMint(t, st, "0xALICE", 1)
+	}
+	st.SetMaxEntries(10)
+	entries := st.Filter("", time.Time{})
+	if len(entries) != 10 {
+		t.Fatalf("log has %d entries, want 10", len(entries))
+	}
+	if entries[0].Index != 11 || entries[9].Index != 20 {
+		t.Errorf("kept entries %d to %d, want 11 to 20", entries[0].Index, entries[9].Index)
+	}
+
+	mustMint(t, st, "0xALICE", 1)
+	entries = st.Filter("", time.Time{})
+	if len(entries) != 10 || entries[9].Index != 21 {
+		t.Errorf("after another mint the log has %d entries ending at %d, want 10 ending at 21", len(entries), entries[len(entries)-1].Index)
+	}
+}
+
+func TestEventLogBoundedByDefault(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	data, err := st.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadStockToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, log := range map[string]*EventLog{"token": st.EventLog, "wrapper": ow.EventLog, "loaded": loaded.EventLog} {
+		if log.maxEntries != defaultMaxLogEntries {
+			t.Errorf("%s log keeps %d entries, want %d", name, log.maxEntries, defaultMaxLogEntries)
+		}
+	}
+
+	log := newEventLog()
+	for i := 0; i < defaultMaxLogEntries+5; i++ {
+		log.append("mint", time.Time{}, nil)
+	}
+	if got := len(log.Filter("", time.Time{})); got != defaultMaxLogEntries {
+		t.Errorf("log grew to %d entries, want %d", got, defaultMaxLogEntries)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// RebaseEvent describes a completed rebase
+type RebaseEvent struct {
+	ActionType      string
+	Timestamp       time.Time
+	PreTotalSupply  *big.Int
+	PostTotalSupply *big.Int
+
+	// BalanceDiff is each address's balance change, as returned by BalanceDiff. It is shared
+	// with RebaseHistory and other subscribers and must not be modified.
+	BalanceDiff map[string]*big.Int
+
+	// Actions lists the type of every action applied by a "batch_rebase", in order. It is
+	// nil for other rebases.
+	Actions []string
+
+	// DividendYield is the cash amount over the share price of the dividends paid, compounded
+	// when there are several, e.g. 3/200 for a $1.50 dividend on a $100 share. It is nil for
+	// rebases that pay no dividend.
+	DividendYield *big.Rat
+}
+
+// GetRebaseByIndex returns the i-th entry of RebaseHistory, counting from zero for the oldest,
+// or ErrIndexOutOfRange if there is no such entry
+func (t *StockToken) GetRebaseByIndex(i int) (RebaseEvent, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if i < 0 || i >= len(t.RebaseHistory) {
+		return RebaseEvent{}, fmt.Errorf("%w: rebase %d of %d", ErrIndexOutOfRange, i, len(t.RebaseHistory))
+	}
+	return t.RebaseHistory[i], nil
+}
+
+// GetLastNRebases returns the newest n entries of RebaseHistory, oldest first, or
+// ErrIndexOutOfRange if n is negative or more than the history holds
+func (t *StockToken) GetLastNRebases(n int) ([]RebaseEvent, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if n < 0 || n > len(t.RebaseHistory) {
+		return nil, fmt.Errorf("%w: last %d of %d rebases", ErrIndexOutOfRange, n, len(t.RebaseHistory))
+	}
+	return slices.Clone(t.RebaseHistory[len(t.RebaseHistory)-n:]), nil
+}
+
+// ApplyBalanceDiffs rebuilds a balance map by adding the BalanceDiff of every event in history,
+// in order, to a copy of initial. Balances that reach zero are dropped. It fails if an event
+// would take a balance negative, which means history does not follow from initial.
+//
+// The rebase actions are not re-run: the result is what the ledger recorded, not a check of
+// the rebase arithmetic, so it rebuilds the balances at any point in the history from a known
+// starting state. Staked balances are not part of the diffs and are left out.
+func ApplyBalanceDiffs(initial map[string]*big.Int, history []RebaseEvent) (map[string]*big.Int, error) {
+	balances := copyAmounts(initial)
+	for i, event := range history {
+		for _, address := range sortedAddresses(event.BalanceDiff) {
+			balance := balances[address]
+			if balance == nil {
+				balance = big.NewInt(0)
+			}
+			balance = new(big.Int).Add(balance, event.BalanceDiff[address])
+			switch balance.Sign() {
+			case -1:
+				return nil, fmt.Errorf("%w: %s event %d leaves %s with %s", ErrInsufficientBalance, event.ActionType, i, address, balance)
+			case 0:
+				delete(balances, address)
+			default:
+				balances[address] = balance
+			}
+		}
+	}
+	return balances, nil
+}
+
+// SubscribeToRebase registers ch to receive a RebaseEvent after every rebase.
+// Sends never block: if ch is full the event is dropped for that subscriber.
+func (t *StockToken) SubscribeToRebase(ch chan<- RebaseEvent) (subscriptionID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rebaseSubscribers == nil {
+		t.rebaseSubscribers = make(map[int]chan<- RebaseEvent)
+	}
+
+	t.nextSubscriptionID++
+	t.rebaseSubscribers[t.nextSubscriptionID] = ch
+	return t.nextSubscriptionID
+}
+
+// UnsubscribeFromRebase stops delivering rebase events to the given subscription
+func (t *StockToken) UnsubscribeFromRebase(id int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.rebaseSubscribers[id]; !ok {
+		return fmt.Errorf("no rebase subscription with id %d", id)
+	}
+	delete(t.rebaseSubscribers, id)
+	return nil
+}
+
+// publishRebase sends the same event to every subscriber without blocking. The subscribers
+// are copied under the read lock and sent to after it is released.
+func (t *StockToken) publishRebase(event RebaseEvent) {
+	t.mu.RLock()
+	subscribers := make([]chan<- RebaseEvent, 0, len(t.rebaseSubscribers))
+	for _, ch := range t.rebaseSubscribers {
+		subscribers = append(subscribers, ch)
+	}
+	t.mu.RUnlock()
+
+	for _, ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// rebaseActionType names an action passed to Rebase
+func rebaseActionType(action RebaseAction) string {
+	switch action.(type) {
+	case StockSplit:
+		return "split"
+	case Dividend:
+		return "dividend"
+	case CompoundDividend:
+		return "compound_dividend"
+	case CappedDividend:
+		return "capped_dividend"
+	case DividendWithRecord:
+		return "dividend_with_record"
+	case ReturnOfCapital:
+		return "return_of_capital"
+	case StockMerger:
+		return "merger"
+	case DilutionAction:
+		return "dilution"
+	case UniformSplitAction:
+		return "uniform_split"
+	case SpinOffAction:
+		return "spinoff"
+	default:
+		return fmt.Sprintf("%T", action)
+	}
+}
+
+// dividendYield returns the compounded yield of the dividends actions pay, or nil if none of
+// them is a dividend
+func dividendYield(actions ...RebaseAction) *big.Rat {
+	var dividends []Dividend
+	for _, action := range actions {
+		switch v := action.(type) {
+		case Dividend:
+			dividends = append(dividends, v)
+		case CappedDividend:
+			dividends = append(dividends, v.Dividend)
+		case DividendWithRecord:
+			dividends = append(dividends, v.Dividend)
+		case CompoundDividend:
+			dividends = append(dividends, v.Dividends...)
+		}
+	}
+	if len(dividends) == 0 {
+		return nil
+	}
+
+	growth := big.NewRat(1, 1)
+	for _, d := range dividends {
+		yield := new(big.Rat).SetFrac(d.cashAmount, d.sharePrice)
+		growth.Mul(growth, yield.Add(yield, big.NewRat(1, 1)))
+	}
+	return growth.Sub(growth, big.NewRat(1, 1))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// newHistoryToken returns a token with a five-entry rebase history: 0xALICE starts with 1 token
+// and each rebase doubles it
+func newHistoryToken(tb testing.TB) *StockToken {
+	tb.Helper()
+	st := newTestToken(tb)
+	mustMint(tb, st, "0xALICE", 1)
+	for i := 0; i < 5; i++ {
+		if err := st.Rebase(doubleSplit); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return st
+}
+
+func TestGetRebaseByIndex(t *testing.T) {
+	st := newHistoryToken(t)
+	for i := 0; i < 5; i++ {
+		event, err := st.GetRebaseByIndex(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tokens(int64(1) << i); event.PreTotalSupply.Cmp(want) != 0 {
+			t.Errorf("rebase %d started from %s, want %s", i, event.PreTotalSupply, want)
+		}
+		if want := tokens(int64(1) << (i + 1)); event.PostTotalSupply.Cmp(want) != 0 {
+			t.Errorf("rebase %d ended at %s, want %s", i, event.PostTotalSupply, want)
+		}
+	}
+	for _, i := range []int{-1, 5} {
+		if _, err := st.GetRebaseByIndex(i); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("GetRebaseByIndex(%d): err = %v, want ErrIndexOutOfRange", i, err)
+		}
+	}
+}
+
+func TestGetLastNRebases(t *testing.T) {
+	st := newHistoryToken(t)
+	last, err := st.GetLastNRebases(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 3 {
+		t.Fatalf("GetLastNRebases(3) returned %d entries", len(last))
+	}
+	for i, event := range last {
+		if want := tokens(int64(1) << (i + 3)); event.PostTotalSupply.Cmp(want) != 0 {
+			t.Errorf("entry %d ended at %s, want %s", i, event.PostTotalSupply, want)
+		}
+	}
+
+	if all, err := st.GetLastNRebases(5); err != nil || len(all) != 5 {
+		t.Errorf("GetLastNRebases(5) = %d entries, %v, want all 5", len(all), err)
+	}
+	if none, err := st.GetLastNRebases(0); err != nil || len(none) != 0 {
+		t.Errorf("GetLastNRebases(0) = %d entries, %v, want none", len(none), err)
+	}
+	for _, n := range []int{-1, 6} {
+		if _, err := st.GetLastNRebases(n); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("GetLastNRebases(%d): err = %v, want ErrIndexOutOfRange", n, err)
+		}
+	}
+}
+
+func TestApplyBalanceDiffs(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 3)
+	mustMint(t, st, "0xBOB", 7)
+	initial := st.SnapshotBalances()
+
+	actions := []RebaseAction{
+		doubleSplit,
+		Dividend{cashAmount: big.NewInt(333), sharePrice: big.NewInt(10000)},
+		StockSplit{Numerator: big.NewInt(2), Denominator: big.NewInt(3)},
+	}
+	var afterSplit map[string]*big.Int
+	for i, action := range actions {
+		if err := st.Rebase(action); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			afterSplit = st.SnapshotBalances()
+		}
+	}
+
+	// Any prefix of the history rebuilds the balances at that point
+	rebuilt, err := ApplyBalanceDiffs(initial, st.RebaseHistory[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := balanceDiff(rebuilt, afterSplit); len(diff) != 0 {
+		t.Errorf("balances rebuilt after the split differ by %v", diff)
+	}
+	rebuilt, err = ApplyBalanceDiffs(initial, st.RebaseHistory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := balanceDiff(rebuilt, st.SnapshotBalances()); len(diff) != 0 {
+		t.Errorf("rebuilt balances differ from the ledger by %v", diff)
+	}
+	if initial["0xALICE"].Cmp(tokens(3)) != 0 {
+		t.Errorf("ApplyBalanceDiffs modified the initial balances")
+	}
+}
+
+func TestApplyBalanceDiffsRejectsNegativeBalance(t *testing.T) {
+	history := []RebaseEvent{{
+		ActionType:  "split",
+		BalanceDiff: map[string]*big.Int{"0xALICE": big.NewInt(-2)},
+	}}
+	if _, err := ApplyBalanceDiffs(map[string]*big.Int{"0xALICE": big.NewInt(1)}, history); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("err = %v, want ErrInsufficientBalance", err)
+	}
+
+	rebuilt, err := ApplyBalanceDiffs(map[string]*big.Int{"0xALICE": big.NewInt(2)}, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rebuilt["0xALICE"]; ok {
+		t.Error("ApplyBalanceDiffs kept a zero balance")
+	}
+}
+
+func TestSubscribeToRebaseTwoListeners(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	first := make(chan RebaseEvent, 1)
+	second := make(chan RebaseEvent, 1)
+	st.SubscribeToRebase(first)
+	id := st.SubscribeToRebase(second)
+
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	a, b := <-first, <-second
+	if a.ActionType != "split" || a.PreTotalSupply.Cmp(tokens(10)) != 0 || a.PostTotalSupply.Cmp(tokens(20)) != 0 {
+		t.Errorf("first subscriber received %+v", a)
+	}
+	if a.ActionType != b.ActionType || !a.Timestamp.Equal(b.Timestamp) || a.PostTotalSupply.Cmp(b.PostTotalSupply) != 0 {
+		t.Errorf("subscribers received different events: %+v and %+v", a, b)
+	}
+
+	// A full channel drops the event instead of blocking, and an unsubscribed one gets nothing
+	if err := st.UnsubscribeFromRebase(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || len(second) != 0 {
+		t.Errorf("queued events = %d and %d, want 1 and 0", len(first), len(second))
+	}
+	if err := st.UnsubscribeFromRebase(id); err == nil {
+		t.Error("unsubscribed twice from the same subscription")
+	}
+}
+
+func TestRebaseHistoryGrows(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	for i, test := range []struct {
+		action   RebaseAction
+		wantType string
+	}{
+		{doubleSplit, "split"},
+		{Dividend{cashAmount: big.NewInt(1000), sharePrice: big.NewInt(10000)}, "dividend"},
+		{ReturnOfCapital{AmountPerShareCents: big.NewInt(500)}, "return_of_capital"},
+		{StockSplit{Numerator: big.NewInt(1), Denominator: big.NewInt(4)}, "split"},
+	} {
+		pre := st.TotalSupply()
+		if err := st.Rebase(test.action); err != nil {
+			t.Fatal(err)
+		}
+		if len(st.RebaseHistory) != i+1 {
+			t.Fatalf("after rebase %d the history has %d entries", i+1, len(st.RebaseHistory))
+		}
+		event := st.RebaseHistory[i]
+		if event.ActionType != test.wantType {
+			t.Errorf("entry %d type = %q, want %q", i, event.ActionType, test.wantType)
+		}
+		if event.PreTotalSupply.Cmp(pre) != 0 || event.PostTotalSupply.Cmp(st.TotalSupply()) != 0 {
+			t.Errorf("entry %d supply %s -> %s, want %s -> %s", i, event.PreTotalSupply, event.PostTotalSupply, pre, st.TotalSupply())
+		}
+		if i > 0 && event.Timestamp.Before(st.RebaseHistory[i-1].Timestamp) {
+			t.Errorf("entry %d is timestamped before entry %d", i, i-1)
+		}
+	}
+
+	// A rejected rebase is not recorded
+	if err := st.Rebase(StockSplit{Numerator: big.NewInt(0), Denominator: big.NewInt(1)}); err == nil {
+		t.Fatal("zero split ratio accepted")
+	}
+	if len(st.RebaseHistory) != 4 {
+		t.Errorf("history has %d entries after a rejected rebase, want 4", len(st.RebaseHistory))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// centsPrecision formats cents as dollars with formatTokens
+var centsPrecision = big.NewInt(100)
+
+// ExportCSV writes every balance to w as CSV with the columns address, raw_balance,
+// formatted_balance, value_cents and value_usd. Rows are sorted by address, follow a header
+// row and end with a TOTAL row. The read lock is held while writing.
+func (t *StockToken) ExportCSV(w io.Writer) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"address", "raw_balance", "formatted_balance", "value_cents", "value_usd"}); err != nil {
+		return err
+	}
+
+	row := func(address string, balance *big.Int) []string {
+		value := new(big.Int).Mul(balance, t.sharePrice)
+		value.Div(value, t.Precision)
+		return []string{address, balance.String(), formatTokens(balance, t.Precision), value.String(), formatTokens(value, centsPrecision)}
+	}
+	total := big.NewInt(0)
+	for _, address := range t.holders {
+		balance := t.balances[address]
+		total.Add(total, balance)
+		if err := cw.Write(row(address, balance)); err != nil {
+			return err
+		}
+	}
+	if err := cw.Write(row("TOTAL", total)); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCSV writes every wrapped balance to w as CSV with the columns of StockToken.ExportCSV
+// plus exchange_rate and underlying_equivalent, the raw underlying the balance unwraps to.
+// Values use st's share price; st must be the token ow wraps. Both read locks are held
+// while writing.
+func (ow *OndoWrappedStock) ExportCSV(st *StockToken, w io.Writer) error {
+	if st == nil {
+		return errors.New("token is nil")
+	}
+	if ow.ticker != "ow"+st.ticker {
+		return fmt.Errorf("%s does not wrap %s", ow.ticker, st.ticker)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	cw := csv.NewWriter(w)
+	header := []string{"address", "raw_balance", "formatted_balance", "value_cents", "value_usd", "exchange_rate", "underlying_equivalent"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	rate := formatTokens(ow.exchangeRate, ow.Precision)
+	row := func(address string, balance *big.Int) []string {
+		underlying := new(big.Int).Mul(balance, ow.exchangeRate)
+		underlying.Div(underlying, ow.Precision)
+		value := new(big.Int).Mul(underlying, st.sharePrice)
+		value.Div(value, st.Precision)
+		return []string{address, balance.String(), formatTokens(balance, ow.Precision), value.String(), formatTokens(value, centsPrecision), rate, underlying.String()}
+	}
+	total := big.NewInt(0)
+	for _, address := range ow.holders {
+		balance := ow.balances[address]
+		total.Add(total, balance)
+		if err := cw.Write(row(address, balance)); err != nil {
+			return err
+		}
+	}
+	if err := cw.Write(row("TOTAL", total)); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+// readCSV parses buf and checks its header and that every row has as many fields
+func readCSV(t *testing.T, buf *bytes.Buffer, header []string) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || !slices.Equal(records[0], header) {
+		t.Fatalf("CSV header = %v, want %v", records[0], header)
+	}
+	for i, record := range records {
+		if len(record) != len(header) {
+			t.Errorf("row %d has %d fields, want %d", i, len(record), len(header))
+		}
+	}
+	return records[1:]
+}
+
+func TestExportCSV(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xCAROL", 1)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.MintFractional("0xBOB", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := st.ExportCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows := readCSV(t, &buf, []string{"address", "raw_balance", "formatted_balance", "value_cents", "value_usd"})
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 3 holders and a total", len(rows))
+	}
+
+	var addresses []string
+	sum := big.NewInt(0)
+	for _, row := range rows[:3] {
+		addresses = append(addresses, row[0])
+		raw, _ := new(big.Int).SetString(row[1], 10)
+		sum.Add(sum, raw)
+	}
+	if want := []string{"0xALICE", "0xBOB", "0xCAROL"}; !slices.Equal(addresses, want) {
+		t.Errorf("rows are for %v, want %v", addresses, want)
+	}
+	if sum.Cmp(st.TotalSupply()) != 0 {
+		t.Errorf("rows sum to %s, want the total supply %s", sum, st.TotalSupply())
+	}
+	if want := []string{"0xBOB", "2500000", "2.500000", "25000", "250.00"}; !slices.Equal(rows[1], want) {
+		t.Errorf("0xBOB row = %v, want %v", rows[1], want)
+	}
+	if total := rows[3]; total[0] != "TOTAL" || total[1] != st.TotalSupply().String() || total[3] != "135000" {
+		t.Errorf("total row = %v", total)
+	}
+}
+
+func TestWrappedExportCSV(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xBOB", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ow.ExportCSV(st, &buf); err != nil {
+		t.Fatal(err)
+	}
+	rows := readCSV(t, &buf, []string{"address", "raw_balance", "formatted_balance", "value_cents", "value_usd", "exchange_rate", "underlying_equivalent"})
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 2 holders and a total", len(rows))
+	}
+	// After the split each wrapped token unwraps to two underlying tokens at $50
+	if want := []string{"0xBOB", tokens(4).String(), "4.000000", "40000", "400.00", "2.000000", tokens(8).String()}; !slices.Equal(rows[1], want) {
+		t.Errorf("0xBOB row = %v, want %v", rows[1], want)
+	}
+	if total := rows[2]; total[0] != "TOTAL" || total[1] != ow.totalSupply.String() || total[6] != st.BalanceOf(ow.ticker).String() {
+		t.Errorf("total row = %v, want the wrapped supply and the custody", total)
+	}
+
+	other, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.ExportCSV(other, &buf); err == nil {
+		t.Error("ExportCSV accepted a token the wrapper does not wrap")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// bpsDenominator is the number of basis points in 100%
+const bpsDenominator = 10_000
+
+// ProportionalTransfer sweeps feeBps of every holder's balance to recipient.
+// Tokens are moved rather than destroyed, so totalSupply does not change.
+func (t *StockToken) ProportionalTransfer(feeBps uint, recipient string) error {
+	if feeBps > bpsDenominator {
+		return fmt.Errorf("%w: fee of %d bps exceeds 100%%", ErrInvalidAmount, feeBps)
+	}
+	if err := t.checkAddresses(recipient); err != nil {
+		return err
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isPaused {
+		return ErrTokenPaused
+	}
+	collected := big.NewInt(0)
+	// Iterate over a copy, since a 100% fee empties and removes balances
+	for _, address := range slices.Clone(t.holders) {
+		if address == recipient {
+			continue
+		}
+
+		fee := new(big.Int).Mul(t.balances[address], big.NewInt(int64(feeBps)))
+		fee.Div(fee, big.NewInt(bpsDenominator))
+		if fee.Sign() > 0 {
+			t.debit(address, fee)
+			collected.Add(collected, fee)
+			t.hooks.record("transfer", address, recipient, fee, t.now())
+		}
+	}
+
+	// Balances too small to owe a raw unit pay nothing, and a zero credit would list recipient
+	// as a holder
+	if collected.Sign() > 0 {
+		t.credit(recipient, collected)
+	}
+	return nil
+}
+
+// SetTransactionFee charges flatAmount plus percentageBps of the amount on every transfer.
+// The fee is paid by the sender on top of the amount and credited to FeeRecipient.
+func (t *StockToken) SetTransactionFee(flatAmount *big.Int, percentageBps uint) error {
+	if flatAmount == nil || flatAmount.Sign() < 0 {
+		return fmt.Errorf("%w: flat fee must be non-negative", ErrInvalidAmount)
+	}
+	if percentageBps > bpsDenominator {
+		return fmt.Errorf("%w: fee of %d bps exceeds 100%%", ErrInvalidAmount, percentageBps)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flatFee = new(big.Int).Set(flatAmount)
+	t.feeBps = percentageBps
+	return nil
+}
+
+// transactionFee returns flat + amount * feeBps / 10000
+func (t *StockToken) transactionFee(amount *big.Int) *big.Int {
+	fee := new(big.Int).Mul(amount, big.NewInt(int64(t.feeBps)))
+	fee.Div(fee, big.NewInt(bpsDenominator))
+	if t.flatFee != nil {
+		fee.Add(fee, t.flatFee)
+	}
+	return fee
+}
+
+// FeeSplit is one recipient's share of collected transfer fees
+type FeeSplit struct {
+	Recipient   string
+	BasisPoints uint
+}
+
+// SetFeeSplitter splits every transfer fee among several recipients instead of paying it all
+// to FeeRecipient. The basis points must add up to 10000. An empty slice removes the splitter.
+func (t *StockToken) SetFeeSplitter(splits []FeeSplit) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(splits) == 0 {
+		t.feeSplits = nil
+		return nil
+	}
+
+	var total uint
+	for _, split := range splits {
+		if split.Recipient == "" {
+			return errors.New("fee split recipient is empty")
+		}
+		total += split.BasisPoints
+	}
+	if total != bpsDenominator {
+		return fmt.Errorf("%w: fee splits total %d bps, want %d", ErrInvalidAmount, total, bpsDenominator)
+	}
+
+	t.feeSplits = append([]FeeSplit(nil), splits...)
+	return nil
+}
+
+// FeeSplitter returns the configured fee splits, or nil if fees go to FeeRecipient
+func (t *StockToken) FeeSplitter() []FeeSplit {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]FeeSplit(nil), t.feeSplits...)
+}
+
+// payFee credits a fee collected from payer to FeeRecipient, or across the fee splitter if one
+// is set. Rounding dust from the split goes to the last recipient so the whole fee is paid out.
+func (t *StockToken) payFee(payer string, fee *big.Int) {
+	if fee.Sign() == 0 {
+		return
+	}
+
+	if len(t.feeSplits) == 0 {
+		t.credit(t.FeeRecipient, fee)
+		t.hooks.record("transfer", payer, t.FeeRecipient, fee, t.now())
+		return
+	}
+
+	remaining := new(big.Int).Set(fee)
+	for i, split := range t.feeSplits {
+		share := new(big.Int).Set(remaining)
+		if i < len(t.feeSplits)-1 {
+			share.Mul(fee, big.NewInt(int64(split.BasisPoints)))
+			share.Div(share, big.NewInt(bpsDenominator))
+		}
+		remaining.Sub(remaining, share)
+		// A small fee can round a share down to nothing, which is neither credited nor reported
+		if share.Sign() == 0 {
+			continue
+		}
+		t.credit(split.Recipient, share)
+		t.hooks.record("transfer", payer, split.Recipient, share, t.now())
+	}
+}
+
+// credit adds amount to an address's balance without changing totalSupply
+func (t *StockToken) credit(address string, amount *big.Int) {
+	balance := t.balanceEntry(address)
+	balance.Add(balance, amount)
+}
+
+// SetWithholdingTaxBps withholds bps of every future dividend paid to address
+func (t *StockToken) SetWithholdingTaxBps(address string, bps uint) error {
+	if err := t.checkAddresses(address); err != nil {
+		return err
+	}
+	if bps > bpsDenominator {
+		return fmt.Errorf("%w: withholding of %d bps exceeds 100%%", ErrInvalidAmount, bps)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.withholdingTaxBps == nil {
+		t.withholdingTaxBps = make(map[string]uint)
+	}
+	t.withholdingTaxBps[address] = bps
+	return nil
+}
+
+// ClearWithholdingTax stops withholding dividends paid to address
+func (t *StockToken) ClearWithholdingTax(address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.withholdingTaxBps, address)
+}
+
+// TaxWithheldFor returns the total dividend shares withheld from address so far
+func (t *StockToken) TaxWithheldFor(address string) *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.TaxWithheld[address] == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(t.TaxWithheld[address])
+}
+
+// withholdTax removes the withheld portion of an address's dividend shares, records it in
+// TaxWithheld and returns the net shares to credit. Withheld shares are never minted.
+func (t *StockToken) withholdTax(address string, dividendShares *big.Int) *big.Int {
+	bps := t.withholdingTaxBps[address]
+	if bps == 0 {
+		return dividendShares
+	}
+
+	withheld := new(big.Int).Mul(dividendShares, big.NewInt(int64(bps)))
+	withheld.Div(withheld, big.NewInt(bpsDenominator))
+
+	if t.TaxWithheld == nil {
+		t.TaxWithheld = make(map[string]*big.Int)
+	}
+	if t.TaxWithheld[address] == nil {
+		t.TaxWithheld[address] = big.NewInt(0)
+	}
+	t.TaxWithheld[address].Add(t.TaxWithheld[address], withheld)
+
+	return new(big.Int).Sub(dividendShares, withheld)
+}
+
+// SetFee charges bps of the underlying on every wrap and unwrap and credits it to recipient's
+// balance in the underlying token. Zero bps removes the fee.
+func (ow *OndoWrappedStock) SetFee(bps uint64, recipient string) error {
+	if bps > bpsDenominator {
+		return fmt.Errorf("%w: fee of %d bps exceeds 100%%", ErrInvalidAmount, bps)
+	}
+	if bps > 0 && recipient == "" {
+		return errors.New("fee recipient is empty")
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	if recipient == "" && ow.TransferFeeBps > 0 {
+		return errors.New("transfer fee needs a fee recipient")
+	}
+	ow.FeeBasisPoints = bps
+	ow.FeeRecipient = recipient
+	return nil
+}
+
+// SetTransferFee deducts bps of every wrapped transfer from the amount received and pays it to
+// FeeRecipient in wrapped tokens. Set the recipient with SetFee first. Zero bps removes the fee.
+func (ow *OndoWrappedStock) SetTransferFee(bps uint64) error {
+	if bps > bpsDenominator {
+		return fmt.Errorf("%w: fee of %d bps exceeds 100%%", ErrInvalidAmount, bps)
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	if bps > 0 && ow.FeeRecipient == "" {
+		return errors.New("fee recipient is empty")
+	}
+	ow.TransferFeeBps = bps
+	return nil
+}
+
+// transferFee returns amount * TransferFeeBps / 10000. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) transferFee(amount *big.Int) *big.Int {
+	fee := new(big.Int).Mul(amount, new(big.Int).SetUint64(ow.TransferFeeBps))
+	return fee.Div(fee, big.NewInt(bpsDenominator))
+}
+
+// protocolFee returns amount * FeeBasisPoints / 10000. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) protocolFee(amount *big.Int) *big.Int {
+	fee := new(big.Int).Mul(amount, new(big.Int).SetUint64(ow.FeeBasisPoints))
+	return fee.Div(fee, big.NewInt(bpsDenominator))
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// newFeeWrapper returns a wrapper charging a 1% transfer fee to 0xFEES, with 0xALICE holding
+// 100 wrapped tokens
+func newFeeWrapper(tb testing.TB) *OndoWrappedStock {
+	tb.Helper()
+	st := newTestToken(tb)
+	ow := NewOndoWrappedStock(st)
+	mustMint(tb, st, "0xALICE", 100)
+	if err := ow.Wrap(st, "0xALICE", tokens(100), nil); err != nil {
+		tb.Fatal(err)
+	}
+	if err := ow.SetFee(0, "0xFEES"); err != nil {
+		tb.Fatal(err)
+	}
+	if err := ow.SetTransferFee(100); err != nil {
+		tb.Fatal(err)
+	}
+	return ow
+}
+
+func TestOndoBatchTransferFees(t *testing.T) {
+	ow := newFeeWrapper(t)
+	before := new(big.Int).Set(ow.balances["0xALICE"])
+
+	recipients := make(map[string]*big.Int)
+	for i := 0; i < 10; i++ {
+		recipients[fmt.Sprintf("0xR%02d", i)] = tokens(int64(i + 1))
+	}
+	if err := ow.BatchTransfer("0xALICE", recipients); err != nil {
+		t.Fatal(err)
+	}
+
+	debited := new(big.Int).Sub(before, ow.balances["0xALICE"])
+	received := new(big.Int).Set(ow.balances["0xFEES"])
+	for to, amount := range recipients {
+		want := new(big.Int).Sub(amount, new(big.Int).Div(amount, big.NewInt(100)))
+		if got := ow.balances[to]; got.Cmp(want) != 0 {
+			t.Errorf("%s received %s, want %s", to, got, want)
+		}
+		received.Add(received, ow.balances[to])
+	}
+	if debited.Cmp(tokens(55)) != 0 {
+		t.Errorf("debited %s, want %s", debited, tokens(55))
+	}
+	if received.Cmp(debited) != 0 {
+		t.Errorf("recipients and fees received %s, want the %s debited", received, debited)
+	}
+	if want := new(big.Int).Div(tokens(55), big.NewInt(100)); ow.balances["0xFEES"].Cmp(want) != 0 {
+		t.Errorf("fees = %s, want %s", ow.balances["0xFEES"], want)
+	}
+}
+
+func TestOndoTransferFee(t *testing.T) {
+	ow := newFeeWrapper(t)
+	if err := ow.Transfer("0xALICE", "0xBOB", tokens(10)); err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Mul(tokens(99), big.NewInt(10)); new(big.Int).Mul(ow.balances["0xBOB"], big.NewInt(100)).Cmp(want) != 0 {
+		t.Errorf("0xBOB received %s, want 9.9 tokens", ow.balances["0xBOB"])
+	}
+
+	if err := ow.SetTransferFee(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xCAROL", tokens(10)); err != nil {
+		t.Fatal(err)
+	}
+	if ow.balances["0xCAROL"].Cmp(tokens(10)) != 0 {
+		t.Errorf("0xCAROL received %s with no fee, want %s", ow.balances["0xCAROL"], tokens(10))
+	}
+}
+
+func TestSetTransferFeeNeedsRecipient(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	if err := ow.SetTransferFee(100); err == nil {
+		t.Error("SetTransferFee succeeded without a fee recipient")
+	}
+	if err := ow.SetFee(0, "0xFEES"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.SetTransferFee(bpsDenominator + 1); err == nil {
+		t.Error("SetTransferFee accepted a fee above 100%")
+	}
+	if err := ow.SetTransferFee(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.SetFee(0, ""); err == nil {
+		t.Error("SetFee cleared the recipient of an active transfer fee")
+	}
+}
+
+func TestOndoTransferFeePersists(t *testing.T) {
+	ow := newFeeWrapper(t)
+	data, err := ow.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadOndoWrappedStock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.TransferFeeBps != 100 || loaded.FeeRecipient != "0xFEES" {
+		t.Errorf("loaded transfer fee of %d bps to %q, want 100 bps to 0xFEES", loaded.TransferFeeBps, loaded.FeeRecipient)
+	}
+	if ow.Clone().TransferFeeBps != 100 {
+		t.Error("Clone dropped the transfer fee")
+	}
+}
+
+func TestProportionalTransfer(t *testing.T) {
+	st := newTestToken(t)
+	balances := map[string]int64{"0xALICE": 100, "0xBOB": 50, "0xCAROL": 7}
+	for address, n := range balances {
+		mustMint(t, st, address, uint64(n))
+	}
+	mustMint(t, st, "0xFEES", 1)
+	supply := st.TotalSupply()
+
+	if err := st.ProportionalTransfer(250, "0xFEES"); err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalSupply().Cmp(supply) != 0 {
+		t.Errorf("total supply changed from %s to %s", supply, st.TotalSupply())
+	}
+	collected := big.NewInt(0)
+	for address, n := range balances {
+		fee := new(big.Int).Div(new(big.Int).Mul(tokens(n), big.NewInt(250)), big.NewInt(bpsDenominator))
+		checkBalance(t, st, address, new(big.Int).Sub(tokens(n), fee))
+		collected.Add(collected, fee)
+	}
+	// The recipient does not pay a fee to itself
+	checkBalance(t, st, "0xFEES", collected.Add(collected, tokens(1)))
+	checkSane(t, st)
+
+	if err := st.ProportionalTransfer(bpsDenominator+1, "0xFEES"); err == nil {
+		t.Error("ProportionalTransfer accepted a fee above 100%")
+	}
+	if err := st.ProportionalTransfer(100, ""); err == nil {
+		t.Error("ProportionalTransfer accepted an empty recipient")
+	}
+}
+
+func TestProportionalTransferCollectingNothing(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.MintRaw("0xALICE", big.NewInt(99)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1% of 99 raw units rounds down to nothing, so the recipient is not added as a holder
+	if err := st.ProportionalTransfer(100, "0xFEES"); err != nil {
+		t.Fatal(err)
+	}
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE")
+	checkBalance(t, st, "0xALICE", big.NewInt(99))
+	checkSane(t, st)
+}
+
+func TestWithholdingTax(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	mustMint(t, st, "0xBOB", 100)
+	if err := st.SetWithholdingTaxBps("0xALICE", 1500); err != nil {
+		t.Fatal(err)
+	}
+
+	// A $1 dividend at $100 pays one share per hundred held
+	dividend := Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}
+	if err := st.Rebase(dividend); err != nil {
+		t.Fatal(err)
+	}
+	net := new(big.Int).Div(tokens(85), big.NewInt(100))
+	checkBalance(t, st, "0xALICE", new(big.Int).Add(tokens(100), net))
+	checkBalance(t, st, "0xBOB", tokens(101))
+	withheld := new(big.Int).Div(tokens(15), big.NewInt(100))
+	if got := st.TaxWithheldFor("0xALICE"); got.Cmp(withheld) != 0 {
+		t.Errorf("withheld = %s, want %s", got, withheld)
+	}
+	// Withheld shares are never minted
+	checkSane(t, st)
+
+	st.ClearWithholdingTax("0xALICE")
+	if err := st.Rebase(dividend); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.TaxWithheldFor("0xALICE"); got.Cmp(withheld) != 0 {
+		t.Errorf("withheld after clearing = %s, want %s", got, withheld)
+	}
+	if err := st.SetWithholdingTaxBps("0xALICE", bpsDenominator+1); err == nil {
+		t.Error("SetWithholdingTaxBps accepted more than 100%")
+	}
+}
+
+func TestTransactionFee(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 200)
+	st.FeeRecipient = "0xFEES"
+	// 0.5 tokens flat plus 1%
+	flat := new(big.Int).Div(tokens(1), big.NewInt(2))
+	if err := st.SetTransactionFee(flat, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Interact("0xALICE", "0xBOB", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+	fee := new(big.Int).Add(flat, tokens(1))
+	checkBalance(t, st, "0xBOB", tokens(100))
+	checkBalance(t, st, "0xFEES", fee)
+	checkBalance(t, st, "0xALICE", new(big.Int).Sub(tokens(100), fee))
+	checkSane(t, st)
+
+	// The sender must cover the amount plus the fee
+	before := st.BalanceOf("0xALICE")
+	if err := st.Interact("0xALICE", "0xBOB", before, nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("transfer without room for the fee: err = %v, want ErrInsufficientBalance", err)
+	}
+	checkBalance(t, st, "0xALICE", before)
+
+	if err := st.SetTransactionFee(big.NewInt(-1), 0); err == nil {
+		t.Error("SetTransactionFee accepted a negative flat fee")
+	}
+	if err := st.SetTransactionFee(big.NewInt(0), bpsDenominator+1); err == nil {
+		t.Error("SetTransactionFee accepted more than 100%")
+	}
+}
+
+func TestFeeSplitter(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 200)
+	splits := []FeeSplit{{"0xTREASURY", 5000}, {"0xBURN", 3000}, {"0xDEV", 2000}}
+	if err := st.SetFeeSplitter(splits); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetTransactionFee(big.NewInt(0), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Interact("0xALICE", "0xBOB", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+	hundredth := new(big.Int).Div(tokens(1), big.NewInt(100))
+	for _, split := range []struct {
+		address    string
+		hundredths int64
+	}{{"0xTREASURY", 50}, {"0xBURN", 30}, {"0xDEV", 20}} {
+		checkBalance(t, st, split.address, new(big.Int).Mul(hundredth, big.NewInt(split.hundredths)))
+	}
+	checkBalance(t, st, "0xBOB", tokens(100))
+	checkSane(t, st)
+	if got := st.FeeSplitter(); len(got) != 3 || got[0] != splits[0] {
+		t.Errorf("FeeSplitter = %v, want %v", got, splits)
+	}
+
+	if err := st.SetFeeSplitter([]FeeSplit{{"0xTREASURY", 5000}, {"0xDEV", 4000}}); err == nil {
+		t.Error("SetFeeSplitter accepted splits totalling 90%")
+	}
+	if err := st.SetFeeSplitter([]FeeSplit{{"", bpsDenominator}}); err == nil {
+		t.Error("SetFeeSplitter accepted an empty recipient")
+	}
+	if err := st.SetFeeSplitter(nil); err != nil || st.FeeSplitter() != nil {
+		t.Errorf("clearing the splitter: %v, left %v", err, st.FeeSplitter())
+	}
+}
+
+func TestFeeSplitterSkipsEmptyShares(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.SetFeeSplitter([]FeeSplit{{"0xTREASURY", 9000}, {"0xBURN", 500}, {"0xDEV", 500}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetTransactionFee(big.NewInt(10), 0); err != nil {
+		t.Fatal(err)
+	}
+	var events []TransferEvent
+	st.RegisterTransferHook(func(event TransferEvent) { events = append(events, event) })
+
+	// A 10 raw unit fee gives 0xBURN half a unit, which rounds to nothing; 0xDEV takes the rest
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE", "0xBOB", "0xDEV", "0xTREASURY")
+	checkBalance(t, st, "0xTREASURY", big.NewInt(9))
+	checkBalance(t, st, "0xDEV", big.NewInt(1))
+	for _, event := range events {
+		if event.Amount.Sign() == 0 {
+			t.Errorf("zero-amount %s event from %s to %s", event.Kind, event.From, event.To)
+		}
+	}
+	if len(events) != 3 {
+		t.Errorf("got %d transfer events, want the transfer and two fee shares", len(events))
+	}
+	checkSane(t, st)
+}
+
+func TestProtocolFeeOnWrapAndUnwrap(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 100)
+	if err := ow.SetFee(bpsDenominator+1, "0xFEES"); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("fee above 100%%: err = %v, want %v", err, ErrInvalidAmount)
+	}
+	if err := ow.SetFee(30, "0xFEES"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 0.3% of 100 tokens stays with the fee recipient and 99.7 back the wrapped tokens
+	if err := ow.Wrap(st, "0xALICE", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := new(big.Int).Set(ow.balances["0xALICE"])
+	checkBalance(t, st, "0xFEES", big.NewInt(300_000))
+	if wrapped.Cmp(big.NewInt(99_700_000)) != 0 {
+		t.Fatalf("wrapped %s, want 99.7 tokens", wrapped)
+	}
+
+	// The split doubles the collected fee along with the custody, and the rate only reflects
+	// the custody
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if ow.exchangeRate.Cmp(tokens(2)) != 0 {
+		t.Errorf("exchange rate = %s, want %s", ow.exchangeRate, tokens(2))
+	}
+
+	if err := ow.Transfer("0xALICE", "0xCONTRACT", wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Unwrap(st, "0xALICE", wrapped, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 0.6 from wrapping plus 0.3% of the 199.4 unwrapped
+	checkBalance(t, st, "0xFEES", big.NewInt(600_000+598_200))
+	checkBalance(t, st, "0xALICE", big.NewInt(199_400_000-598_200))
+	if custody := st.BalanceOf(ow.ticker); custody.Sign() != 0 {
+		t.Errorf("wrapper still holds %s after unwrapping everything", custody)
+	}
+	checkSane(t, st)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// VotingWeight returns holder's voting weight: its balance of st plus its wrapped balance
+// converted back to underlying at ow's exchange rate. The underlying held by the wrapper
+// itself carries no votes, since its wrapped holders vote it instead.
+func VotingWeight(holder string, st *StockToken, ow *OndoWrappedStock) (*big.Int, error) {
+	if err := checkVotingTokens(st, ow); err != nil {
+		return nil, err
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return votingWeight(holder, st, ow), nil
+}
+
+// TotalVotingSupply returns the combined voting weight of every holder: the supply of st
+// outside the wrapper plus the whole wrapped supply converted to underlying
+func TotalVotingSupply(st *StockToken, ow *OndoWrappedStock) (*big.Int, error) {
+	if err := checkVotingTokens(st, ow); err != nil {
+		return nil, err
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return totalVotingSupply(st, ow), nil
+}
+
+// VotingWeightFraction returns holder's share of TotalVotingSupply, or zero if there are no votes
+func VotingWeightFraction(holder string, st *StockToken, ow *OndoWrappedStock) (*big.Rat, error) {
+	if err := checkVotingTokens(st, ow); err != nil {
+		return nil, err
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	total := totalVotingSupply(st, ow)
+	if total.Sign() == 0 {
+		return new(big.Rat), nil
+	}
+	return new(big.Rat).SetFrac(votingWeight(holder, st, ow), total), nil
+}
+
+// checkVotingTokens checks that ow wraps st at the same precision
+func checkVotingTokens(st *StockToken, ow *OndoWrappedStock) error {
+	if st == nil || ow == nil {
+		return errors.New("token is nil")
+	}
+	if ow.ticker != "ow"+st.ticker {
+		return fmt.Errorf("%s does not wrap %s", ow.ticker, st.ticker)
+	}
+	if st.Precision.Cmp(ow.Precision) != 0 {
+		return fmt.Errorf("precision mismatch: %s has %s, %s has %s", st.ticker, st.Precision, ow.ticker, ow.Precision)
+	}
+	return nil
+}
+
+// votingWeight is VotingWeight for callers holding both read locks
+func votingWeight(holder string, st *StockToken, ow *OndoWrappedStock) *big.Int {
+	weight := big.NewInt(0)
+	if wrapped := ow.balances[holder]; wrapped != nil {
+		weight.Mul(wrapped, ow.exchangeRate)
+		weight.Div(weight, ow.Precision)
+	}
+	if balance := st.balances[holder]; balance != nil && holder != ow.ticker {
+		weight.Add(weight, balance)
+	}
+	return weight
+}
+
+// totalVotingSupply is TotalVotingSupply for callers holding both read locks
+func totalVotingSupply(st *StockToken, ow *OndoWrappedStock) *big.Int {
+	total := new(big.Int).Mul(ow.totalSupply, ow.exchangeRate)
+	total.Div(total, ow.Precision)
+	total.Add(total, st.totalSupply)
+	if custody := st.balances[ow.ticker]; custody != nil {
+		total.Sub(total, custody)
+	}
+	return total
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestVotingAfterWrapAndRebase(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	if err := ow.Wrap(st, "0xALICE", tokens(6), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+
+	total, err := TotalVotingSupply(st, ow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Cmp(st.TotalSupply()) != 0 {
+		t.Errorf("total voting supply = %s, want the total supply %s", total, st.TotalSupply())
+	}
+	// Alice's 8 unwrapped tokens plus the 12 her wrapped tokens now unwrap to
+	for holder, want := range map[string]*big.Int{"0xALICE": tokens(20), "0xBOB": tokens(10), ow.ticker: big.NewInt(0)} {
+		weight, err := VotingWeight(holder, st, ow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weight.Cmp(want) != 0 {
+			t.Errorf("%s voting weight = %s, want %s", holder, weight, want)
+		}
+	}
+	fraction, err := VotingWeightFraction("0xALICE", st, ow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fraction.Cmp(big.NewRat(2, 3)) != 0 {
+		t.Errorf("0xALICE voting fraction = %s, want 2/3", fraction.RatString())
+	}
+}
+
+func TestVotingRejectsMismatchedTokens(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	precise, err := NewStockToken("TSLA", "Tesla, Inc.", 18, "$100.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]*StockToken{"precision mismatch": precise, "other ticker": other, "nil token": nil} {
+		if _, err := VotingWeight("0xALICE", token, ow); err == nil {
+			t.Errorf("VotingWeight with a %s succeeded", name)
+		}
+		if _, err := TotalVotingSupply(token, ow); err == nil {
+			t.Errorf("TotalVotingSupply with a %s succeeded", name)
+		}
+		if _, err := VotingWeightFraction("0xALICE", token, ow); err == nil {
+			t.Errorf("VotingWeightFraction with a %s succeeded", name)
+		}
+	}
+
+	// With no votes cast the fraction is zero rather than a division by zero
+	if fraction, err := VotingWeightFraction("0xALICE", st, ow); err != nil || fraction.Sign() != 0 {
+		t.Errorf("fraction of an empty supply = %v, %v, want 0", fraction, err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"math/big"
+	"slices"
+	"sort"
+)
+
+// holderIndex is the sorted list of the addresses in a balance map, kept alongside it so
+// holders can be visited in a fixed order without sorting the map keys every time
+type holderIndex []string
+
+// newHolderIndex indexes every address in balances
+func newHolderIndex(balances map[string]*big.Int) holderIndex {
+	return sortedAddresses(balances)
+}
+
+// sortedAddresses returns the keys of balances in sorted order
+func sortedAddresses(balances map[string]*big.Int) []string {
+	addresses := make([]string, 0, len(balances))
+	for address := range balances {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// insert adds address in sorted position, unless it is already indexed
+func (h *holderIndex) insert(address string) {
+	i := sort.SearchStrings(*h, address)
+	if i < len(*h) && (*h)[i] == address {
+		return
+	}
+	*h = slices.Insert(*h, i, address)
+}
+
+// remove drops address from the index, if it is indexed
+func (h *holderIndex) remove(address string) {
+	i := sort.SearchStrings(*h, address)
+	if i < len(*h) && (*h)[i] == address {
+		*h = slices.Delete(*h, i, i+1)
+	}
+}
+
+// balanceEntry returns address's balance for updating in place, first adding a zero balance
+// and indexing the address if it has none. The balance is checkpointed for the latest
+// snapshot first. The caller must hold t.mu.
+func (t *StockToken) balanceEntry(address string) *big.Int {
+	t.checkpointBalance(address)
+	balance := t.balances[address]
+	if balance == nil {
+		balance = big.NewInt(0)
+		t.balances[address] = balance
+		t.holders.insert(address)
+	}
+	return balance
+}
+
+// removeBalance deletes address's balance and drops it from the index. The caller must hold
+// t.mu.
+func (t *StockToken) removeBalance(address string) {
+	t.checkpointBalance(address)
+	delete(t.balances, address)
+	t.holders.remove(address)
+}
+
+// debit subtracts amount from address's balance, which must cover it, and removes the balance
+// once it reaches zero so only real holders stay in the map and the index. The caller must
+// hold t.mu.
+func (t *StockToken) debit(address string, amount *big.Int) {
+	t.checkpointBalance(address)
+	balance := t.balances[address]
+	balance.Sub(balance, amount)
+	if balance.Sign() == 0 {
+		t.removeBalance(address)
+	}
+}
+
+// setBalances replaces every balance and rebuilds the index. The caller must hold t.mu.
+func (t *StockToken) setBalances(balances map[string]*big.Int) {
+	t.checkpointAll()
+	t.balances = balances
+	t.holders = newHolderIndex(balances)
+}
+
+// SortedHolders returns every address with a balance in sorted order. Balances that fall to
+// zero are removed, so only real holders are listed. The index is kept up to date as balances
+// are added and removed, so no sorting is done here.
+func (t *StockToken) SortedHolders() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.holders)
+}
+
+// balanceEntry returns address's wrapped balance for updating in place, first adding a zero
+// balance and indexing the address if it has none. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) balanceEntry(address string) *big.Int {
+	balance := ow.balances[address]
+	if balance == nil {
+		balance = big.NewInt(0)
+		ow.balances[address] = balance
+		ow.holders.insert(address)
+	}
+	return balance
+}
+
+// credit adds amount to address's wrapped balance. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) credit(address string, amount *big.Int) {
+	balance := ow.balanceEntry(address)
+	balance.Add(balance, amount)
+}
+
+// debit subtracts amount from address's wrapped balance, which must cover it, and removes the
+// balance once it reaches zero. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) debit(address string, amount *big.Int) {
+	balance := ow.balances[address]
+	balance.Sub(balance, amount)
+	if balance.Sign() == 0 {
+		ow.removeBalance(address)
+	}
+}
+
+// removeBalance deletes address's wrapped balance and drops it from the index. The caller
+// must hold ow.mu.
+func (ow *OndoWrappedStock) removeBalance(address string) {
+	delete(ow.balances, address)
+	ow.holders.remove(address)
+}
+
+// setBalances replaces every wrapped balance and rebuilds the index. The caller must hold
+// ow.mu.
+func (ow *OndoWrappedStock) setBalances(balances map[string]*big.Int) {
+	ow.balances = balances
+	ow.holders = newHolderIndex(balances)
+}
+
+// SortedHolders returns every address with a wrapped balance in sorted order. Balances that
+// fall to zero are removed, so only real holders are listed.
+func (ow *OndoWrappedStock) SortedHolders() []string {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return slices.Clone(ow.holders)
+}
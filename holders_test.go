@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+)
+
+// checkHolders fails unless holders lists exactly want, and every one of them has a positive
+// balance in balances
+func checkHolders(t *testing.T, holders []string, balances map[string]*big.Int, want ...string) {
+	t.Helper()
+	if !slices.Equal(holders, want) {
+		t.Errorf("holders = %v, want %v", holders, want)
+	}
+	if len(balances) != len(holders) {
+		t.Errorf("%d balances for %d holders", len(balances), len(holders))
+	}
+	for _, address := range holders {
+		if balances[address] == nil || balances[address].Sign() <= 0 {
+			t.Errorf("holder %s has balance %v", address, balances[address])
+		}
+	}
+}
+
+func TestEmptiedBalancesLeaveIndex(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	for _, address := range []string{"0xALICE", "0xBOB", "0xCAROL", "0xDAVE", "0xERIN"} {
+		mustMint(t, st, address, 10)
+	}
+
+	if err := st.Interact("0xALICE", "0xFRANK", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Burn("0xBOB", tokens(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Stake("0xCAROL", tokens(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Wrap(st, "0xDAVE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := new(big.Int).Set(ow.balances["0xDAVE"])
+	if err := ow.Transfer("0xDAVE", "0xCONTRACT", wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Unwrap(st, "0xERIN", wrapped, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checkHolders(t, st.SortedHolders(), st.balances, "0xERIN", "0xFRANK")
+	checkHolders(t, ow.SortedHolders(), ow.balances)
+	checkSane(t, st)
+}
+
+func TestUpdateExchangeRateWithoutCustody(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Lose the custody entry, as if it had been drained to zero and removed
+	rate := new(big.Int).Set(ow.exchangeRate)
+	st.removeBalance(ow.ticker)
+	ow.UpdateExchangeRate(st)
+	if ow.exchangeRate.Cmp(rate) != 0 {
+		t.Errorf("exchange rate = %s with no custody, want it kept at %s", ow.exchangeRate, rate)
+	}
+}
+
+func TestProportionalTransferWholeBalance(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	if err := st.ProportionalTransfer(bpsDenominator, "0xFEES"); err != nil {
+		t.Fatal(err)
+	}
+	checkHolders(t, st.SortedHolders(), st.balances, "0xFEES")
+	checkBalance(t, st, "0xFEES", tokens(15))
+}
+
+func TestOndoBatchTransferWholeBalance(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	half := new(big.Int).Div(ow.balances["0xALICE"], big.NewInt(2))
+	rest := new(big.Int).Sub(ow.balances["0xALICE"], half)
+	if err := ow.BatchTransfer("0xALICE", map[string]*big.Int{"0xBOB": half, "0xCAROL": rest}); err != nil {
+		t.Fatal(err)
+	}
+	checkHolders(t, ow.SortedHolders(), ow.balances, "0xBOB", "0xCAROL")
+}
+
+func TestProcessSubscriptionsInIDOrder(t *testing.T) {
+	st := newTestToken(t)
+	var minted []string
+	st.RegisterTransferHook(func(event TransferEvent) { minted = append(minted, event.To) })
+	start := time.Now().Add(-time.Hour)
+	for _, address := range []string{"0xZED", "0xAMY", "0xMAX", "0xBEA"} {
+		if _, err := st.AddSubscription(address, 1, time.Hour, start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.ProcessSubscriptions(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0xZED", "0xAMY", "0xMAX", "0xBEA"}; !slices.Equal(minted, want) {
+		t.Errorf("minted to %v, want %v", minted, want)
+	}
+}
+
+func BenchmarkSortedHolders(b *testing.B) {
+	st := newTestToken(b)
+	for i := 0; i < 10_000; i++ {
+		mustMint(b, st, "0x"+big.NewInt(int64(i)).Text(16)+"HOLDER", 1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st.SortedHolders()
+	}
+}
+
+func TestSortedHoldersAfterManyMints(t *testing.T) {
+	st := newTestToken(t)
+	// 100 mints to 75 addresses in scrambled order, the last 25 topping up earlier holders
+	var want []string
+	for i := range 100 {
+		address := fmt.Sprintf("0x%02d", i*37%75)
+		if !slices.Contains(want, address) {
+			want = append(want, address)
+		}
+		mustMint(t, st, address, 1)
+	}
+	slices.Sort(want)
+	holders := st.SortedHolders()
+	if !slices.IsSorted(holders) {
+		t.Errorf("holders are not sorted: %v", holders)
+	}
+	checkHolders(t, holders, st.balances, want...)
+	checkBalance(t, st, "0x00", tokens(2))
+	checkSane(t, st)
+
+	// The returned slice is a copy, so callers cannot reorder the index
+	holders[0], holders[1] = holders[1], holders[0]
+	if !slices.IsSorted(st.SortedHolders()) {
+		t.Error("changing the returned holders reordered the index")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"math/big"
+	"time"
+)
+
+// TransferEvent describes one balance change. Kind is "mint", "burn", "transfer", "rebase",
+// "batch_rebase", "batch_mint", "batch_transfer", "stake" or "unstake". Mints and unstakes
+// have no From and burns and stakes have no To. A rebase or batch rebase has neither, and its
+// Amount is the change in total supply, which is negative when the supply shrinks. The other
+// batch events have neither and their Amount is the batch total.
+type TransferEvent struct {
+	From      string
+	To        string
+	Amount    *big.Int
+	Kind      string
+	Timestamp time.Time
+}
+
+// PriceUpdateEvent describes a share price change made by SetSharePrice or a price feed
+type PriceUpdateEvent struct {
+	Ticker        string
+	OldPriceCents *big.Int
+	NewPriceCents *big.Int
+	Timestamp     time.Time
+}
+
+// MergerEvent describes a completed Merge. Retired is the acquiree supply that was cancelled
+// and Issued the acquirer shares minted for it.
+type MergerEvent struct {
+	Acquiree  string
+	Acquirer  string
+	Ratio     *big.Rat
+	Retired   *big.Int
+	Issued    *big.Int
+	Timestamp time.Time
+}
+
+// SpinoffEvent describes a completed Spinoff. Distributed is the child supply minted to parent
+// holders and Dust the remainder minted to the child's dust address.
+type SpinoffEvent struct {
+	Parent      string
+	Child       string
+	Ratio       *big.Rat
+	Distributed *big.Int
+	Dust        *big.Int
+	Timestamp   time.Time
+}
+
+// eventHooks holds registered hooks and the events waiting to be delivered to them and
+// appended to the token's event log. Events are queued while the owning token's lock is held
+// and delivered after it is released.
+type eventHooks struct {
+	log *EventLog // the token's EventLog, nil if it has none
+
+	hooks   []func(event TransferEvent)
+	pending []TransferEvent
+
+	priceHooks    []func(event PriceUpdateEvent)
+	pendingPrices []PriceUpdateEvent
+
+	mergerHooks    []func(event MergerEvent)
+	pendingMergers []MergerEvent
+
+	spinoffHooks    []func(event SpinoffEvent)
+	pendingSpinoffs []SpinoffEvent
+}
+
+// record queues an event that happened at now, unless there is no hook or log to deliver it to
+func (h *eventHooks) record(kind, from, to string, amount *big.Int, now time.Time) {
+	if len(h.hooks) == 0 && h.log == nil {
+		return
+	}
+	h.pending = append(h.pending, TransferEvent{
+		From:      from,
+		To:        to,
+		Amount:    new(big.Int).Set(amount),
+		Kind:      kind,
+		Timestamp: now,
+	})
+}
+
+// recordPrice queues a price update made at now, unless there is no price hook or log to
+// deliver it to
+func (h *eventHooks) recordPrice(ticker string, oldPrice, newPrice *big.Int, now time.Time) {
+	if len(h.priceHooks) == 0 && h.log == nil {
+		return
+	}
+	h.pendingPrices = append(h.pendingPrices, PriceUpdateEvent{
+		Ticker:        ticker,
+		OldPriceCents: new(big.Int).Set(oldPrice),
+		NewPriceCents: new(big.Int).Set(newPrice),
+		Timestamp:     now,
+	})
+}
+
+// recordMerger queues a merger, unless there is no merger hook or log to deliver it to
+func (h *eventHooks) recordMerger(event MergerEvent) {
+	if len(h.mergerHooks) == 0 && h.log == nil {
+		return
+	}
+	h.pendingMergers = append(h.pendingMergers, event)
+}
+
+// recordSpinoff queues a spinoff, unless there is no spinoff hook or log to deliver it to
+func (h *eventHooks) recordSpinoff(event SpinoffEvent) {
+	if len(h.spinoffHooks) == 0 && h.log == nil {
+		return
+	}
+	h.pendingSpinoffs = append(h.pendingSpinoffs, event)
+}
+
+// collapse replaces the events queued since mark with a single summary event
+func (h *eventHooks) collapse(mark int, kind string, total *big.Int, now time.Time) {
+	if len(h.hooks) == 0 && h.log == nil {
+		return
+	}
+	h.pending = h.pending[:mark]
+	h.record(kind, "", "", total, now)
+}
+
+// take removes the queued events, appends them to the log and returns a function that
+// delivers them to the hooks in registration and event order. The function must be called
+// without the token's lock held.
+func (h *eventHooks) take() (deliver func()) {
+	events, hooks := h.pending, h.hooks
+	prices, priceHooks := h.pendingPrices, h.priceHooks
+	mergers, mergerHooks := h.pendingMergers, h.mergerHooks
+	spinoffs, spinoffHooks := h.pendingSpinoffs, h.spinoffHooks
+	h.pending, h.pendingPrices, h.pendingMergers, h.pendingSpinoffs = nil, nil, nil, nil
+	if h.log != nil {
+		h.logEvents(events, prices, mergers, spinoffs)
+	}
+
+	return func() {
+		for _, event := range events {
+			for _, hook := range hooks {
+				hook(event)
+			}
+		}
+		for _, event := range prices {
+			for _, hook := range priceHooks {
+				hook(event)
+			}
+		}
+		for _, event := range mergers {
+			for _, hook := range mergerHooks {
+				hook(event)
+			}
+		}
+		for _, event := range spinoffs {
+			for _, hook := range spinoffHooks {
+				hook(event)
+			}
+		}
+	}
+}
+
+// logEvents appends events to the log, one entry each
+func (h *eventHooks) logEvents(events []TransferEvent, prices []PriceUpdateEvent, mergers []MergerEvent, spinoffs []SpinoffEvent) {
+	for _, event := range events {
+		fields := map[string]string{"amount": event.Amount.String()}
+		if event.From != "" {
+			fields["from"] = event.From
+		}
+		if event.To != "" {
+			fields["to"] = event.To
+		}
+		h.log.append(event.Kind, event.Timestamp, fields)
+	}
+	for _, event := range prices {
+		h.log.append("price_update", event.Timestamp, map[string]string{
+			"ticker":    event.Ticker,
+			"old_price": event.OldPriceCents.String(),
+			"new_price": event.NewPriceCents.String(),
+		})
+	}
+	for _, event := range mergers {
+		h.log.append("merger", event.Timestamp, map[string]string{
+			"acquiree": event.Acquiree,
+			"acquirer": event.Acquirer,
+			"ratio":    event.Ratio.RatString(),
+			"retired":  event.Retired.String(),
+			"issued":   event.Issued.String(),
+		})
+	}
+	for _, event := range spinoffs {
+		h.log.append("spinoff", event.Timestamp, map[string]string{
+			"parent":      event.Parent,
+			"child":       event.Child,
+			"ratio":       event.Ratio.RatString(),
+			"distributed": event.Distributed.String(),
+			"dust":        event.Dust.String(),
+		})
+	}
+}
+
+// RegisterTransferHook calls fn after every mint, burn, transfer and rebase. Hooks run after
+// the lock is released, in registration order, so they may call back into the token.
+func (t *StockToken) RegisterTransferHook(fn func(event TransferEvent)) {
+	if fn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks.hooks = append(t.hooks.hooks, fn)
+}
+
+// RegisterPriceHook calls fn after every SetSharePrice and external price update. Hooks run
+// after the lock is released, in registration order.
+func (t *StockToken) RegisterPriceHook(fn func(event PriceUpdateEvent)) {
+	if fn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks.priceHooks = append(t.hooks.priceHooks, fn)
+}
+
+// RegisterMergerHook calls fn after every Merge into or out of the token. Hooks run after the
+// lock is released, in registration order.
+func (t *StockToken) RegisterMergerHook(fn func(event MergerEvent)) {
+	if fn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks.mergerHooks = append(t.hooks.mergerHooks, fn)
+}
+
+// RegisterSpinoffHook calls fn after every Spinoff from or into the token. Hooks run after the
+// lock is released, in registration order.
+func (t *StockToken) RegisterSpinoffHook(fn func(event SpinoffEvent)) {
+	if fn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks.spinoffHooks = append(t.hooks.spinoffHooks, fn)
+}
+
+// UnregisterAllHooks removes every transfer, price, merger and spinoff hook
+func (t *StockToken) UnregisterAllHooks() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = eventHooks{log: t.hooks.log}
+}
+
+// emitEvents delivers the queued events to the hooks. It must be called without t.mu held.
+func (t *StockToken) emitEvents() {
+	t.mu.Lock()
+	deliver := t.hooks.take()
+	t.mu.Unlock()
+	deliver()
+}
+
+// RegisterTransferHook calls fn after every wrapped mint, burn and transfer. Hooks run after
+// the lock is released, in registration order, so they may call back into the wrapper.
+func (ow *OndoWrappedStock) RegisterTransferHook(fn func(event TransferEvent)) {
+	if fn == nil {
+		return
+	}
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.hooks.hooks = append(ow.hooks.hooks, fn)
+}
+
+// UnregisterAllHooks removes every transfer hook
+func (ow *OndoWrappedStock) UnregisterAllHooks() {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.hooks = eventHooks{log: ow.hooks.log}
+}
+
+// emitEvents delivers the queued events to the hooks. It must be called without ow.mu held.
+func (ow *OndoWrappedStock) emitEvents() {
+	ow.mu.Lock()
+	deliver := ow.hooks.take()
+	ow.mu.Unlock()
+	deliver()
+}
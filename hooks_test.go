@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransferHooksSeeEventSequence(t *testing.T) {
+	st := newTestToken(t)
+	type seen struct {
+		hook     int
+		kind     string
+		from, to string
+		amount   string
+		stamped  bool
+	}
+	var events []seen
+	for hook := 1; hook <= 2; hook++ {
+		st.RegisterTransferHook(func(event TransferEvent) {
+			events = append(events, seen{hook, event.Kind, event.From, event.To, event.Amount.String(), !event.Timestamp.IsZero()})
+		})
+	}
+
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.Interact("0xALICE", "0xBOB", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Burn("0xBOB", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both hooks see every event, in registration order
+	var want []seen
+	for _, event := range []seen{
+		{kind: "mint", to: "0xALICE", amount: tokens(10).String()},
+		{kind: "transfer", from: "0xALICE", to: "0xBOB", amount: tokens(4).String()},
+		{kind: "burn", from: "0xBOB", amount: tokens(1).String()},
+		{kind: "rebase", amount: tokens(9).String()},
+	} {
+		for hook := 1; hook <= 2; hook++ {
+			event.hook, event.stamped = hook, true
+			want = append(want, event)
+		}
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("hooks saw\n%v\nwant\n%v", events, want)
+	}
+
+	st.UnregisterAllHooks()
+	events = nil
+	mustMint(t, st, "0xALICE", 1)
+	if len(events) != 0 {
+		t.Errorf("unregistered hooks saw %d events", len(events))
+	}
+}
+
+func TestWrappedTransferHooks(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	var kinds []string
+	ow.RegisterTransferHook(func(event TransferEvent) { kinds = append(kinds, event.Kind) })
+
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xCONTRACT", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Unwrap(st, "0xBOB", tokens(4), big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mint", "transfer", "burn"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("wrapper hooks saw %v, want %v", kinds, want)
+	}
+}
+
+func TestEventsUseTokenClock(t *testing.T) {
+	clock := newFakeClock()
+	st := newTestToken(t)
+	st.Clock = clock
+	ow := NewOndoWrappedStock(st)
+	var stamps []time.Time
+	st.RegisterTransferHook(func(event TransferEvent) { stamps = append(stamps, event.Timestamp) })
+	st.RegisterPriceHook(func(event PriceUpdateEvent) { stamps = append(stamps, event.Timestamp) })
+	ow.RegisterTransferHook(func(event TransferEvent) { stamps = append(stamps, event.Timestamp) })
+
+	mustMint(t, st, "0xALICE", 10)
+	clock.Advance(time.Hour)
+	if err := st.SetSharePrice("$101.00"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xBOB", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mint, price update, rebase, the wrap's underlying transfer and wrapped mint, then the
+	// wrapped transfer, each stamped with the fake clock's time when it happened
+	start := clock.Now().Add(-3 * time.Hour)
+	want := []time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour)}
+	for i := 0; i < 3; i++ {
+		want = append(want, start.Add(3*time.Hour))
+	}
+	if !reflect.DeepEqual(stamps, want) {
+		t.Errorf("events stamped\n%v\nwant\n%v", stamps, want)
+	}
+}
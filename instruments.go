@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Warrant is the right to buy Quantity new shares at StrikePrice (in cents) until Expiry
+type Warrant struct {
+	ID          int
+	Address     string
+	StrikePrice *big.Int
+	Quantity    *big.Int
+	Expiry      time.Time
+	Expired     bool
+}
+
+// IssueWarrant records a new warrant for address and returns its id
+func (t *StockToken) IssueWarrant(address string, strikePrice *big.Int, quantity *big.Int, expiry time.Time) (warrantID int, err error) {
+	if err := t.checkAddresses(address); err != nil {
+		return 0, err
+	}
+	if strikePrice == nil || strikePrice.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: strike price must be positive", ErrInvalidAmount)
+	}
+	if quantity == nil || quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: warrant quantity must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.warrants == nil {
+		t.warrants = make(map[int]*Warrant)
+	}
+	t.nextWarrantID++
+	t.warrants[t.nextWarrantID] = &Warrant{
+		ID:          t.nextWarrantID,
+		Address:     address,
+		StrikePrice: new(big.Int).Set(strikePrice),
+		Quantity:    new(big.Int).Set(quantity),
+		Expiry:      expiry,
+	}
+	return t.nextWarrantID, nil
+}
+
+// ExerciseWarrant mints the warrant's quantity to its holder if it is in the money and
+// has not expired at now. A warrant can only be exercised once.
+func (t *StockToken) ExerciseWarrant(id int, now time.Time) error {
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, ok := t.warrants[id]
+	if !ok {
+		return fmt.Errorf("no warrant with id %d", id)
+	}
+	if w.Expired || !now.Before(w.Expiry) {
+		w.Expired = true
+		return fmt.Errorf("%w: warrant %d", ErrWarrantExpired, id)
+	}
+	if t.sharePrice.Cmp(w.StrikePrice) <= 0 {
+		return fmt.Errorf("warrant %d is out of the money", id)
+	}
+	if err := t.checkMint(w.Quantity, w.Address); err != nil {
+		return err
+	}
+
+	t.mint(w.Address, w.Quantity)
+	w.Expired = true
+	return nil
+}
+
+// ConvertibleNote is debt that accrues simple interest and can convert into shares before maturity
+type ConvertibleNote struct {
+	ID                   int
+	Holder               string
+	PrincipalCents       *big.Int
+	InterestRateBps      uint // annual, simple interest
+	IssuedAt             time.Time
+	Maturity             time.Time
+	ConversionPriceCents *big.Int
+	Settled              bool
+}
+
+// year used to accrue note interest
+const noteYear = 365 * 24 * time.Hour
+
+// IssueConvertibleNote records a new convertible note for holder and returns its id
+func (t *StockToken) IssueConvertibleNote(holder string, principalCents *big.Int, interestRateBps uint, maturity time.Time, conversionPriceCents *big.Int) (noteID int, err error) {
+	if err := t.checkAddresses(holder); err != nil {
+		return 0, err
+	}
+	if principalCents == nil || principalCents.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: note principal must be positive", ErrInvalidAmount)
+	}
+	if conversionPriceCents == nil || conversionPriceCents.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: conversion price must be positive", ErrInvalidAmount)
+	}
+
+	issuedAt := t.now()
+	if !maturity.After(issuedAt) {
+		return 0, errors.New("note maturity must be in the future")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.notes == nil {
+		t.notes = make(map[int]*ConvertibleNote)
+	}
+	t.nextNoteID++
+	t.notes[t.nextNoteID] = &ConvertibleNote{
+		ID:                   t.nextNoteID,
+		Holder:               holder,
+		PrincipalCents:       new(big.Int).Set(principalCents),
+		InterestRateBps:      interestRateBps,
+		IssuedAt:             issuedAt,
+		Maturity:             maturity,
+		ConversionPriceCents: new(big.Int).Set(conversionPriceCents),
+	}
+	return t.nextNoteID, nil
+}
+
+// ConvertNote converts the note's principal plus accrued interest into shares at the
+// conversion price and mints them to the holder. Only possible before maturity.
+func (t *StockToken) ConvertNote(noteID int, now time.Time) error {
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	note, err := t.openNote(noteID)
+	if err != nil {
+		return err
+	}
+	if !now.Before(note.Maturity) {
+		return fmt.Errorf("note %d has matured and can no longer convert", noteID)
+	}
+
+	// shares = value / conversionPrice, scaled to token precision
+	shares := new(big.Int).Mul(note.valueAt(now), t.Precision)
+	shares.Div(shares, note.ConversionPriceCents)
+	if err := t.checkMint(shares, note.Holder); err != nil {
+		return err
+	}
+
+	t.mint(note.Holder, shares)
+	note.Settled = true
+	return nil
+}
+
+// RedeemNote settles the note in cash, returning principal plus accrued interest in cents
+func (t *StockToken) RedeemNote(noteID int, now time.Time) (*big.Int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	note, err := t.openNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Settled = true
+	return note.valueAt(now), nil
+}
+
+// openNote looks up a note that has not been converted or redeemed yet
+func (t *StockToken) openNote(noteID int) (*ConvertibleNote, error) {
+	note, ok := t.notes[noteID]
+	if !ok {
+		return nil, fmt.Errorf("no convertible note with id %d", noteID)
+	}
+	if note.Settled {
+		return nil, fmt.Errorf("convertible note %d is already settled", noteID)
+	}
+	return note, nil
+}
+
+// valueAt returns principal plus simple interest accrued up to now (capped at maturity), in cents
+func (n *ConvertibleNote) valueAt(now time.Time) *big.Int {
+	if now.After(n.Maturity) {
+		now = n.Maturity
+	}
+	elapsed := now.Sub(n.IssuedAt)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	// interest = principal * rateBps / 10000 * elapsed / year
+	interest := new(big.Int).Mul(n.PrincipalCents, big.NewInt(int64(n.InterestRateBps)))
+	interest.Mul(interest, big.NewInt(int64(elapsed)))
+	denominator := new(big.Int).Mul(big.NewInt(bpsDenominator), big.NewInt(int64(noteYear)))
+	interest.Div(interest, denominator)
+	return interest.Add(interest, n.PrincipalCents)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestExerciseWarrant(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	expiry := clock.Now().Add(30 * 24 * time.Hour)
+
+	// $100 share price against an $80 strike is in the money
+	inTheMoney, err := st.IssueWarrant("0xALICE", big.NewInt(8000), tokens(5), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outOfTheMoney, err := st.IssueWarrant("0xBOB", big.NewInt(12000), tokens(5), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late, err := st.IssueWarrant("0xCAROL", big.NewInt(8000), tokens(5), expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if err := st.ExerciseWarrant(inTheMoney, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(5))
+	if err := st.ExerciseWarrant(inTheMoney, clock.Now()); !errors.Is(err, ErrWarrantExpired) {
+		t.Errorf("second exercise: err = %v, want ErrWarrantExpired", err)
+	}
+	if err := st.ExerciseWarrant(outOfTheMoney, clock.Now()); err == nil {
+		t.Error("exercised an out-of-the-money warrant")
+	}
+
+	clock.Advance(30 * 24 * time.Hour)
+	if err := st.ExerciseWarrant(late, clock.Now()); !errors.Is(err, ErrWarrantExpired) {
+		t.Errorf("exercise after expiry: err = %v, want ErrWarrantExpired", err)
+	}
+	checkBalance(t, st, "0xCAROL", big.NewInt(0))
+	if st.TotalSupply().Cmp(tokens(5)) != 0 {
+		t.Errorf("total supply = %s, want %s", st.TotalSupply(), tokens(5))
+	}
+}
+
+func TestConvertNote(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+
+	// $1,000 at 10% a year, converting at $50 a share
+	id, err := st.IssueConvertibleNote("0xALICE", big.NewInt(100_000), 1000, clock.Now().Add(2*noteYear), big.NewInt(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(noteYear / 2)
+	if err := st.ConvertNote(id, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// $1,050 of principal and interest buys 21 shares
+	checkBalance(t, st, "0xALICE", tokens(21))
+	checkSane(t, st)
+	if err := st.ConvertNote(id, clock.Now()); err == nil {
+		t.Error("converted a settled note")
+	}
+	if _, err := st.RedeemNote(id, clock.Now()); err == nil {
+		t.Error("redeemed a converted note")
+	}
+
+	matured, err := st.IssueConvertibleNote("0xBOB", big.NewInt(100_000), 1000, clock.Now().Add(noteYear), big.NewInt(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * noteYear)
+	if err := st.ConvertNote(matured, clock.Now()); err == nil {
+		t.Error("converted a matured note")
+	}
+	// Interest stops accruing at maturity
+	value, err := st.RedeemNote(matured, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Cmp(big.NewInt(110_000)) != 0 {
+		t.Errorf("redeemed %s cents, want 110000", value)
+	}
+}
@@ -1,338 +1,1617 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"math/big"
-	"strconv"
+	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
-// 6 decimal places
-const basePrecision = 1_000_000
+// defaultDecimals is the number of decimal places used by the demo tokens
+const defaultDecimals = 6
 
 // StockToken represents a rebasing token for any stock
 type StockToken struct {
+	// mu guards every field below. Methods that lock both a StockToken and an
+	// OndoWrappedStock always lock the StockToken first.
+	mu sync.RWMutex
+
+	// Precision is the number of raw units per whole token, 10^Decimals. It is set by
+	// NewStockToken and never changes.
+	Precision *big.Int
+
+	// Token metadata, set by NewStockToken. Decimals matches Precision and must not change.
+	Name     string
+	Symbol   string
+	Decimals uint
+
+	seq              uint64 // creation order, from tokenSeq, by which lockTokens orders tokens
 	ticker           string
+	owner            string // may still mint to itself while the token is paused
 	totalSupply      *big.Int
 	balances         map[string]*big.Int
-	rebaseMultiplier *big.Int
+	holders          holderIndex
+	rebaseMultiplier *big.Rat // product of every balance scaling since genesis
 	sharePrice       *big.Int // in cents
+	floorPrice       *big.Int // in cents, nil when no floor is set
+	isPaused         bool
+	dustAddress      string // receives rounding dust, DustAddress when empty
+	treasuryAddress  string // receives the shares issued by a DilutionAction
+
+	allowances map[string]map[string]*big.Int // owner -> spender -> amount
+
+	// Balances moved out of balances by Stake. They still count towards totalSupply.
+	stakedBalances map[string]*big.Int
+
+	// maxSupply caps the total supply however it grows, by mints, splits, dividends, mergers
+	// and spinoffs; nil means no cap. It is set by WithMaxSupply.
+	maxSupply *big.Int
+
+	// LaxAddressValidation accepts any non-empty address instead of only 0x-prefixed 160-bit
+	// hex addresses, for shorthand addresses such as 0xREECE. Set it before using the token.
+	LaxAddressValidation bool
+
+	// YieldMultiplier scales the dividend shares paid on staked balances, e.g. 3/2 pays
+	// stakers 1.5 times what an unstaked balance of the same size receives. Nil pays them
+	// the same. It must not be negative. Set it before using the token.
+	YieldMultiplier *big.Rat
+
+	// Clock supplies the time for lockups, vesting, price ages, rebase and event timestamps and
+	// the rebase scheduler. Nil uses the system clock. Set it before using the token.
+	Clock Clock
+
+	// External price feed settings and the prices recorded from it
+	maxPriceAge  time.Duration
+	priceFeedKey ed25519.PublicKey
+	priceHistory []PriceRecord
+	oracle       PriceOracle // refreshes sharePrice before dividends when attached
+
+	// RightsBalance holds outstanding rights from IssueRights, nil when no offering is open
+	RightsBalance map[string]*big.Int
+	rightsPrice   *big.Int // subscription price in cents
+
+	warrants      map[int]*Warrant
+	nextWarrantID int
+
+	notes      map[int]*ConvertibleNote
+	nextNoteID int
+
+	transferRestrictions map[string]time.Time // lockup end per address
+	vestingSchedules     map[string][]*VestingSchedule
+
+	subscriptions          map[int]*Subscription
+	nextSubscriptionPlanID int
+	scheduler              *rebaseScheduler // set while a rebase scheduler is running
+
+	// Transfer fee charged on top of the amount sent, paid to FeeRecipient
+	FeeRecipient string
+	flatFee      *big.Int
+	feeBps       uint
+	feeSplits    []FeeSplit // when set, fees are split here instead of paid to FeeRecipient
+
+	withholdingTaxBps map[string]uint
+	// TaxWithheld is the total dividend shares withheld per address
+	TaxWithheld map[string]*big.Int
+
+	// UnclaimedDividends is the dividend cash in cents accrued by AccrueDividend for each
+	// address that held nothing at the time, until ClaimDividend pays it out
+	UnclaimedDividends map[string]*big.Int
+
+	// OnRebase is called after every Rebase, if set
+	OnRebase func(st *StockToken, action RebaseAction)
+
+	// RebaseHistory records every applied rebase, oldest first
+	RebaseHistory []RebaseEvent
+
+	// EventLog records every state change, appended when events are delivered to the hooks
+	*EventLog
+	hooks eventHooks
+
+	rebaseSubscribers  map[int]chan<- RebaseEvent
+	nextSubscriptionID int
+	appliedActions     map[string]bool
+
+	// Balances and staked balances as they were at each snapshot, recorded the first time
+	// they change after it. nextSnapshotID is the latest snapshot taken, and checkpointedAll
+	// the latest for which every balance has been checkpointed.
+	balanceCheckpoints map[string][]checkpoint
+	stakedCheckpoints  map[string][]checkpoint
+	nextSnapshotID     SnapshotID
+	checkpointedAll    SnapshotID
+
+	// The share price and rebase progress when each snapshot was taken, for snapshot id at
+	// index id-1
+	snapshotMarks []snapshotMark
+
+	// Running counts of applied rebases
+	rebaseCount   int
+	splitCount    int
+	dividendCount int
 }
 
-// NewStockToken creates a new stock token contract
-func NewStockToken(ticker string) *StockToken {
-	return &StockToken{
+// NewStockToken creates a new stock token contract whose amounts have decimals decimal places.
+// Its Symbol is the ticker. initialPrice is a dollar string such as "$100.00" and must be
+// positive. owner can still be minted to while the token is paused, for emergency issuance.
+// Options such as WithMaxSupply are applied in order.
+func NewStockToken(ticker, name string, decimals uint, initialPrice, owner string, options ...TokenOption) (*StockToken, error) {
+	if owner == "" {
+		return nil, errors.New("owner address is empty")
+	}
+	price, err := parsePositiveDollars(initialPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	log := newEventLog()
+	t := &StockToken{
+		seq:              tokenSeq.Add(1),
+		Precision:        PrecisionFromDecimals(decimals),
+		Name:             name,
+		Symbol:           ticker,
+		Decimals:         decimals,
 		ticker:           ticker,
+		owner:            owner,
 		totalSupply:      big.NewInt(0),
 		balances:         make(map[string]*big.Int),
-		rebaseMultiplier: big.NewInt(1),
-		sharePrice:       dollarsToCents("$100.00"), // Initial price
+		rebaseMultiplier: big.NewRat(1, 1),
+		sharePrice:       price,
+		EventLog:         log,
+		hooks:            eventHooks{log: log},
 	}
+	for _, option := range options {
+		if err := option(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
 }
 
 // Mint creates new tokens based on off-chain TSLA shares
-func (t *StockToken) Mint(address string, shares uint64) {
-	// Convert shares to precise units (multiply by basePrecision)
-	amount := big.NewInt(int64(shares))
-	amount.Mul(amount, big.NewInt(basePrecision))
+func (t *StockToken) Mint(address string, shares uint64) error {
+	if shares == 0 {
+		return fmt.Errorf("%w: cannot mint zero shares", ErrInvalidAmount)
+	}
+
+	// Convert shares to precise units (multiply by Precision)
+	amount := new(big.Int).SetUint64(shares)
+	amount.Mul(amount, t.Precision)
+	return t.MintRaw(address, amount)
+}
+
+// MintFractional mints a decimal number of shares such as "2.5" or "0.000001".
+// At most as many decimal places as the token's precision are accepted.
+func (t *StockToken) MintFractional(address string, shares string) error {
+	amount, err := ParseTokens(shares, t.Precision)
+	if err != nil {
+		return err
+	}
+	return t.MintRaw(address, amount)
+}
+
+// MintRaw mints an amount that is already scaled by Precision
+func (t *StockToken) MintRaw(address string, rawAmount *big.Int) error {
+	if rawAmount == nil || rawAmount.Sign() <= 0 {
+		return fmt.Errorf("%w: mint amount must be positive", ErrInvalidAmount)
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(address); err != nil {
+		return err
+	}
+	if err := t.checkMint(rawAmount, address); err != nil {
+		return err
+	}
+	t.mint(address, rawAmount)
+	return nil
+}
+
+// mint adds rawAmount to an address's balance and totalSupply. The caller must hold t.mu.
+func (t *StockToken) mint(address string, rawAmount *big.Int) {
+	t.credit(address, rawAmount)
+	t.totalSupply.Add(t.totalSupply, rawAmount)
+	t.hooks.record("mint", "", address, rawAmount, t.now())
+}
+
+// ParseTokens converts a decimal amount such as "2.5" into raw units scaled by precision. It is
+// the inverse of formatTokens. Negative amounts, more than one decimal point and more fractional
+// digits than the precision allows are rejected rather than truncated.
+func ParseTokens(s string, precision *big.Int) (*big.Int, error) {
+	if precision == nil || precision.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: precision must be positive", ErrInvalidAmount)
+	}
+	if strings.HasPrefix(s, "-") {
+		return nil, fmt.Errorf("%w: negative amount %q", ErrInvalidAmount, s)
+	}
+	if strings.Count(s, ".") > 1 {
+		return nil, fmt.Errorf("%w: amount %q has more than one decimal point", ErrInvalidAmount, s)
+	}
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return nil, fmt.Errorf("%w: empty amount %q", ErrInvalidAmount, s)
+	}
+	if hasPoint && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("%w: malformed amount %q", ErrInvalidAmount, s)
+	}
+	decimals := precisionDecimals(precision)
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("%w: amount %q has more than %d decimal places", ErrInvalidAmount, s, decimals)
+	}
+
+	// Pad the fraction to the precision and read whole and fraction as one integer
+	raw, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed amount %q", ErrInvalidAmount, s)
+	}
+	return raw, nil
+}
 
+// isDigits reports whether s contains only ASCII digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Burn destroys amount of an address's tokens, reducing totalSupply
+func (t *StockToken) Burn(address string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: burn amount must be positive", ErrInvalidAmount)
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isPaused {
+		return ErrTokenPaused
+	}
+	balance := t.balances[address]
+	if balance == nil || balance.Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, address, t.ticker, formatTokens(amount, t.Precision))
+	}
+
+	t.debit(address, amount)
+	t.totalSupply.Sub(t.totalSupply, amount)
+	t.hooks.record("burn", address, "", amount, t.now())
+	return nil
+}
+
+// BalanceOf returns the balance of an address, or zero if it holds nothing
+func (t *StockToken) BalanceOf(address string) *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if t.balances[address] == nil {
-		t.balances[address] = big.NewInt(0)
+		return big.NewInt(0)
 	}
-	t.balances[address].Add(t.balances[address], amount)
-	t.totalSupply.Add(t.totalSupply, amount)
+	return new(big.Int).Set(t.balances[address])
+}
+
+// SharePrice returns the current share price in cents
+func (t *StockToken) SharePrice() *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return new(big.Int).Set(t.sharePrice)
 }
 
+// TotalSupply returns the current total supply in raw units
+func (t *StockToken) TotalSupply() *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return new(big.Int).Set(t.totalSupply)
+}
+
+// RebaseAction is a corporate action that Rebase can apply. Only types in this package
+// implement it.
+type RebaseAction interface {
+	isRebaseAction()
+}
+
+func (Dividend) isRebaseAction()           {}
+func (StockSplit) isRebaseAction()         {}
+func (CompoundDividend) isRebaseAction()   {}
+func (CappedDividend) isRebaseAction()     {}
+func (ReturnOfCapital) isRebaseAction()    {}
+func (StockMerger) isRebaseAction()        {}
+func (DividendWithRecord) isRebaseAction() {}
+func (DilutionAction) isRebaseAction()     {}
+func (UniformSplitAction) isRebaseAction() {}
+func (SpinOffAction) isRebaseAction()      {}
+
+// DividendAction is the Dividend rebase action
+type DividendAction = Dividend
+
+// StockSplitAction is the StockSplit rebase action
+type StockSplitAction = StockSplit
+
 // Dividend represents a cash dividend payment
 type Dividend struct {
 	cashAmount *big.Int // Amount in cents (e.g., $1.00 = 100)
 	sharePrice *big.Int // Current share price in cents
 }
 
+// validate rejects dividends that cannot be converted into shares
+func (d Dividend) validate() error {
+	if d.cashAmount == nil || d.cashAmount.Sign() < 0 {
+		return fmt.Errorf("%w: dividend amount must be non-negative", ErrInvalidAmount)
+	}
+	if d.sharePrice == nil || d.sharePrice.Sign() <= 0 {
+		return fmt.Errorf("%w: dividend share price must be positive", ErrInvalidAmount)
+	}
+	return nil
+}
+
+// DustAddress is the default address collecting the fractional shares rounded away from holders
+// by a split or spinoff. SetDustAddress changes it per token.
+const DustAddress = "0xDUST"
+
+// StockSplit scales every balance by Numerator/Denominator: 2/1 is a 2-for-1 split and 1/4
+// a 1-for-4 reverse split
+type StockSplit struct {
+	Numerator   *big.Int
+	Denominator *big.Int
+}
+
+// CompoundDividend applies several dividends sharing one ex-date, in order
+type CompoundDividend struct {
+	Dividends []Dividend
+}
+
+// CapOverflowAddress receives dividend shares withheld from holders by a CappedDividend
+const CapOverflowAddress = "0xCAPOVERFLOW"
+
+// CappedDividend pays a dividend where no holder receives more than MaxSharesPerHolder;
+// the excess goes to CapOverflowAddress
+type CappedDividend struct {
+	MaxSharesPerHolder *big.Int
+	Dividend           Dividend
+}
+
+// ReturnOfCapital pays cash back to holders out of capital, shrinking every balance by the
+// equivalent number of shares at the current share price
+type ReturnOfCapital struct {
+	AmountPerShareCents *big.Int
+}
+
 // Rebase adjusts token supply based on corporate actions
-func (t *StockToken) Rebase(action interface{}) {
+func (t *StockToken) Rebase(action RebaseAction) error {
+	action, err := t.refreshDividendPrice(action)
+	if err != nil {
+		return err
+	}
+
+	announceRebase(action)
+	defer t.emitEvents()
+	if partner := rebasePartner(action); partner != nil {
+		defer partner.emitEvents()
+	}
+
+	events, err := t.rebase(action, 1)
+	if err != nil {
+		return err
+	}
+	t.afterRebase(action, events)
+	return nil
+}
+
+// afterRebase calls OnRebase and notifies subscribers once for each committed event. Hooks run
+// after the lock is released so they can call back into the token.
+func (t *StockToken) afterRebase(action RebaseAction, events []RebaseEvent) {
+	for _, event := range events {
+		if t.OnRebase != nil {
+			t.OnRebase(t, action)
+		}
+		t.publishRebase(event)
+	}
+}
+
+// rebase applies action n times under the write lock, recording each application in
+// RebaseHistory. The ledger is copied once beforehand and put back if any application fails
+// or panics, so either all n are committed or nothing changes and a panic is re-raised.
+func (t *StockToken) rebase(action RebaseAction, n int) ([]RebaseEvent, error) {
+	// A merger or spinoff changes another token too, so it is locked and copied alongside t
+	partner := rebasePartner(action)
+	if partner == t {
+		partner = nil
+	}
+	defer lockTokens(t, partner)()
+	if t.isPaused {
+		return nil, ErrTokenPaused
+	}
+
+	committed := t.copyLedger()
+	var partnerCommitted ledgerState
+	if partner != nil {
+		partnerCommitted = partner.copyLedger()
+	}
+	restore := func() {
+		t.restoreLedger(committed)
+		if partner != nil {
+			partner.restoreLedger(partnerCommitted)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			restore()
+			panic(r)
+		}
+	}()
+
+	events := make([]RebaseEvent, 0, n)
+	previous := committed.balances
+	for i := 0; i < n; i++ {
+		preTotalSupply := new(big.Int).Set(t.totalSupply)
+		if err := t.applyAction(action); err != nil {
+			restore()
+			if n > 1 {
+				err = fmt.Errorf("rebase %d of %d failed: %w", i+1, n, err)
+			}
+			return nil, err
+		}
+		t.rebaseCount++
+
+		event := RebaseEvent{
+			ActionType:      rebaseActionType(action),
+			Timestamp:       t.now(),
+			PreTotalSupply:  preTotalSupply,
+			PostTotalSupply: new(big.Int).Set(t.totalSupply),
+			BalanceDiff:     balanceDiff(previous, t.balances),
+			DividendYield:   dividendYield(action),
+		}
+		t.RebaseHistory = append(t.RebaseHistory, event)
+		t.hooks.record("rebase", "", "", new(big.Int).Sub(event.PostTotalSupply, preTotalSupply), event.Timestamp)
+		events = append(events, event)
+		if i < n-1 {
+			previous = copyAmounts(t.balances)
+		}
+	}
+	return events, nil
+}
+
+// rebasePartner returns the other token an action changes besides the one rebased: the
+// acquirer of a StockMerger or the child of a SpinOffAction. It is nil for every other action.
+func rebasePartner(action RebaseAction) *StockToken {
 	switch v := action.(type) {
-	case uint64:
-		// Handle stock split
-		multiplier := big.NewInt(int64(v))
+	case StockMerger:
+		return v.Acquirer
+	case SpinOffAction:
+		return v.Child
+	default:
+		return nil
+	}
+}
 
-		// Update all balances for split
-		for address := range t.balances {
-			balance := t.balances[address]
-			newBalance := new(big.Int).Mul(balance, multiplier)
-			t.balances[address] = newBalance
+// announceRebase prints the dividends an action is about to pay. It is called before the
+// lock is taken so nothing is printed while holding it.
+func announceRebase(action RebaseAction) {
+	switch v := action.(type) {
+	case Dividend:
+		v.announce()
+	case CappedDividend:
+		v.Dividend.announce()
+	case DividendWithRecord:
+		v.Dividend.announce()
+	case CompoundDividend:
+		for _, dividend := range v.Dividends {
+			dividend.announce()
 		}
+	}
+}
+
+// announce prints the dividend amount and yield, skipping dividends that will be rejected
+func (d Dividend) announce() {
+	if d.validate() != nil {
+		return
+	}
 
-		t.rebaseMultiplier = multiplier
+	divAmt, _ := d.cashAmount.Float64()
+	sharePrice, _ := d.sharePrice.Float64()
+	divYield := divAmt / sharePrice
+	fmt.Printf("\nSimulating $%.2f dividend at share price of $%.2f (Yield: %0.2f%%)...\n", divAmt/100, sharePrice/100, divYield*100)
+}
+
+// applyAction applies a supported rebase action. It may leave the ledger partly changed if
+// the action fails or panics, so the caller must take a copyLedger snapshot first and restore
+// it on failure. The caller must hold t.mu.
+func (t *StockToken) applyAction(action RebaseAction) error {
+	t.checkpointAll()
+	preTotalSupply := new(big.Int).Set(t.totalSupply)
+	switch v := action.(type) {
+	case StockSplit:
+		if err := t.applySplit(v); err != nil {
+			return err
+		}
+		t.splitCount++
 
 	case Dividend:
-		// Let's use higher precision (10^6 = 1M) to handle small numbers
-		precisionFactor := big.NewInt(basePrecision)
+		if err := v.validate(); err != nil {
+			return err
+		}
+		t.applyDividend(v, nil, nil)
+		t.dividendCount++
+
+	case CappedDividend:
+		if v.MaxSharesPerHolder == nil || v.MaxSharesPerHolder.Sign() < 0 {
+			return fmt.Errorf("%w: dividend cap must be non-negative", ErrInvalidAmount)
+		}
+		if err := v.Dividend.validate(); err != nil {
+			return err
+		}
+		t.applyDividend(v.Dividend, v.MaxSharesPerHolder, nil)
+		t.dividendCount++
+
+	case DividendWithRecord:
+		if err := v.Dividend.validate(); err != nil {
+			return err
+		}
+		if err := t.checkSnapshot(v.RecordSnapshotID); err != nil {
+			return err
+		}
+		balances, staked := t.snapshotLedger(v.RecordSnapshotID)
+		t.applyDividend(v.Dividend, nil, &ledgerRecord{balances, staked})
+		t.dividendCount++
+
+	case CompoundDividend:
+		for _, dividend := range v.Dividends {
+			if err := dividend.validate(); err != nil {
+				return err
+			}
+		}
+
+		// Each dividend compounds on the balances left by the previous one
+		for _, dividend := range v.Dividends {
+			t.applyDividend(dividend, nil, nil)
+		}
+		t.dividendCount += len(v.Dividends)
+
+	case ReturnOfCapital:
+		if err := t.applyReturnOfCapital(v); err != nil {
+			return err
+		}
+
+	case StockMerger:
+		if _, err := applyMerger(t, v.Acquirer, v.ExchangeRatio); err != nil {
+			return err
+		}
+
+	case DilutionAction:
+		if err := t.applyDilution(v); err != nil {
+			return err
+		}
+
+	case UniformSplitAction:
+		if err := t.applyUniformSplit(v); err != nil {
+			return err
+		}
+
+	case SpinOffAction:
+		if err := spinoff(t, v.Child, v.Ratio); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unsupported rebase action %T", action)
+	}
+
+	// Dividend shares are only known once paid, so growth is checked against the cap afterwards
+	if t.totalSupply.Cmp(preTotalSupply) > 0 {
+		return t.checkSupplyCap(big.NewInt(0))
+	}
+	return nil
+}
+
+// applySplit scales every balance, staked or not, by Numerator/Denominator and the share price by the inverse.
+// Balances are rounded down; the shares lost to rounding are credited to the dust address so
+// totalSupply stays exactly totalSupply * Numerator / Denominator.
+func (t *StockToken) applySplit(v StockSplit) error {
+	if v.Numerator == nil || v.Numerator.Sign() <= 0 || v.Denominator == nil || v.Denominator.Sign() <= 0 {
+		return fmt.Errorf("%w: split ratio must be positive", ErrInvalidAmount)
+	}
+
+	newSupply := new(big.Int).Mul(t.totalSupply, v.Numerator)
+	newSupply.Div(newSupply, v.Denominator)
+	if err := t.checkSupplyCap(new(big.Int).Sub(newSupply, t.totalSupply)); err != nil {
+		return err
+	}
+
+	distributed := big.NewInt(0)
+	for _, balances := range []map[string]*big.Int{t.balances, t.stakedBalances} {
+		for _, balance := range balances {
+			balance.Mul(balance, v.Numerator)
+			balance.Div(balance, v.Denominator)
+			distributed.Add(distributed, balance)
+		}
+	}
+	// A reverse split can round small balances down to nothing; their shares go to the dust
+	// address below, and the holders are removed
+	pruneZeroBalances(t.balances, &t.holders)
+	for address, staked := range t.stakedBalances {
+		if staked.Sign() == 0 {
+			delete(t.stakedBalances, address)
+		}
+	}
+
+	if dust := new(big.Int).Sub(newSupply, distributed); dust.Sign() > 0 {
+		t.credit(t.dustHolder(), dust)
+	}
+	t.totalSupply = newSupply
+
+	// Price moves the opposite way: a 1-for-4 reverse split quadruples it
+	price := new(big.Int).Mul(t.sharePrice, v.Denominator)
+	t.sharePrice = price.Div(price, v.Numerator)
+
+	t.scaleMultiplier(v.Numerator, v.Denominator)
+	scaleAllowances(t.allowances, v.Numerator, v.Denominator)
+	t.scaleVesting(v.Numerator, v.Denominator)
+	return nil
+}
+
+// scaleMultiplier folds a balance scaling of num/den into the cumulative multiplier. A new
+// value is stored rather than updating in place, so saved copies are not changed.
+func (t *StockToken) scaleMultiplier(num, den *big.Int) {
+	t.rebaseMultiplier = new(big.Rat).Mul(t.rebaseMultiplier, new(big.Rat).SetFrac(num, den))
+}
+
+// CumulativeMultiplier returns the exact factor by which balances have been scaled since
+// genesis by splits, dividends and returns of capital, before rounding. Multiplying a genesis
+// share count by it gives the current number of tokens.
+func (t *StockToken) CumulativeMultiplier() *big.Rat {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return new(big.Rat).Set(t.rebaseMultiplier)
+}
+
+// RebaseCount returns the number of rebases applied
+func (t *StockToken) RebaseCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.rebaseCount
+}
+
+// SplitCount returns the number of stock splits applied, forward or reverse
+func (t *StockToken) SplitCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.splitCount
+}
+
+// DividendCount returns the number of dividends applied, counting each dividend in a CompoundDividend
+func (t *StockToken) DividendCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.dividendCount
+}
+
+// RebaseWithID applies an action at most once per actionID, so a redelivered action is not applied twice
+func (t *StockToken) RebaseWithID(action RebaseAction, actionID string) error {
+	if actionID == "" {
+		return errors.New("action id is empty")
+	}
+
+	t.mu.Lock()
+	if t.appliedActions[actionID] {
+		t.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDuplicateAction, actionID)
+	}
+	if t.appliedActions == nil {
+		t.appliedActions = make(map[string]bool)
+	}
+	// Claim the id up front so a concurrent redelivery is rejected while this one applies
+	t.appliedActions[actionID] = true
+	t.mu.Unlock()
+
+	if err := t.Rebase(action); err != nil {
+		t.mu.Lock()
+		delete(t.appliedActions, actionID)
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// applyReturnOfCapital reduces every balance, staked or not, by balance * amountPerShare / sharePrice
+func (t *StockToken) applyReturnOfCapital(v ReturnOfCapital) error {
+	if v.AmountPerShareCents == nil || v.AmountPerShareCents.Sign() <= 0 || v.AmountPerShareCents.Cmp(t.sharePrice) >= 0 {
+		return fmt.Errorf("%w: return of capital must be positive and below the share price", ErrInvalidAmount)
+	}
+
+	for _, balances := range []map[string]*big.Int{t.balances, t.stakedBalances} {
+		for _, balance := range balances {
+			reduction := new(big.Int).Mul(balance, v.AmountPerShareCents)
+			reduction.Div(reduction, t.sharePrice)
+
+			balance.Sub(balance, reduction)
+			t.totalSupply.Sub(t.totalSupply, reduction)
+		}
+	}
+
+	// Balances shrink by (price - amount) / price
+	remaining := new(big.Int).Sub(t.sharePrice, v.AmountPerShareCents)
+	t.scaleMultiplier(remaining, t.sharePrice)
+	scaleAllowances(t.allowances, remaining, t.sharePrice)
+	t.scaleVesting(remaining, t.sharePrice)
+	return nil
+}
+
+// CompoundRebase applies the same action n times, e.g. to backtest years of quarterly dividends.
+// All n applications are made under one lock and recorded as n history entries; if any fails
+// or panics, the token is left as it was before the first one. OnRebase and rebase subscribers
+// are only notified once all n have been committed.
+func (t *StockToken) CompoundRebase(action RebaseAction, n int) (err error) {
+	if n <= 0 {
+		return fmt.Errorf("%w: rebase count must be positive", ErrInvalidAmount)
+	}
+	action, err = t.refreshDividendPrice(action)
+	if err != nil {
+		return err
+	}
+
+	announceRebase(action)
+	defer t.emitEvents()
+	if partner := rebasePartner(action); partner != nil {
+		defer partner.emitEvents()
+	}
+
+	events, err := t.compoundRebase(action, n)
+	if err != nil {
+		return err
+	}
+	t.afterRebase(action, events)
+	return nil
+}
+
+// compoundRebase is rebase reporting a panic as an error, since nothing has been changed by
+// the time it is recovered
+func (t *StockToken) compoundRebase(action RebaseAction, n int) (events []RebaseEvent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("compound rebase failed: %v", r)
+		}
+	}()
+	return t.rebase(action, n)
+}
+
+// ledgerRecord is the balances and staked balances of record for a DividendWithRecord
+type ledgerRecord struct {
+	balances map[string]*big.Int
+	staked   map[string]*big.Int
+}
 
-		// Convert cash dividend to equivalent shares at current price
-		// ($1.50 / $100.00) = 0.015
-		shareRatio := new(big.Int).Mul(precisionFactor, v.cashAmount)
-		shareRatio.Div(shareRatio, v.sharePrice)
+// applyDividend reinvests a cash dividend as additional shares for every holder. If
+// maxPerHolder is not nil, any holder's shares above it are paid to CapOverflowAddress instead.
+// Staked balances earn their shares scaled by YieldMultiplier, which stay staked. If record is
+// not nil, entitlements are calculated from its balances and staked balances instead of the
+// live ones, and all the shares are credited to the live unstaked balances.
+func (t *StockToken) applyDividend(v Dividend, maxPerHolder *big.Int, record *ledgerRecord) {
+	// Work at the token's precision to handle small numbers
+	precisionFactor := t.Precision
+
+	// Convert cash dividend to equivalent shares at current price
+	// ($1.50 / $100.00) = 0.015
+	shareRatio := new(big.Int).Mul(precisionFactor, v.cashAmount)
+	shareRatio.Div(shareRatio, v.sharePrice)
+
+	// Update all balances for cash dividend
+	holders, addresses, staked := t.balances, []string(t.holders), t.stakedBalances
+	if record != nil {
+		holders, addresses, staked = record.balances, sortedAddresses(record.balances), record.staked
+	}
+
+	overflow := big.NewInt(0)
+	entitlement := func(address string, dividendShares *big.Int) *big.Int {
+		if maxPerHolder != nil && dividendShares.Cmp(maxPerHolder) > 0 {
+			overflow.Add(overflow, new(big.Int).Sub(dividendShares, maxPerHolder))
+			dividendShares.Set(maxPerHolder)
+		}
+		dividendShares = t.withholdTax(address, dividendShares)
+		t.totalSupply.Add(t.totalSupply, dividendShares)
+		return dividendShares
+	}
 
-		divAmt, _ := v.cashAmount.Float64()
-		sharePrice, _ := v.sharePrice.Float64()
-		divYield := divAmt / sharePrice
-		fmt.Printf("\nSimulating $%.2f dividend at share price of $%.2f (Yield: %0.2f%%)...\n", divAmt/100, sharePrice/100, divYield*100)
+	for _, address := range addresses {
+		balance := holders[address]
 
-		// Update all balances for cash dividend
-		for address := range t.balances {
-			balance := t.balances[address]
+		// Calculate dividend shares with proper precision
+		dividendShares := new(big.Int).Mul(balance, shareRatio)
+		dividendShares.Div(dividendShares, precisionFactor)
+		dividendShares = entitlement(address, dividendShares)
+		if dividendShares.Sign() == 0 {
+			continue
+		}
 
-			// Calculate dividend shares with proper precision
-			dividendShares := new(big.Int).Mul(balance, shareRatio)
-			dividendShares.Div(dividendShares, precisionFactor)
+		// Add the dividend shares to the balance
+		t.credit(address, dividendShares)
+	}
 
-			// Add the dividend shares to the balance
-			t.balances[address].Add(t.balances[address], dividendShares)
+	// Staked balances earn the yield multiplier on their shares
+	for _, address := range sortedAddresses(staked) {
+		dividendShares := new(big.Int).Mul(staked[address], shareRatio)
+		dividendShares.Div(dividendShares, precisionFactor)
+		dividendShares = entitlement(address, t.stakingYield(dividendShares))
+		if record != nil {
+			t.credit(address, dividendShares)
+		} else {
+			staked[address].Add(staked[address], dividendShares)
 		}
 	}
+
+	// Balances grow by (precision + shareRatio) / precision
+	growth := new(big.Int).Add(precisionFactor, shareRatio)
+	t.scaleMultiplier(growth, precisionFactor)
+	scaleAllowances(t.allowances, growth, precisionFactor)
+	t.scaleVesting(growth, precisionFactor)
+
+	if overflow.Sign() > 0 {
+		t.credit(CapOverflowAddress, overflow)
+		t.totalSupply.Add(t.totalSupply, overflow)
+	}
 }
 
 // OndoWrappedStock represents a non-rebasing wrapper token
 type OndoWrappedStock struct {
+	mu sync.RWMutex // guards every field below except ticker and Precision, which never change
+
+	// Precision is the number of raw units per whole wrapped token and the scale of the
+	// exchange rate. It matches the precision of the wrapped token.
+	Precision *big.Int
+
+	// Token metadata copied from the underlying token by NewOndoWrappedStock
+	Name     string
+	Symbol   string
+	Decimals uint
+
 	ticker       string
 	totalSupply  *big.Int
 	balances     map[string]*big.Int
+	holders      holderIndex
 	exchangeRate *big.Int
+	treasury     string // receives the underlying backing burned wrapped tokens
+
+	allowances map[string]map[string]*big.Int // owner -> spender -> wrapped amount
+
+	// Protocol fee taken from the underlying on every wrap and unwrap. Set with SetFee.
+	FeeBasisPoints uint64
+	FeeRecipient   string
+	// Fee deducted from every wrapped transfer and paid to FeeRecipient in wrapped tokens. Set
+	// with SetTransferFee.
+	TransferFeeBps uint64
+
+	// DefaultRoundingMode rounds the underlying paid out by Unwrap. The zero value, RoundDown,
+	// leaves the remainder in the wrapper as dust. Set it before using the wrapper.
+	DefaultRoundingMode RoundingMode
+	roundingDust        *big.Int // exact unwrap amounts less payouts, in 1/Precision raw units
+
+	// RateHistory holds the exchange rates recorded by UpdateExchangeRate, oldest first. Only
+	// the newest MaxRateHistory entries are kept; zero or less keeps them all. Set
+	// MaxRateHistory before using the wrapper.
+	RateHistory    []RateEntry
+	MaxRateHistory int
+
+	// Clock timestamps the wrapper's events. NewOndoWrappedStock copies the underlying's Clock,
+	// and nil uses the system clock. Set it before using the wrapper.
+	Clock Clock
+
+	// EventLog records every state change, appended when events are delivered to the hooks
+	*EventLog
+	hooks eventHooks
 }
 
-// NewOndoWrappedStock creates a new wrapper token contract
-func NewOndoWrappedStock(ticker string) *OndoWrappedStock {
+// NewOndoWrappedStock creates a new wrapper token contract for underlying, with the same
+// decimals. Its name and symbol are the underlying's prefixed with "Ondo Wrapped " and "ow",
+// taken once here, so later changes to the underlying's metadata do not carry over.
+func NewOndoWrappedStock(underlying *StockToken) *OndoWrappedStock {
+	meta := underlying.Metadata()
+	scale := PrecisionFromDecimals(meta.Decimals)
+	log := newEventLog()
 	return &OndoWrappedStock{
-		ticker:       fmt.Sprintf("ow%s", ticker),
-		totalSupply:  big.NewInt(0),
-		balances:     make(map[string]*big.Int),
-		exchangeRate: big.NewInt(basePrecision),
+		Precision:      scale,
+		Name:           "Ondo Wrapped " + meta.Name,
+		Symbol:         "ow" + meta.Symbol,
+		Decimals:       meta.Decimals,
+		ticker:         fmt.Sprintf("ow%s", underlying.ticker),
+		totalSupply:    big.NewInt(0),
+		balances:       make(map[string]*big.Int),
+		exchangeRate:   new(big.Int).Set(scale),
+		MaxRateHistory: defaultMaxRateHistory,
+		Clock:          underlying.Clock,
+		EventLog:       log,
+		hooks:          eventHooks{log: log},
 	}
 }
 
-// Wrap converts TSLA tokens to owTSLA tokens
-func (ow *OndoWrappedStock) Wrap(st *StockToken, from string, amount *big.Int) {
-	if st.balances[from].Cmp(amount) < 0 {
-		panic("Insufficient TSLA balance")
+// Wrap converts TSLA tokens to owTSLA tokens. It fails with ErrSlippageExceeded, changing
+// nothing, if fewer than minOut wrapped tokens would be minted; a nil or zero minOut disables
+// the check.
+func (ow *OndoWrappedStock) Wrap(st *StockToken, from string, amount, minOut *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: wrap amount must be positive", ErrInvalidAmount)
 	}
 
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	_, err := ow.wrap(st, from, amount, minOut)
+	return err
+}
+
+// wrap moves amount of from's underlying into the wrapper and returns the wrapped amount
+// minted to from, failing if that is below minOut. The caller must hold both st.mu and ow.mu.
+func (ow *OndoWrappedStock) wrap(st *StockToken, from string, amount, minOut *big.Int) (*big.Int, error) {
+	if err := st.checkAddresses(from); err != nil {
+		return nil, err
+	}
+	if st.isPaused {
+		return nil, ErrTokenPaused
+	}
+	if st.floorBreached() {
+		return nil, ErrFloorPriceBreached
+	}
+	now := st.now()
+	if err := st.checkTransferRestriction(from, now); err != nil {
+		return nil, err
+	}
+	// No balance can exceed the cap, so a larger amount is refused before it is scaled up
+	if st.maxSupply != nil && amount.Cmp(st.maxSupply) > 0 {
+		return nil, fmt.Errorf("%w: cannot wrap more than the %s cap of %s", ErrSupplyCap, st.ticker, formatTokens(st.maxSupply, st.Precision))
+	}
+	if err := st.checkVesting(from, amount, now); err != nil {
+		return nil, err
+	}
+	if st.balances[from] == nil || st.balances[from].Cmp(amount) < 0 {
+		return nil, fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, from, st.ticker, formatTokens(amount, st.Precision))
+	}
+
+	// The protocol fee is taken out of the underlying before it reaches the wrapper
+	fee := ow.protocolFee(amount)
+	deposit := new(big.Int).Sub(amount, fee)
+
 	// Calculate owTSLA amount based on current exchange rate
-	owAmount := new(big.Int).Mul(amount, big.NewInt(basePrecision))
+	owAmount := new(big.Int).Mul(deposit, ow.Precision)
 	owAmount.Div(owAmount, ow.exchangeRate)
+	if minOut != nil && owAmount.Cmp(minOut) < 0 {
+		return nil, fmt.Errorf("%w: wrapping gives %s %s, below the minimum of %s", ErrSlippageExceeded, formatTokens(owAmount, ow.Precision), ow.ticker, formatTokens(minOut, ow.Precision))
+	}
 
 	// Transfer TSLA to wrapper contract
-	st.balances[from].Sub(st.balances[from], amount)
-	if st.balances[ow.ticker] == nil {
-		st.balances[ow.ticker] = big.NewInt(0)
+	st.debit(from, amount)
+	st.credit(ow.ticker, deposit)
+	if fee.Sign() > 0 {
+		st.credit(ow.FeeRecipient, fee)
+		st.hooks.record("transfer", from, ow.FeeRecipient, fee, st.now())
 	}
-	st.balances[ow.ticker].Add(st.balances[ow.ticker], amount)
 
 	// Mint owTSLA to user
-	if ow.balances[from] == nil {
-		ow.balances[from] = big.NewInt(0)
-	}
-	ow.balances[from].Add(ow.balances[from], owAmount)
+	ow.credit(from, owAmount)
 	ow.totalSupply.Add(ow.totalSupply, owAmount)
+
+	st.hooks.record("transfer", from, ow.ticker, deposit, st.now())
+	ow.hooks.record("mint", "", from, owAmount, ow.now())
+	return owAmount, nil
+}
+
+// Unwrap converts owTSLA tokens back to TSLA tokens, rounding the underlying released with
+// DefaultRoundingMode. It fails with ErrSlippageExceeded, changing nothing, if less than minOut
+// of the underlying would be paid to to after fees; a nil or zero minOut disables the check.
+func (ow *OndoWrappedStock) Unwrap(st *StockToken, to string, owAmount, minOut *big.Int) error {
+	if owAmount == nil || owAmount.Sign() <= 0 {
+		return fmt.Errorf("%w: unwrap amount must be positive", ErrInvalidAmount)
+	}
+
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return ow.unwrap(st, to, owAmount, minOut)
 }
 
-// Unwrap converts owTSLA tokens back to TSLA tokens
-func (ow *OndoWrappedStock) Unwrap(st *StockToken, to string, owAmount *big.Int) {
+// unwrap burns owAmount of the contract's wrapped tokens and releases the underlying to to.
+// It fails if less than minOut would be paid out. The caller must hold both st.mu and ow.mu.
+func (ow *OndoWrappedStock) unwrap(st *StockToken, to string, owAmount, minOut *big.Int) error {
+	if err := st.checkAddresses(to); err != nil {
+		return err
+	}
+	if st.isPaused {
+		return ErrTokenPaused
+	}
+	if st.floorBreached() {
+		return ErrFloorPriceBreached
+	}
+
 	// Check the balance of the contract
 	contractAddr := "0xCONTRACT"
 	if ow.balances[contractAddr] == nil || ow.balances[contractAddr].Cmp(owAmount) < 0 {
-		panic(fmt.Sprintf("Insufficient owTSLA balance for %s", contractAddr))
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, contractAddr, ow.ticker, formatTokens(owAmount, ow.Precision))
 	}
 
-	// Calculate TSLA amount based on current exchange rate
-	tslaAmount := new(big.Int).Mul(owAmount, ow.exchangeRate)
-	tslaAmount.Div(tslaAmount, big.NewInt(basePrecision))
+	// Calculate TSLA amount based on current exchange rate, rounded with the wrapper's mode
+	exact := new(big.Int).Mul(owAmount, ow.exchangeRate)
+	tslaAmount := divRound(exact, ow.Precision, ow.DefaultRoundingMode)
+	if st.balances[ow.ticker] == nil || st.balances[ow.ticker].Cmp(tslaAmount) < 0 {
+		return fmt.Errorf("%w: wrapper holds less than %s %s", ErrInsufficientBalance, formatTokens(tslaAmount, st.Precision), st.ticker)
+	}
+	fee := ow.protocolFee(tslaAmount)
+	payout := new(big.Int).Sub(tslaAmount, fee)
+	if minOut != nil && payout.Cmp(minOut) < 0 {
+		return fmt.Errorf("%w: unwrapping gives %s %s, below the minimum of %s", ErrSlippageExceeded, formatTokens(payout, st.Precision), st.ticker, formatTokens(minOut, st.Precision))
+	}
 
 	// Burn owTSLA from contract
-	ow.balances[contractAddr].Sub(ow.balances[contractAddr], owAmount)
+	ow.debit(contractAddr, owAmount)
 	ow.totalSupply.Sub(ow.totalSupply, owAmount)
+	if ow.roundingDust == nil {
+		ow.roundingDust = big.NewInt(0)
+	}
+	ow.roundingDust.Add(ow.roundingDust, exact.Sub(exact, new(big.Int).Mul(tslaAmount, ow.Precision)))
+
+	// Transfer TSLA from wrapper contract to recipient, less the protocol fee
+	st.debit(ow.ticker, tslaAmount)
+	st.credit(to, payout)
+
+	ow.hooks.record("burn", contractAddr, "", owAmount, ow.now())
+	st.hooks.record("transfer", ow.ticker, to, payout, st.now())
+	if fee.Sign() > 0 {
+		st.credit(ow.FeeRecipient, fee)
+		st.hooks.record("transfer", ow.ticker, ow.FeeRecipient, fee, st.now())
+	}
+	return nil
+}
+
+// SetTreasury sets the address that receives the underlying tokens released by Burn
+func (ow *OndoWrappedStock) SetTreasury(address string) error {
+	if address == "" || address == ow.ticker {
+		return errors.New("invalid treasury address")
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.treasury = address
+	return nil
+}
+
+// Burn destroys amount of an address's wrapped tokens. The underlying tokens backing them are
+// moved from the wrapper to the treasury so they are not locked in the wrapper forever.
+func (ow *OndoWrappedStock) Burn(st *StockToken, address string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: burn amount must be positive", ErrInvalidAmount)
+	}
+
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	if st.isPaused {
+		return ErrTokenPaused
+	}
+	if ow.treasury == "" {
+		return errors.New("no treasury configured for burned collateral")
+	}
+	balance := ow.balances[address]
+	if balance == nil || balance.Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, address, ow.ticker, formatTokens(amount, ow.Precision))
+	}
 
-	// Transfer TSLA from wrapper contract to recipient
-	st.balances[ow.ticker].Sub(st.balances[ow.ticker], tslaAmount)
-	if st.balances[to] == nil {
-		st.balances[to] = big.NewInt(0)
+	// Underlying released at the current exchange rate
+	underlying := new(big.Int).Mul(amount, ow.exchangeRate)
+	underlying.Div(underlying, ow.Precision)
+	if st.balances[ow.ticker] == nil || st.balances[ow.ticker].Cmp(underlying) < 0 {
+		return fmt.Errorf("%w: wrapper holds less than %s %s", ErrInsufficientBalance, formatTokens(underlying, st.Precision), st.ticker)
 	}
-	st.balances[to].Add(st.balances[to], tslaAmount)
+
+	ow.debit(address, amount)
+	ow.totalSupply.Sub(ow.totalSupply, amount)
+	st.debit(ow.ticker, underlying)
+	st.credit(ow.treasury, underlying)
+
+	ow.hooks.record("burn", address, "", amount, ow.now())
+	st.hooks.record("transfer", ow.ticker, ow.treasury, underlying, st.now())
+	return nil
 }
 
-// UpdateExchangeRate recalculates the exchange rate after rebases
+// UpdateExchangeRate recalculates the exchange rate after rebases and records it in RateHistory,
+// timestamped by tsla's Clock
 func (ow *OndoWrappedStock) UpdateExchangeRate(tsla *StockToken) {
+	tsla.mu.RLock()
+	defer tsla.mu.RUnlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
 	if ow.totalSupply.Sign() == 0 {
 		return // No tokens wrapped, keep exchange rate as is
 	}
+	// The wrapper has no balance entry once its custody is emptied. Keep the rate rather than
+	// set it to zero, which wrapping would divide by.
+	custody := tsla.balances[ow.ticker]
+	if custody == nil {
+		return
+	}
 
-	// New exchange rate = (TSLA balance in wrapper * basePrecision) / owTSLA total supply
-	ow.exchangeRate = new(big.Int).Mul(tsla.balances[ow.ticker], big.NewInt(basePrecision))
+	// New exchange rate = (TSLA balance in wrapper * Precision) / owTSLA total supply. Wrapped
+	// balances and allowances are unchanged.
+	ow.exchangeRate = new(big.Int).Mul(custody, ow.Precision)
 	ow.exchangeRate.Div(ow.exchangeRate, ow.totalSupply)
+	ow.recordRate(tsla.now())
+}
+
+// RebasePassthrough rebases the underlying token and updates the exchange rate in one call
+func (ow *OndoWrappedStock) RebasePassthrough(st *StockToken, action RebaseAction) error {
+	if st == nil {
+		return errors.New("underlying token is nil")
+	}
+
+	if err := st.Rebase(action); err != nil {
+		return err
+	}
+	ow.UpdateExchangeRate(st)
+	return nil
+}
+
+// RescueTokens sends the wrapper's whole balance of a token that was sent to it by mistake to to.
+// The wrapper's own underlying collateral can never be rescued.
+func (ow *OndoWrappedStock) RescueTokens(st *StockToken, token *StockToken, to string) error {
+	if st == nil || token == nil {
+		return errors.New("token is nil")
+	}
+	if token == st || token.ticker == st.ticker {
+		return ErrCannotRescueUnderlying
+	}
+	if to == "" {
+		return errors.New("rescue address is empty")
+	}
+
+	defer token.emitEvents()
+	token.mu.Lock()
+	defer token.mu.Unlock()
+	stuck := token.balances[ow.ticker]
+	if stuck == nil || stuck.Sign() == 0 {
+		return fmt.Errorf("no %s held by %s", token.ticker, ow.ticker)
+	}
+
+	token.credit(to, stuck)
+	token.removeBalance(ow.ticker)
+	token.hooks.record("transfer", ow.ticker, to, stuck, token.now())
+	return nil
+}
+
+// EmergencyDrain moves all underlying collateral out of the wrapper to a safe address and wipes
+// every wrapped balance. It returns the amount of underlying drained, which is also recorded in
+// the wrapper's event log as "emergency_drain".
+func (ow *OndoWrappedStock) EmergencyDrain(st *StockToken, to string) (amount *big.Int, err error) {
+	if st == nil {
+		return nil, errors.New("underlying token is nil")
+	}
+	if to == "" || to == ow.ticker {
+		return nil, errors.New("invalid drain address")
+	}
+
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	drained := ow.drain(st, to)
+	ow.EventLog.append("emergency_drain", ow.now(), map[string]string{
+		"to":     to,
+		"amount": drained.String(),
+	})
+	return drained, nil
+}
+
+// drain performs EmergencyDrain under both token locks and returns the amount drained
+func (ow *OndoWrappedStock) drain(st *StockToken, to string) *big.Int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	drained := big.NewInt(0)
+	if st.balances[ow.ticker] != nil {
+		drained.Set(st.balances[ow.ticker])
+	}
+
+	// An empty wrapper has nothing to move, and crediting zero would list to as a holder
+	if drained.Sign() > 0 {
+		st.removeBalance(ow.ticker)
+		st.credit(to, drained)
+		st.hooks.record("transfer", ow.ticker, to, drained, st.now())
+	}
+
+	for _, address := range ow.holders {
+		if balance := ow.balances[address]; balance.Sign() > 0 {
+			ow.hooks.record("burn", address, "", balance, ow.now())
+		}
+	}
+	ow.setBalances(make(map[string]*big.Int))
+	ow.totalSupply = big.NewInt(0)
+	ow.exchangeRate = new(big.Int).Set(ow.Precision)
+	ow.roundingDust = nil
+	return drained
+}
+
+// Transfer moves wrapped tokens between two addresses
+func (ow *OndoWrappedStock) Transfer(from, to string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+
+	defer ow.emitEvents()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return ow.transfer(from, to, amount)
+}
+
+// transfer moves wrapped tokens between two addresses. The transfer fee is deducted from the
+// amount to receives and paid to FeeRecipient. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) transfer(from, to string, amount *big.Int) error {
+	if ow.balances[from] == nil || ow.balances[from].Cmp(amount) < 0 {
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, from, ow.ticker, formatTokens(amount, ow.Precision))
+	}
+
+	ow.debit(from, amount)
+	fee := ow.transferFee(amount)
+	received := new(big.Int).Sub(amount, fee)
+	if received.Sign() > 0 {
+		ow.credit(to, received)
+		ow.hooks.record("transfer", from, to, received, ow.now())
+	}
+	if fee.Sign() > 0 {
+		ow.credit(ow.FeeRecipient, fee)
+		ow.hooks.record("transfer", from, ow.FeeRecipient, fee, ow.now())
+	}
+	return nil
 }
 
-func (ow *OndoWrappedStock) Transfer(from, to string, amount *big.Int) {
-	if ow.balances[from].Cmp(amount) < 0 {
-		panic("Insufficient balance")
+// BatchTransfer sends wrapped tokens from one address to many. Every amount is validated
+// against from's balance before any transfer is applied, so either all succeed or none do.
+// The transfer fee is deducted from each recipient's amount.
+func (ow *OndoWrappedStock) BatchTransfer(from string, recipients map[string]*big.Int) error {
+	if len(recipients) == 0 {
+		return errors.New("no recipients")
+	}
+
+	total := big.NewInt(0)
+	for to, amount := range recipients {
+		if to == "" {
+			return errors.New("empty recipient address")
+		}
+		if amount == nil || amount.Sign() <= 0 {
+			return fmt.Errorf("%w: transfer to %s must be positive", ErrInvalidAmount, to)
+		}
+		total.Add(total, amount)
 	}
 
-	if ow.balances[to] == nil {
-		ow.balances[to] = big.NewInt(0)
+	defer ow.emitEvents()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	if ow.balances[from] == nil || ow.balances[from].Cmp(total) < 0 {
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, from, ow.ticker, formatTokens(total, ow.Precision))
 	}
 
-	ow.balances[from].Sub(ow.balances[from], amount)
-	ow.balances[to].Add(ow.balances[to], amount)
+	for _, to := range sortedAddresses(recipients) {
+		if err := ow.transfer(from, to, recipients[to]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Interact handles token transfers, automatically wrapping if sending to a contract
-func (t *StockToken) Interact(from, to string, amount *big.Int, ows *OndoWrappedStock) {
-	fmt.Printf("Transferring %s%s from %s to %s\n", formatTokens(amount), t.ticker, from, to)
+func (t *StockToken) Interact(from, to string, amount *big.Int, ows *OndoWrappedStock) error {
+	defer t.emitEvents()
+	if ows != nil {
+		defer ows.emitEvents()
+	}
 
-	// Check if recipient is a contract
-	if strings.HasPrefix(to, "0xCONTRACT") {
-		// Auto-wrap and transfer
-		fmt.Println("Auto-wrapping tokens for contract interaction...")
-		ows.Wrap(t, from, amount)
+	wrapped, err := t.interact(from, to, amount, ows)
+	if err != nil {
+		return err
+	}
 
-		// Calculate wrapped amount based on current exchange rate
-		wrappedAmount := new(big.Int).Mul(amount, big.NewInt(basePrecision))
-		wrappedAmount.Div(wrappedAmount, ows.exchangeRate)
+	fmt.Printf("Transferring %s%s from %s to %s\n", formatTokens(amount, t.Precision), t.ticker, from, to)
+	if wrapped {
+		fmt.Println("Auto-wrapping tokens for contract interaction...")
+	}
+	return nil
+}
 
-		// Transfer wrapped tokens to contract
-		ows.Transfer(from, to, wrappedAmount)
-		return
+// interact performs Interact under the token locks and reports whether the tokens were wrapped
+func (t *StockToken) interact(from, to string, amount *big.Int, ows *OndoWrappedStock) (wrapped bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(from, to); err != nil {
+		return false, err
+	}
+	if err := t.checkTransfer(from, amount); err != nil {
+		return false, err
 	}
 
 	// Regular transfer for non-contract addresses
-	if t.balances[from].Cmp(amount) < 0 {
-		panic("Insufficient balance")
+	if !strings.HasPrefix(to, "0xCONTRACT") {
+		return false, t.transfer(from, to, amount)
+	}
+
+	// Auto-wrap and transfer the wrapped tokens to the contract
+	if ows == nil {
+		return false, errors.New("no wrapper to auto-wrap with")
+	}
+	ows.mu.Lock()
+	defer ows.mu.Unlock()
+	wrappedAmount, err := ows.wrap(t, from, amount, nil)
+	if err != nil {
+		return false, err
+	}
+	return true, ows.transfer(from, to, wrappedAmount)
+}
+
+// checkTransfer rejects transfers of non-positive amounts, while trading is halted by the
+// floor price, or out of an address that is still locked up. Vesting is checked by transfer,
+// once the fee the sender also pays is known.
+func (t *StockToken) checkTransfer(from string, amount *big.Int) error {
+	if amount == nil || amount.Sign() <= 0 {
+		return fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+	if t.isPaused {
+		return ErrTokenPaused
+	}
+	if t.floorBreached() {
+		return ErrFloorPriceBreached
 	}
+	return t.checkTransferRestriction(from, t.now())
+}
 
-	if t.balances[to] == nil {
-		t.balances[to] = big.NewInt(0)
+// transfer moves amount from one address to another, charging any transaction fee to the sender.
+// The caller must hold t.mu.
+func (t *StockToken) transfer(from, to string, amount *big.Int) error {
+	fee := t.transactionFee(amount)
+	required := new(big.Int).Add(amount, fee)
+	// The fee comes out of the sender's balance too, so it may not be paid from unvested tokens
+	if err := t.checkVesting(from, required, t.now()); err != nil {
+		return err
+	}
+	if t.balances[from] == nil || t.balances[from].Cmp(required) < 0 {
+		return fmt.Errorf("%w: %s %s balance is below %s", ErrInsufficientBalance, from, t.ticker, formatTokens(required, t.Precision))
+	}
+	if fee.Sign() > 0 && t.FeeRecipient == "" && len(t.feeSplits) == 0 {
+		return errors.New("transfer fee is set but no fee recipient is configured")
 	}
 
-	t.balances[from].Sub(t.balances[from], amount)
-	t.balances[to].Add(t.balances[to], amount)
+	t.debit(from, required)
+	t.credit(to, amount)
+	t.hooks.record("transfer", from, to, amount, t.now())
+
+	t.payFee(from, fee)
+	return nil
 }
 
 // Claim unwraps and transfers tokens from contract to user
-func (ow *OndoWrappedStock) Claim(st *StockToken, from, to string, wrappedAmount *big.Int) {
+func (ow *OndoWrappedStock) Claim(st *StockToken, from, to string, wrappedAmount *big.Int) error {
 	if !strings.HasPrefix(from, "0xCONTRACT") {
-		panic("Can only claim from contract addresses")
+		return fmt.Errorf("%w: %s", ErrNotContractAddress, from)
+	}
+	if wrappedAmount == nil || wrappedAmount.Sign() <= 0 {
+		return fmt.Errorf("%w: claim amount must be positive", ErrInvalidAmount)
+	}
+
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	claimed, underlyingAmount, exchangeRate, err := ow.claim(st, from, to, wrappedAmount)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Claiming %s wrapped tokens...\n", formatTokens(wrappedAmount, ow.Precision))
+	if claimed.Cmp(wrappedAmount) < 0 {
+		fmt.Printf("Attempting to claim more than available. Max available: %s\n", formatTokens(claimed, ow.Precision))
 	}
+	fmt.Printf("This will receive %s underlying tokens at current exchange rate of %s\n",
+		formatTokens(underlyingAmount, st.Precision),
+		formatTokens(exchangeRate, ow.Precision))
+	return nil
+}
 
-	fmt.Printf("Claiming %s wrapped tokens...\n", formatTokens(wrappedAmount))
+// claim unwraps up to wrappedAmount of from's wrapped tokens to to under both token locks.
+// It returns the wrapped amount claimed, the underlying released and the exchange rate used.
+func (ow *OndoWrappedStock) claim(st *StockToken, from, to string, wrappedAmount *big.Int) (claimed, underlyingAmount, exchangeRate *big.Int, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	if ow.balances[from] == nil || ow.balances[from].Sign() == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: %s holds no %s", ErrInsufficientBalance, from, ow.ticker)
+	}
 
 	// Check contract's wrapped token balance
-	if ow.balances[from] == nil || ow.balances[from].Cmp(wrappedAmount) < 0 {
-		fmt.Printf("Attempting to claim more than available. Max available: %s\n",
-			formatTokens(ow.balances[from]))
-		wrappedAmount = new(big.Int).Set(ow.balances[from])
+	claimed = wrappedAmount
+	if ow.balances[from].Cmp(wrappedAmount) < 0 {
+		claimed = new(big.Int).Set(ow.balances[from])
 	}
 
 	// Calculate underlying amount based on exchange rate
-	underlyingAmount := new(big.Int).Mul(wrappedAmount, ow.exchangeRate)
-	underlyingAmount.Div(underlyingAmount, big.NewInt(basePrecision))
-
-	fmt.Printf("This will receive %s underlying tokens at current exchange rate of %s\n",
-		formatTokens(underlyingAmount),
-		formatTokens(ow.exchangeRate))
+	underlyingAmount = new(big.Int).Mul(claimed, ow.exchangeRate)
+	underlyingAmount.Div(underlyingAmount, ow.Precision)
+	exchangeRate = new(big.Int).Set(ow.exchangeRate)
 
 	// Unwrap tokens directly to recipient
-	ow.Unwrap(st, to, wrappedAmount)
-}
-
-// Helper to display balances and values
-func displayBalances(st *StockToken, ow *OndoWrappedStock, userAddr, contractAddr string) {
-	fmt.Printf("\nShare price: $%.2f\n", float64(st.sharePrice.Int64())/100)
-
-	// User's base token balance
-	baseBalance := formatTokens(st.balances[userAddr])
-	baseValue := new(big.Int).Mul(st.balances[userAddr], st.sharePrice)
-	baseValue.Div(baseValue, big.NewInt(basePrecision))
-	fmt.Printf("%s balance: %s tokens ($%.2f)\n",
-		st.ticker,
-		baseBalance,
-		float64(baseValue.Int64())/100)
-
-	// Wrapper contract's base token balance
-	wrapperBalance := formatTokens(st.balances[ow.ticker])
-	wrapperValue := new(big.Int).Mul(st.balances[ow.ticker], st.sharePrice)
-	wrapperValue.Div(wrapperValue, big.NewInt(basePrecision))
-	fmt.Printf("%s balance in wrapper: %s tokens ($%.2f)\n",
-		st.ticker,
-		wrapperBalance,
-		float64(wrapperValue.Int64())/100)
-
-	// Contract's wrapped token balance
-	wrappedBalance := formatTokens(ow.balances[contractAddr])
-	wrappedValue := new(big.Int).Mul(ow.balances[contractAddr], st.sharePrice)
-	wrappedValue.Mul(wrappedValue, ow.exchangeRate)
-	wrappedValue.Div(wrappedValue, big.NewInt(basePrecision*basePrecision))
-	fmt.Printf("%s balance of contract: %s tokens ($%.2f)\n",
-		ow.ticker,
-		wrappedBalance,
-		float64(wrappedValue.Int64())/100)
-
-	fmt.Printf("Exchange rate: %s\n", formatTokens(ow.exchangeRate))
+	if err := ow.unwrap(st, to, claimed, nil); err != nil {
+		return nil, nil, nil, err
+	}
+	return claimed, underlyingAmount, exchangeRate, nil
+}
+
+// PartialClaim claims fraction (0 < fraction <= 1) of a contract's wrapped balance, rounded down
+func (ow *OndoWrappedStock) PartialClaim(st *StockToken, from, to string, fraction *big.Rat) error {
+	if fraction == nil || fraction.Sign() <= 0 || fraction.Cmp(big.NewRat(1, 1)) > 0 {
+		return fmt.Errorf("%w: claim fraction must be in (0, 1]", ErrInvalidAmount)
+	}
+	if !strings.HasPrefix(from, "0xCONTRACT") {
+		return fmt.Errorf("%w: %s", ErrNotContractAddress, from)
+	}
+
+	ow.mu.RLock()
+	balance := new(big.Int)
+	if ow.balances[from] != nil {
+		balance.Set(ow.balances[from])
+	}
+	ow.mu.RUnlock()
+	if balance.Sign() == 0 {
+		return fmt.Errorf("no %s to claim for %s", ow.ticker, from)
+	}
+
+	wrappedAmount := new(big.Int).Mul(balance, fraction.Num())
+	wrappedAmount.Div(wrappedAmount, fraction.Denom())
+	if wrappedAmount.Sign() == 0 {
+		return fmt.Errorf("%w: claim fraction rounds down to zero", ErrInvalidAmount)
+	}
+
+	// Claim clamps to the balance at the time it runs, in case it shrank since it was read
+	return ow.Claim(st, from, to, wrappedAmount)
 }
 
 func main() {
 	// Initialize tokens
-	stockToken := NewStockToken("TSLA")
-	owStock := NewOndoWrappedStock("TSLA")
+	stockToken, err := NewStockToken("TSLA", "Tesla, Inc.", defaultDecimals, "$100.00", "0xTREASURY")
+	must(err)
+	stockToken.LaxAddressValidation = true // the demo uses shorthand addresses
+	owStock := NewOndoWrappedStock(stockToken)
 
 	reece := "0xREECE"
 	contract := "0xCONTRACT"
-	stockToken.Mint(reece, 10)
+	must(stockToken.Mint(reece, 10))
 
-	sharePrice := float64(stockToken.sharePrice.Int64()) / 100
-	dollarValueOfBalance := (float64(stockToken.balances[reece].Int64()) / basePrecision) * sharePrice
-	fmt.Printf("Initial %s balance for %s: %s tokens ($%.2f)\n", stockToken.ticker, reece, formatTokens(stockToken.balances[reece]), dollarValueOfBalance)
+	sharePrice := float64(stockToken.SharePrice().Int64()) / 100
+	dollarValueOfBalance := (float64(stockToken.BalanceOf(reece).Int64()) / float64(stockToken.Precision.Int64())) * sharePrice
+	fmt.Printf("Initial %s balance for %s: %s tokens ($%.2f)\n", stockToken.ticker, reece, formatTokens(stockToken.BalanceOf(reece), stockToken.Precision), dollarValueOfBalance)
 
 	// Interact with contract (will auto-wrap)
 	fmt.Println("\nInteracting with contract...")
-	transferAmount := new(big.Int).Mul(big.NewInt(5), big.NewInt(basePrecision))
-	stockToken.Interact(reece, contract, transferAmount, owStock)
+	transferAmount := new(big.Int).Mul(big.NewInt(5), stockToken.Precision)
+	must(stockToken.Interact(reece, contract, transferAmount, owStock))
 
 	fmt.Println("\nAfter contract interaction:")
-	displayBalances(stockToken, owStock, reece, contract)
+	must(stockToken.PrintSummary(os.Stdout, owStock, reece, contract))
 
-	// Simulate a 2:1 stock split
+	// Simulate a 2:1 stock split, which also halves the price
 	fmt.Println("\nSimulating 2:1 stock split...")
-	stockToken.sharePrice.Div(stockToken.sharePrice, big.NewInt(2)) // Halve the price
-	stockToken.Rebase(uint64(2))
+	must(stockToken.Rebase(StockSplit{Numerator: big.NewInt(2), Denominator: big.NewInt(1)}))
 	owStock.UpdateExchangeRate(stockToken)
 
 	fmt.Println("\nAfter stock split:")
-	displayBalances(stockToken, owStock, reece, contract)
+	must(stockToken.PrintSummary(os.Stdout, owStock, reece, contract))
 
 	// Simulate a $1.50 dividend
 	dividend := Dividend{
 		cashAmount: dollarsToCents("$1.50"),
-		sharePrice: stockToken.sharePrice,
+		sharePrice: stockToken.SharePrice(),
 	}
-	stockToken.Rebase(dividend)
+	must(stockToken.Rebase(dividend))
 	owStock.UpdateExchangeRate(stockToken)
 
 	fmt.Println("\nAfter dividend:")
-	displayBalances(stockToken, owStock, reece, contract)
+	must(stockToken.PrintSummary(os.Stdout, owStock, reece, contract))
 
 	// Claim wrapped tokens
 	fmt.Println("\nClaiming tokens from contract...")
-	claimAmount := new(big.Int).Mul(big.NewInt(1), big.NewInt(basePrecision))
-	owStock.Claim(stockToken, contract, reece, claimAmount)
+	claimAmount := new(big.Int).Mul(big.NewInt(1), owStock.Precision)
+	must(owStock.Claim(stockToken, contract, reece, claimAmount))
 
 	fmt.Println("\nAfter claiming:")
-	displayBalances(stockToken, owStock, reece, contract)
+	must(stockToken.PrintSummary(os.Stdout, owStock, reece, contract))
+}
+
+// must panics on a non-nil error
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// formatTokens converts the raw balance to a human-readable string with one decimal place per
+// digit of precision
+func formatTokens(raw *big.Int, precision *big.Int) string {
+	return FormatTokens(raw, precision, precisionDecimals(precision), false)
+}
+
+// FormatTokens formats a raw amount as whole tokens with decimals fractional digits, from 0
+// up to the number of digits in precision; values outside that range are clamped. Dropped
+// digits are rounded half-up, away from zero for negative amounts. With thousandsSep the
+// integer part is grouped with commas, as in "1,234.50".
+func FormatTokens(raw, precision *big.Int, decimals int, thousandsSep bool) string {
+	decimals = min(max(decimals, 0), precisionDecimals(precision))
+	scale := PrecisionFromDecimals(uint(decimals))
+
+	// Rescale |raw| to decimals digits, adding half of the divisor first to round half-up
+	divisor := new(big.Int).Div(precision, scale)
+	scaled := new(big.Int).Abs(raw)
+	scaled.Add(scaled, new(big.Int).Rsh(divisor, 1))
+	scaled.Div(scaled, divisor)
+
+	whole, frac := new(big.Int).QuoRem(scaled, scale, new(big.Int))
+	result := whole.String()
+	if thousandsSep {
+		result = groupThousands(result)
+	}
+	if decimals > 0 {
+		result = fmt.Sprintf("%s.%0*d", result, decimals, frac)
+	}
+	if raw.Sign() < 0 && scaled.Sign() > 0 {
+		result = "-" + result
+	}
+	return result
+}
+
+// groupThousands inserts a comma between every group of three digits, counting from the right
+func groupThousands(digits string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+// formatCents formats an amount of cents as a dollar string such as "$1234.56" or "-$0.50"
+func formatCents(cents *big.Int) string {
+	sign := ""
+	if cents.Sign() < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(cents)
+	dollars, rem := new(big.Int).QuoRem(abs, big.NewInt(100), new(big.Int))
+	return fmt.Sprintf("%s$%d.%02d", sign, dollars, rem)
+}
+
+// FormatDollars formats an amount of cents as a dollar string with thousands separators, such
+// as "$1,234.56" or "-$0.50"
+func FormatDollars(cents *big.Int) string {
+	sign := ""
+	if cents.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + "$" + FormatTokens(new(big.Int).Abs(cents), big.NewInt(100), 2, true)
+}
+
+// PrecisionFromDecimals returns 10^d, the number of raw units in one whole token with d decimals
+func PrecisionFromDecimals(d uint) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d)), nil)
 }
 
-// formatTokens converts the raw balance to a human-readable string with 6 decimal places
-func formatTokens(raw *big.Int) string {
-	whole := new(big.Int).Div(raw, big.NewInt(basePrecision))
-	frac := new(big.Int).Mod(raw, big.NewInt(basePrecision))
-	return fmt.Sprintf("%d.%06d", whole, frac)
+// precisionDecimals returns the number of decimal places d of a precision 10^d
+func precisionDecimals(precision *big.Int) int {
+	return len(precision.String()) - 1
 }
 
 func dollarsToCents(dollars interface{}) *big.Int {
@@ -350,22 +1629,80 @@ func dollarsToCents(dollars interface{}) *big.Int {
 	case uint64:
 		return big.NewInt(int64(v * 100))
 	case string:
-		// Remove currency symbols and whitespace
-		s := strings.TrimSpace(v)
-		s = strings.TrimPrefix(s, "$")
-		s = strings.ReplaceAll(s, ",", "")
-
-		// Parse as float to handle decimal points
-		f, err := strconv.ParseFloat(s, 64)
+		cents, err := parseDollars(v)
 		if err != nil {
 			panic(fmt.Sprintf("Invalid dollar amount: %s", v))
 		}
-
-		// Convert to cents
-		return big.NewInt(int64(f * 100))
+		return cents
 	case *big.Int:
 		return new(big.Int).Mul(v, big.NewInt(100))
+	case *big.Rat:
+		return ratToCents(v)
 	default:
 		panic(fmt.Sprintf("Unsupported type for dollar amount: %T", dollars))
 	}
 }
+
+// parseDollars converts a dollar string such as "$1,234.50" to cents, rounding any digits past
+// the cents with ratToCents
+func parseDollars(dollars string) (*big.Int, error) {
+	amount, err := DollarStringToRat(dollars)
+	if err != nil {
+		return nil, err
+	}
+	return ratToCents(amount), nil
+}
+
+// DollarStringToRat parses a dollar string such as "$1,234.56" or "-0.5" into an exact
+// rational number of dollars. No float64 is involved: the digits before and after the
+// decimal point become the numerator over a power of ten.
+func DollarStringToRat(s string) (*big.Rat, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "$")
+	negative := strings.HasPrefix(trimmed, "-")
+	trimmed = strings.TrimPrefix(trimmed, "-")
+	trimmed = strings.TrimPrefix(trimmed, "$")
+	trimmed = strings.ReplaceAll(trimmed, ",", "")
+
+	whole, frac, hasPoint := strings.Cut(trimmed, ".")
+	if whole == "" && frac == "" || hasPoint && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("invalid dollar amount %q", s)
+	}
+
+	num, ok := new(big.Int).SetString("0"+whole+frac, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid dollar amount %q", s)
+	}
+	if negative {
+		num.Neg(num)
+	}
+	return new(big.Rat).SetFrac(num, PrecisionFromDecimals(uint(len(frac)))), nil
+}
+
+// ratToCents converts dollars to cents, rounding a fraction of a cent to the nearest cent and
+// a half cent to the even one (banker's rounding)
+func ratToCents(dollars *big.Rat) *big.Int {
+	cents := new(big.Rat).Mul(dollars, big.NewRat(100, 1))
+	if cents.IsInt() {
+		return new(big.Int).Set(cents.Num())
+	}
+
+	quo, rem := new(big.Int).QuoRem(cents.Num(), cents.Denom(), new(big.Int))
+	twiceRem := rem.Abs(rem).Lsh(rem, 1)
+	if c := twiceRem.Cmp(cents.Denom()); c > 0 || c == 0 && quo.Bit(0) == 1 {
+		// Round away from zero; Quo truncated toward zero
+		quo.Add(quo, big.NewInt(int64(cents.Num().Sign())))
+	}
+	return quo
+}
+
+// parsePositiveDollars is parseDollars for share prices, which must be above zero
+func parsePositiveDollars(dollars string) (*big.Int, error) {
+	cents, err := parseDollars(dollars)
+	if err != nil {
+		return nil, err
+	}
+	if cents.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: price %q must be positive", ErrInvalidAmount, dollars)
+	}
+	return cents, nil
+}
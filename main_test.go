@@ -0,0 +1,1120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestToken returns a TSLA token at $100.00, owned by 0xOWNER, that accepts shorthand
+// addresses
+func newTestToken(tb testing.TB) *StockToken {
+	tb.Helper()
+	st, err := NewStockToken("TSLA", "Tesla, Inc.", defaultDecimals, "$100.00", "0xOWNER")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	st.LaxAddressValidation = true
+	return st
+}
+
+// tokens returns n whole tokens in raw units at the default precision
+func tokens(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), PrecisionFromDecimals(defaultDecimals))
+}
+
+// mustMint mints n whole tokens to address
+func mustMint(tb testing.TB, st *StockToken, address string, n uint64) {
+	tb.Helper()
+	if err := st.Mint(address, n); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// checkBalance fails if address does not hold want raw units of st
+func checkBalance(tb testing.TB, st *StockToken, address string, want *big.Int) {
+	tb.Helper()
+	if got := st.BalanceOf(address); got.Cmp(want) != 0 {
+		tb.Errorf("%s balance = %s, want %s", address, got, want)
+	}
+}
+
+// checkSane fails if st's balances and staked balances do not add up to its total supply
+func checkSane(tb testing.TB, st *StockToken) {
+	tb.Helper()
+	if err := st.SanityCheck(); err != nil {
+		tb.Error(err)
+	}
+}
+
+// waitFor polls cond until it holds, failing after a few seconds
+func waitFor(tb testing.TB, what string, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// panicClock is a Clock that panics while armed. A rebase reads the clock once its action has
+// changed the ledger, so arming it stands in for a corporate action failing partway through.
+type panicClock struct {
+	armed atomic.Bool
+}
+
+func (c *panicClock) Now() time.Time {
+	if c.armed.Load() {
+		panic("clock failed")
+	}
+	return time.Now()
+}
+
+func (c *panicClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// cappedDividend sets st's supply cap just above its supply and returns a 1% dividend. The
+// dividend is paid to every holder before its growth is checked against the cap, so it fails
+// after changing the ledger.
+func cappedDividend(st *StockToken) RebaseAction {
+	st.maxSupply = new(big.Int).Add(st.TotalSupply(), big.NewInt(1))
+	return Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}
+}
+
+// ledgerFixture returns a token with ten holders, an allowance, a vesting grant and withheld
+// tax, for checking that a failed rebase leaves all of them alone
+func ledgerFixture(t *testing.T) *StockToken {
+	t.Helper()
+	st := newTestToken(t)
+	for i := 0; i < 10; i++ {
+		mustMint(t, st, fmt.Sprintf("0xHOLDER%02d", i), uint64(i+1))
+	}
+	if err := st.Approve("0xHOLDER00", "0xSPENDER", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Vest("0xHOLDER01", "5", time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	st.TaxWithheld = map[string]*big.Int{"0xHOLDER02": big.NewInt(7)}
+	return st
+}
+
+// checkLedgerUnchanged fails if st's ledger differs from before's
+func checkLedgerUnchanged(t *testing.T, st, before *StockToken) {
+	t.Helper()
+	for _, address := range before.Holders() {
+		checkBalance(t, st, address, before.BalanceOf(address))
+	}
+	if got, want := st.TotalSupply(), before.TotalSupply(); got.Cmp(want) != 0 {
+		t.Errorf("total supply = %s, want %s", got, want)
+	}
+	if got := st.Allowance("0xHOLDER00", "0xSPENDER"); got.Cmp(tokens(1)) != 0 {
+		t.Errorf("allowance = %s, want %s", got, tokens(1))
+	}
+	if got := st.vestingSchedules["0xHOLDER01"][0].TotalAmount; got.Cmp(tokens(5)) != 0 {
+		t.Errorf("vesting grant = %s, want %s", got, tokens(5))
+	}
+	if got := st.TaxWithheldFor("0xHOLDER02"); got.Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("tax withheld = %s, want 7", got)
+	}
+	if got := len(st.RebaseHistory); got != len(before.RebaseHistory) {
+		t.Errorf("rebase history has %d entries, want %d", got, len(before.RebaseHistory))
+	}
+	checkSane(t, st)
+}
+
+func TestRebaseRollsBackOnPanic(t *testing.T) {
+	st := ledgerFixture(t)
+	clock := &panicClock{}
+	st.Clock = clock
+	before := st.Clone()
+	var minted int
+	st.RegisterTransferHook(func(event TransferEvent) { minted++ })
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Rebase did not re-raise the panic")
+			}
+		}()
+		clock.armed.Store(true)
+		st.Rebase(doubleSplit)
+	}()
+	clock.armed.Store(false)
+
+	checkLedgerUnchanged(t, st, before)
+	st.emitEvents()
+	if minted != 0 {
+		t.Errorf("%d events from the failed rebase were delivered", minted)
+	}
+
+	// The token is still usable afterwards
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xHOLDER09", tokens(20))
+}
+
+func TestRebaseRollsBackOnError(t *testing.T) {
+	st := ledgerFixture(t)
+	if err := st.SetWithholdingTaxBps("0xHOLDER02", 1000); err != nil {
+		t.Fatal(err)
+	}
+	before := st.Clone()
+	if err := st.Rebase(cappedDividend(st)); !errors.Is(err, ErrSupplyCap) {
+		t.Fatalf("dividend above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	checkLedgerUnchanged(t, st, before)
+}
+
+func TestRebaseCopiesLedgerOnce(t *testing.T) {
+	st := ledgerFixture(t)
+	original := st.balances
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	// The committed ledger is the copy the action worked on; the original map is untouched
+	if original["0xHOLDER09"].Cmp(tokens(10)) != 0 {
+		t.Errorf("original balance changed to %s", original["0xHOLDER09"])
+	}
+	checkBalance(t, st, "0xHOLDER09", tokens(20))
+	if diff := st.RebaseHistory[0].BalanceDiff["0xHOLDER09"]; diff.Cmp(tokens(10)) != 0 {
+		t.Errorf("balance diff = %s, want %s", diff, tokens(10))
+	}
+}
+
+func TestCompoundRebaseRecordsEachStep(t *testing.T) {
+	st := ledgerFixture(t)
+	var hooked []int
+	st.OnRebase = func(st *StockToken, action RebaseAction) {
+		hooked = append(hooked, len(st.RebaseHistory))
+	}
+
+	if err := st.CompoundRebase(doubleSplit, 3); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xHOLDER09", tokens(80))
+	if got := len(st.RebaseHistory); got != 3 {
+		t.Fatalf("rebase history has %d entries, want 3", got)
+	}
+	for i, event := range st.RebaseHistory {
+		want := tokens(10 << i)
+		if diff := event.BalanceDiff["0xHOLDER09"]; diff.Cmp(want) != 0 {
+			t.Errorf("step %d balance diff = %s, want %s", i+1, diff, want)
+		}
+	}
+	// Every hook call comes after all three steps were committed
+	if fmt.Sprint(hooked) != "[3 3 3]" {
+		t.Errorf("OnRebase saw history lengths %v, want [3 3 3]", hooked)
+	}
+	checkSane(t, st)
+}
+
+func TestCompoundRebaseRollsBackAllSteps(t *testing.T) {
+	st := ledgerFixture(t)
+	before := st.Clone()
+	var hooked, transfers int
+	st.OnRebase = func(*StockToken, RebaseAction) { hooked++ }
+	st.RegisterTransferHook(func(TransferEvent) { transfers++ })
+	ch := make(chan RebaseEvent, 10)
+	st.SubscribeToRebase(ch)
+
+	// The third split would take the supply to eight times its size, above the cap
+	st.maxSupply = new(big.Int).Mul(st.TotalSupply(), big.NewInt(7))
+	if err := st.CompoundRebase(doubleSplit, 5); !errors.Is(err, ErrSupplyCap) {
+		t.Fatalf("compound rebase above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	checkLedgerUnchanged(t, st, before)
+	if hooked != 0 || transfers != 0 || len(ch) != 0 {
+		t.Errorf("failed compound rebase notified %d OnRebase, %d transfer hook and %d subscriber calls", hooked, transfers, len(ch))
+	}
+
+	st.maxSupply = nil
+	clock := &panicClock{}
+	st.Clock = clock
+	clock.armed.Store(true)
+	err := st.CompoundRebase(doubleSplit, 2)
+	clock.armed.Store(false)
+	if err == nil {
+		t.Fatal("panicking compound rebase succeeded")
+	}
+	checkLedgerUnchanged(t, st, before)
+}
+
+func BenchmarkCompoundRebase(b *testing.B) {
+	st := newTestToken(b)
+	for i := 0; i < 1000; i++ {
+		mustMint(b, st, fmt.Sprintf("0xHOLDER%04d", i), 100)
+	}
+	quarterly := Dividend{cashAmount: big.NewInt(25), sharePrice: big.NewInt(10000)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := st.Clone().CompoundRebase(quarterly, 40); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCompoundRebaseIsFast(t *testing.T) {
+	if testing.Short() || raceEnabled {
+		t.Skip("timing test")
+	}
+	result := testing.Benchmark(BenchmarkCompoundRebase)
+	if per := time.Duration(result.NsPerOp()); per > 100*time.Millisecond {
+		t.Errorf("40 quarterly dividends over 1000 holders took %s, want under 100ms", per)
+	}
+}
+
+func TestConcurrentMintAndTransfer(t *testing.T) {
+	st := newTestToken(t)
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			address := fmt.Sprintf("0xWORKER%02d", i)
+			next := fmt.Sprintf("0xWORKER%02d", (i+1)%workers)
+			for j := 0; j < 20; j++ {
+				if err := st.Mint(address, 1); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := st.Interact(address, next, tokens(1), nil); err != nil {
+					t.Error(err)
+					return
+				}
+				st.BalanceOf(address)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := st.TotalSupply(), tokens(workers*20); got.Cmp(want) != 0 {
+		t.Errorf("total supply = %s, want %s", got, want)
+	}
+	checkSane(t, st)
+}
+
+func TestOnRebase(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	var supplies []*big.Int
+	var actions []RebaseAction
+	st.OnRebase = func(st *StockToken, action RebaseAction) {
+		supplies = append(supplies, st.TotalSupply())
+		actions = append(actions, action)
+	}
+
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if len(supplies) != 1 || supplies[0].Cmp(tokens(20)) != 0 {
+		t.Fatalf("OnRebase recorded supplies %v, want [%s]", supplies, tokens(20))
+	}
+	if _, ok := actions[0].(StockSplit); !ok {
+		t.Errorf("OnRebase received %T, want StockSplit", actions[0])
+	}
+
+	// A failed rebase does not call the hook
+	if err := st.Rebase(StockSplit{Numerator: big.NewInt(0), Denominator: big.NewInt(1)}); err == nil {
+		t.Fatal("invalid split succeeded")
+	}
+	if len(supplies) != 1 {
+		t.Errorf("OnRebase called %d times, want once", len(supplies))
+	}
+}
+
+func TestRebasePassthrough(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := new(big.Int).Set(ow.balances["0xALICE"])
+
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Mul(ow.Precision, big.NewInt(2)); ow.exchangeRate.Cmp(want) != 0 {
+		t.Errorf("exchange rate = %s, want %s", ow.exchangeRate, want)
+	}
+	if ow.balances["0xALICE"].Cmp(wrapped) != 0 {
+		t.Errorf("wrapped balance changed from %s to %s", wrapped, ow.balances["0xALICE"])
+	}
+	checkSane(t, st)
+	// The wrapped supply is backed by the custody at the new rate
+	backing := new(big.Int).Mul(ow.totalSupply, ow.exchangeRate)
+	backing.Div(backing, ow.Precision)
+	if custody := st.BalanceOf(ow.ticker); custody.Cmp(backing) != 0 {
+		t.Errorf("custody = %s, want %s", custody, backing)
+	}
+
+	if err := ow.RebasePassthrough(nil, doubleSplit); err == nil {
+		t.Error("RebasePassthrough accepted a nil token")
+	}
+}
+
+func TestCompoundDividendMatchesSequential(t *testing.T) {
+	setup := func() *StockToken {
+		st := newTestToken(t)
+		mustMint(t, st, "0xALICE", 7)
+		mustMint(t, st, "0xBOB", 13)
+		if err := st.MintFractional("0xCAROL", "0.333333"); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	first := Dividend{cashAmount: big.NewInt(150), sharePrice: big.NewInt(10000)}
+	second := Dividend{cashAmount: big.NewInt(275), sharePrice: big.NewInt(10000)}
+
+	compound := setup()
+	if err := compound.Rebase(CompoundDividend{Dividends: []Dividend{first, second}}); err != nil {
+		t.Fatal(err)
+	}
+	sequential := setup()
+	for _, dividend := range []Dividend{first, second} {
+		if err := sequential.Rebase(dividend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if diff := balanceDiff(sequential.SnapshotBalances(), compound.SnapshotBalances()); len(diff) != 0 {
+		t.Errorf("compound and sequential dividends differ by %v", diff)
+	}
+	if compound.TotalSupply().Cmp(sequential.TotalSupply()) != 0 {
+		t.Errorf("compound supply = %s, sequential = %s", compound.TotalSupply(), sequential.TotalSupply())
+	}
+	if compound.DividendCount() != 2 {
+		t.Errorf("DividendCount = %d, want 2", compound.DividendCount())
+	}
+	checkSane(t, compound)
+}
+
+func TestRebaseWithIDRejectsDuplicate(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.RebaseWithID(doubleSplit, "split-2026-q1"); err != nil {
+		t.Fatal(err)
+	}
+	after := st.SnapshotBalances()
+
+	if err := st.RebaseWithID(doubleSplit, "split-2026-q1"); !errors.Is(err, ErrDuplicateAction) {
+		t.Errorf("second application: err = %v, want ErrDuplicateAction", err)
+	}
+	if diff := balanceDiff(after, st.SnapshotBalances()); len(diff) != 0 {
+		t.Errorf("duplicate action changed balances by %v", diff)
+	}
+	if st.RebaseCount() != 1 {
+		t.Errorf("RebaseCount = %d, want 1", st.RebaseCount())
+	}
+
+	// A failed action releases its id so it can be retried
+	invalid := StockSplit{Numerator: big.NewInt(0), Denominator: big.NewInt(1)}
+	if err := st.RebaseWithID(invalid, "split-2026-q2"); err == nil {
+		t.Fatal("invalid split succeeded")
+	}
+	if err := st.RebaseWithID(doubleSplit, "split-2026-q2"); err != nil {
+		t.Errorf("retry after a failure: %v", err)
+	}
+	if err := st.RebaseWithID(doubleSplit, ""); err == nil {
+		t.Error("RebaseWithID accepted an empty id")
+	}
+}
+
+func TestRebaseCounters(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	dividend := Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}
+	for _, action := range []RebaseAction{doubleSplit, dividend, dividend, StockSplit{Numerator: big.NewInt(1), Denominator: big.NewInt(2)}, dividend} {
+		if err := st.Rebase(action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := st.RebaseSpinOff(SpinOffTerms{ChildTicker: "SPIN", Ratio: big.NewRat(1, 10), InitialPrice: "$5.00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The spinoff is counted as a rebase but is neither a split nor a dividend
+	if got := st.RebaseCount(); got != 6 {
+		t.Errorf("RebaseCount = %d, want 6", got)
+	}
+	if got := st.SplitCount(); got != 2 {
+		t.Errorf("SplitCount = %d, want 2", got)
+	}
+	if got := st.DividendCount(); got != 3 {
+		t.Errorf("DividendCount = %d, want 3", got)
+	}
+}
+
+func TestReturnOfCapital(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	if err := st.Stake("0xBOB", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// $10 back on a $100 share shrinks every balance by a tenth
+	if err := st.Rebase(ReturnOfCapital{AmountPerShareCents: big.NewInt(1000)}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(9))
+	checkBalance(t, st, "0xBOB", new(big.Int).Div(tokens(27), big.NewInt(10)))
+	if staked := st.StakedBalanceOf("0xBOB"); staked.Cmp(new(big.Int).Div(tokens(18), big.NewInt(10))) != 0 {
+		t.Errorf("staked balance = %s, want 1.8 tokens", staked)
+	}
+	if st.TotalSupply().Cmp(new(big.Int).Div(tokens(135), big.NewInt(10))) != 0 {
+		t.Errorf("total supply = %s, want 13.5 tokens", st.TotalSupply())
+	}
+	checkSane(t, st)
+	if want := big.NewRat(9, 10); st.CumulativeMultiplier().Cmp(want) != 0 {
+		t.Errorf("multiplier = %s, want 9/10", st.CumulativeMultiplier().RatString())
+	}
+
+	for _, amount := range []int64{0, 10000, 20000} {
+		if err := st.Rebase(ReturnOfCapital{AmountPerShareCents: big.NewInt(amount)}); err == nil {
+			t.Errorf("return of %d cents on a $100 share succeeded", amount)
+		}
+	}
+}
+
+func TestCappedDividend(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xWHALE", 1000)
+	mustMint(t, st, "0xMINNOW", 10)
+
+	// A 1% dividend owes the whale 10 shares and the minnow 0.1, capped at 2 each
+	capped := CappedDividend{
+		MaxSharesPerHolder: tokens(2),
+		Dividend:           Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)},
+	}
+	if err := st.Rebase(capped); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xWHALE", tokens(1002))
+	checkBalance(t, st, "0xMINNOW", new(big.Int).Add(tokens(10), new(big.Int).Div(tokens(1), big.NewInt(10))))
+	checkBalance(t, st, CapOverflowAddress, tokens(8))
+	checkSane(t, st)
+}
+
+func TestRescueTokens(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	aapl, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aapl.LaxAddressValidation = true
+	// Sent to the wrapper by mistake
+	mustMint(t, aapl, ow.ticker, 3)
+
+	if err := ow.RescueTokens(st, aapl, "0xSAFE"); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, aapl, "0xSAFE", tokens(3))
+	checkBalance(t, aapl, ow.ticker, big.NewInt(0))
+	checkHolders(t, aapl.SortedHolders(), aapl.balances, "0xSAFE")
+	checkSane(t, aapl)
+
+	if err := ow.RescueTokens(st, aapl, "0xSAFE"); err == nil {
+		t.Error("rescued from an empty balance")
+	}
+	if err := ow.RescueTokens(st, st, "0xSAFE"); !errors.Is(err, ErrCannotRescueUnderlying) {
+		t.Errorf("rescue of the underlying: err = %v, want ErrCannotRescueUnderlying", err)
+	}
+	checkBalance(t, st, ow.ticker, tokens(4))
+}
+
+func TestPartialClaim(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.Interact("0xALICE", "0xCONTRACT", tokens(10), ow); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ow.PartialClaim(st, "0xCONTRACT", "0xBOB", big.NewRat(1, 3)); err != nil {
+		t.Fatal(err)
+	}
+	third := new(big.Int).Div(tokens(10), big.NewInt(3))
+	checkBalance(t, st, "0xBOB", third)
+	if remaining := ow.balances["0xCONTRACT"]; remaining.Cmp(new(big.Int).Sub(tokens(10), third)) != 0 {
+		t.Errorf("remaining wrapped balance = %s, want %s", remaining, new(big.Int).Sub(tokens(10), third))
+	}
+	checkSane(t, st)
+
+	for _, fraction := range []*big.Rat{nil, big.NewRat(0, 1), big.NewRat(-1, 2), big.NewRat(3, 2)} {
+		if err := ow.PartialClaim(st, "0xCONTRACT", "0xBOB", fraction); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("PartialClaim(%v): err = %v, want ErrInvalidAmount", fraction, err)
+		}
+	}
+	if err := ow.PartialClaim(st, "0xALICE", "0xBOB", big.NewRat(1, 2)); !errors.Is(err, ErrNotContractAddress) {
+		t.Errorf("claim from a non-contract: err = %v, want ErrNotContractAddress", err)
+	}
+
+	if err := ow.PartialClaim(st, "0xCONTRACT", "0xBOB", big.NewRat(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xBOB", tokens(10))
+	if _, ok := ow.balances["0xCONTRACT"]; ok {
+		t.Error("claiming everything left a wrapped balance")
+	}
+}
+
+func TestEmergencyDrain(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	for address, amount := range map[string]*big.Int{"0xALICE": tokens(6), "0xBOB": tokens(2)} {
+		if err := ow.Wrap(st, address, amount, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	// Draining works while the token is paused
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	drained, err := ow.EmergencyDrain(st, "0xSAFE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drained.Cmp(tokens(16)) != 0 {
+		t.Errorf("drained %s, want %s", drained, tokens(16))
+	}
+	if entries := ow.Filter("emergency_drain", time.Time{}); len(entries) != 1 || entries[0].Fields["to"] != "0xSAFE" || entries[0].Fields["amount"] != tokens(16).String() {
+		t.Errorf("emergency_drain entries = %v, want one of %s to 0xSAFE", entries, tokens(16))
+	}
+	checkBalance(t, st, "0xSAFE", tokens(16))
+	checkBalance(t, st, ow.ticker, big.NewInt(0))
+	checkSane(t, st)
+	if ow.totalSupply.Sign() != 0 || len(ow.balances) != 0 || ow.TotalHolders() != 0 {
+		t.Errorf("wrapper left with supply %s and balances %v", ow.totalSupply, ow.balances)
+	}
+	if ow.exchangeRate.Cmp(ow.Precision) != 0 {
+		t.Errorf("exchange rate = %s, want it reset to %s", ow.exchangeRate, ow.Precision)
+	}
+
+	// Draining an empty wrapper moves nothing and does not list the drain address as a holder
+	if drained, err := ow.EmergencyDrain(st, "0xOTHER"); err != nil || drained.Sign() != 0 {
+		t.Errorf("second drain = %v, %v, want 0", drained, err)
+	}
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE", "0xBOB", "0xSAFE")
+	if _, err := ow.EmergencyDrain(st, ow.ticker); err == nil {
+		t.Error("drained the wrapper into itself")
+	}
+}
+
+func TestInvalidOperationsReturnErrors(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 5)
+
+	for name, test := range map[string]struct {
+		run  func() error
+		want error
+	}{
+		"mint zero":            {func() error { return st.Mint("0xALICE", 0) }, ErrInvalidAmount},
+		"wrap too much":        {func() error { return ow.Wrap(st, "0xALICE", tokens(6), nil) }, ErrInsufficientBalance},
+		"wrap nothing":         {func() error { return ow.Wrap(st, "0xALICE", big.NewInt(0), nil) }, ErrInvalidAmount},
+		"unwrap empty":         {func() error { return ow.Unwrap(st, "0xALICE", tokens(1), nil) }, ErrInsufficientBalance},
+		"transfer too much":    {func() error { return ow.Transfer("0xALICE", "0xBOB", tokens(1)) }, ErrInsufficientBalance},
+		"interact too much":    {func() error { return st.Interact("0xALICE", "0xBOB", tokens(6), nil) }, ErrInsufficientBalance},
+		"claim from a holder":  {func() error { return ow.Claim(st, "0xALICE", "0xBOB", tokens(1)) }, ErrNotContractAddress},
+		"claim empty contract": {func() error { return ow.Claim(st, "0xCONTRACT", "0xBOB", tokens(1)) }, ErrInsufficientBalance},
+	} {
+		if err := test.run(); !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", name, err, test.want)
+		}
+	}
+	checkBalance(t, st, "0xALICE", tokens(5))
+	checkSane(t, st)
+}
+
+func TestReverseSplit(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		ratio      int64
+		wantSupply *big.Int
+		wantDust   *big.Int
+	}{
+		// 7.000001 + 3 + 0.000003 tokens
+		{"1-for-2", 2, big.NewInt(5_000_002), big.NewInt(1)},
+		{"1-for-10", 10, big.NewInt(1_000_000), big.NewInt(0)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			st := newTestToken(t)
+			for address, amount := range map[string]string{"0xALICE": "7.000001", "0xBOB": "3", "0xCAROL": "0.000003"} {
+				if err := st.MintFractional(address, amount); err != nil {
+					t.Fatal(err)
+				}
+			}
+			split := StockSplit{Numerator: big.NewInt(1), Denominator: big.NewInt(test.ratio)}
+			if err := st.Rebase(split); err != nil {
+				t.Fatal(err)
+			}
+
+			if st.TotalSupply().Cmp(test.wantSupply) != 0 {
+				t.Errorf("total supply = %s, want %s", st.TotalSupply(), test.wantSupply)
+			}
+			checkBalance(t, st, DustAddress, test.wantDust)
+			checkBalance(t, st, "0xBOB", new(big.Int).Div(tokens(3), big.NewInt(test.ratio)))
+			if want := big.NewInt(10000 * test.ratio); st.SharePrice().Cmp(want) != 0 {
+				t.Errorf("share price = %s, want %s", st.SharePrice(), want)
+			}
+			checkSane(t, st)
+			checkHolders(t, st.SortedHolders(), st.balances, slices.Sorted(maps.Keys(st.balances))...)
+		})
+	}
+}
+
+func TestReverseSplitRemovesEmptiedHolders(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 1)
+	for _, address := range []string{"0xBOB", "0xCAROL"} {
+		if err := st.MintRaw(address, big.NewInt(5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Rebase(StockSplit{Numerator: big.NewInt(1), Denominator: big.NewInt(10)}); err != nil {
+		t.Fatal(err)
+	}
+	// Bob's and Carol's half units round away, and make up one unit of dust between them
+	for _, address := range []string{"0xBOB", "0xCAROL"} {
+		if _, ok := st.balances[address]; ok {
+			t.Errorf("%s: a balance rounded down to zero was kept", address)
+		}
+	}
+	checkBalance(t, st, DustAddress, big.NewInt(1))
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE", DustAddress)
+	checkSane(t, st)
+}
+
+func TestBurn(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+
+	for _, amount := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		if err := st.Burn("0xALICE", amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Burn(%v) error = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+	}
+	if err := st.Burn("0xALICE", tokens(11)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("over-burn error = %v, want %v", err, ErrInsufficientBalance)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+
+	if err := st.Burn("0xALICE", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(6))
+	if err := st.Burn("0xBOB", tokens(5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.balances["0xBOB"]; ok {
+		t.Error("burning a whole balance left the holder in the map")
+	}
+	if st.TotalSupply().Cmp(tokens(6)) != 0 {
+		t.Errorf("total supply = %s, want %s", st.TotalSupply(), tokens(6))
+	}
+	if got := st.TotalHolders(); got != 1 {
+		t.Errorf("TotalHolders = %d, want 1", got)
+	}
+	checkSane(t, st)
+}
+
+func TestWrappedBurnReleasesToTreasury(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := new(big.Int).Set(ow.balances["0xALICE"])
+
+	if err := ow.Burn(st, "0xALICE", wrapped); err == nil {
+		t.Error("Burn without a treasury succeeded")
+	}
+	if err := ow.SetTreasury("0xTREASURY"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Burn(st, "0xALICE", new(big.Int).Add(wrapped, big.NewInt(1))); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("over-burn error = %v, want %v", err, ErrInsufficientBalance)
+	}
+
+	half := new(big.Int).Rsh(wrapped, 1)
+	if err := ow.Burn(st, "0xALICE", half); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xTREASURY", tokens(5))
+	checkBalance(t, st, ow.ticker, tokens(5))
+	if err := ow.Burn(st, "0xALICE", new(big.Int).Sub(wrapped, half)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xTREASURY", tokens(10))
+	if ow.totalSupply.Sign() != 0 {
+		t.Errorf("wrapped supply = %s, want 0", ow.totalSupply)
+	}
+	checkHolders(t, ow.SortedHolders(), ow.balances)
+	// Burning moves the underlying to the treasury rather than destroying it
+	if st.TotalSupply().Cmp(tokens(10)) != 0 {
+		t.Errorf("underlying supply = %s, want %s", st.TotalSupply(), tokens(10))
+	}
+	checkSane(t, st)
+}
+
+func TestMintFractional(t *testing.T) {
+	for _, test := range []struct {
+		shares string
+		want   *big.Int // nil when the amount is rejected
+	}{
+		{"10", tokens(10)},
+		{"10.5", big.NewInt(10_500_000)},
+		{"0.000001", big.NewInt(1)},
+		{"0.0000001", nil},
+		{"", nil},
+		{"1.2.3", nil},
+		{"abc", nil},
+		{"0", nil},
+	} {
+		st := newTestToken(t)
+		err := st.MintFractional("0xALICE", test.shares)
+		if test.want == nil {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("MintFractional(%q) error = %v, want %v", test.shares, err, ErrInvalidAmount)
+			}
+			if st.TotalSupply().Sign() != 0 {
+				t.Errorf("MintFractional(%q) minted %s", test.shares, st.TotalSupply())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MintFractional(%q): %v", test.shares, err)
+			continue
+		}
+		checkBalance(t, st, "0xALICE", test.want)
+	}
+}
+
+func TestMintRaw(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.MintRaw("0xALICE", big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", big.NewInt(7))
+	for _, amount := range []*big.Int{nil, big.NewInt(0), big.NewInt(-7)} {
+		if err := st.MintRaw("0xALICE", amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("MintRaw(%v) error = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+	}
+	checkSane(t, st)
+}
+
+func TestPrecisionFromDecimals(t *testing.T) {
+	for d, want := range map[uint]string{0: "1", 2: "100", 6: "1000000", 8: "100000000", 18: "1000000000000000000"} {
+		if got := PrecisionFromDecimals(d); got.String() != want {
+			t.Errorf("PrecisionFromDecimals(%d) = %s, want %s", d, got, want)
+		}
+	}
+}
+
+func TestEighteenDecimalWrapRoundTrip(t *testing.T) {
+	st, err := NewStockToken("TSLA", "Tesla, Inc.", 18, "$100.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.LaxAddressValidation = true
+	ow := NewOndoWrappedStock(st)
+	if ow.Precision.Cmp(PrecisionFromDecimals(18)) != 0 {
+		t.Fatalf("wrapper precision = %s, want 10^18", ow.Precision)
+	}
+	// One token and one wei, which a 6-decimal precision would truncate away
+	if err := st.MintFractional("0xALICE", "1.000000000000000001"); err != nil {
+		t.Fatal(err)
+	}
+	amount := new(big.Int).Add(PrecisionFromDecimals(18), big.NewInt(1))
+	checkBalance(t, st, "0xALICE", amount)
+
+	if err := ow.Wrap(st, "0xALICE", amount, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := ow.balances["0xALICE"]; got.Cmp(amount) != 0 {
+		t.Fatalf("wrapped %s, want %s", got, amount)
+	}
+	if err := ow.Transfer("0xALICE", "0xCONTRACT", amount); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Unwrap(st, "0xALICE", amount, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", amount)
+	if ow.totalSupply.Sign() != 0 {
+		t.Errorf("wrapped supply = %s after unwrapping everything", ow.totalSupply)
+	}
+	if got := formatTokens(amount, st.Precision); got != "1.000000000000000001" {
+		t.Errorf("formatTokens = %s, want 1.000000000000000001", got)
+	}
+	checkSane(t, st)
+}
+
+func TestParseTokens(t *testing.T) {
+	six, two, eighteen := PrecisionFromDecimals(6), PrecisionFromDecimals(2), PrecisionFromDecimals(18)
+	for _, test := range []struct {
+		s         string
+		precision *big.Int
+		want      string // empty when s is rejected
+	}{
+		{"2", six, "2000000"},
+		{"0", six, "0"},
+		{"2.5", six, "2500000"},
+		{"2.500000", six, "2500000"},
+		{"2.50", two, "250"},
+		{"007.10", six, "7100000"},
+		{".5", six, "500000"},
+		{"0.000001", six, "1"},
+		{"0.0000010", six, ""},
+		{"0.01", two, "1"},
+		{"0.001", two, ""},
+		{"0.000000000000000001", eighteen, "1"},
+		{"0.0000000000000000001", eighteen, ""},
+		{"", six, ""},
+		{".", six, ""},
+		{"2.", six, ""},
+		{"-1", six, ""},
+		{"1.2.3", six, ""},
+		{"1,000", six, ""},
+		{"1e6", six, ""},
+		{" 1", six, ""},
+		{"1", big.NewInt(0), ""},
+	} {
+		got, err := ParseTokens(test.s, test.precision)
+		if test.want == "" {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("ParseTokens(%q, %s) = %v, %v; want %v", test.s, test.precision, got, err, ErrInvalidAmount)
+			}
+			continue
+		}
+		if err != nil || got.String() != test.want {
+			t.Errorf("ParseTokens(%q, %s) = %v, %v; want %s", test.s, test.precision, got, err, test.want)
+			continue
+		}
+		// Formatting the parsed amount gives the input back, up to trailing zeros
+		if back, _ := ParseTokens(formatTokens(got, test.precision), test.precision); back.Cmp(got) != 0 {
+			t.Errorf("ParseTokens(formatTokens(%s)) = %s", got, back)
+		}
+	}
+}
+
+func TestDollarsToCentsString(t *testing.T) {
+	for _, test := range []struct {
+		dollars string
+		want    string
+	}{
+		// Past 2^53 cents, where a float64 can no longer hold every cent
+		{"$9999999999999.99", "999999999999999"},
+		{"$90071992547409.93", "9007199254740993"},
+		{"$0.01", "1"},
+		{"$1234567.895", "123456790"},
+		{"$1234567.885", "123456788"},
+		{"$1,234.50", "123450"},
+		{"-$0.50", "-50"},
+		{"100", "10000"},
+	} {
+		if got := dollarsToCents(test.dollars); got.String() != test.want {
+			t.Errorf("dollarsToCents(%q) = %s, want %s", test.dollars, got, test.want)
+		}
+	}
+}
+
+func TestSlippageProtection(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), tokens(4)); err != nil {
+		t.Fatalf("wrap meeting its minimum exactly: %v", err)
+	}
+	if err := ow.Transfer("0xALICE", "0xCONTRACT", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := func() string {
+		return fmt.Sprint(st.balances, st.TotalSupply(), ow.balances, ow.totalSupply, ow.roundingDust)
+	}
+
+	// A near-zero exchange rate: each wrapped token is backed by a single raw unit, so
+	// unwrapping pays almost nothing
+	ow.exchangeRate = big.NewInt(1)
+	before := snapshot()
+	if err := ow.Unwrap(st, "0xALICE", tokens(2), tokens(1)); !errors.Is(err, ErrSlippageExceeded) {
+		t.Errorf("unwrap below minOut: err = %v, want %v", err, ErrSlippageExceeded)
+	}
+	if after := snapshot(); after != before {
+		t.Errorf("failed unwrap changed state:\n%s\nwant\n%s", after, before)
+	}
+
+	// The inverse, where wrapping mints almost nothing
+	ow.exchangeRate = new(big.Int).Mul(tokens(1), tokens(1))
+	if err := ow.Wrap(st, "0xALICE", tokens(6), tokens(1)); !errors.Is(err, ErrSlippageExceeded) {
+		t.Errorf("wrap below minOut: err = %v, want %v", err, ErrSlippageExceeded)
+	}
+	if after := snapshot(); after != before {
+		t.Errorf("failed wrap changed state:\n%s\nwant\n%s", after, before)
+	}
+
+	// Nil and zero minimums disable the check
+	ow.exchangeRate = tokens(1)
+	if err := ow.Wrap(st, "0xALICE", tokens(1), big.NewInt(0)); err != nil {
+		t.Errorf("wrap with a zero minimum: %v", err)
+	}
+	if err := ow.Unwrap(st, "0xALICE", tokens(1), nil); err != nil {
+		t.Errorf("unwrap with no minimum: %v", err)
+	}
+	checkSane(t, st)
+}
+
+func TestCumulativeMultiplier(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	if st.CumulativeMultiplier().Cmp(big.NewRat(1, 1)) != 0 {
+		t.Fatalf("genesis multiplier = %s, want 1", st.CumulativeMultiplier().RatString())
+	}
+
+	factors := []*big.Rat{big.NewRat(2, 1), big.NewRat(1015, 1000), big.NewRat(3, 1)}
+	for _, action := range []RebaseAction{
+		doubleSplit,
+		// 75 cents on the $50 split price is 1.5%
+		Dividend{cashAmount: big.NewInt(75), sharePrice: big.NewInt(5000)},
+		StockSplit{Numerator: big.NewInt(3), Denominator: big.NewInt(1)},
+	} {
+		if err := st.Rebase(action); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := big.NewRat(1, 1)
+	for _, factor := range factors {
+		want.Mul(want, factor)
+	}
+	if got := st.CumulativeMultiplier(); got.Cmp(want) != 0 || got.RatString() != "609/100" {
+		t.Errorf("multiplier = %s, want %s", got.RatString(), want.RatString())
+	}
+	// Genesis shares convert to the current balance
+	genesis := new(big.Rat).SetInt(tokens(100))
+	if current := genesis.Mul(genesis, st.CumulativeMultiplier()); current.Cmp(new(big.Rat).SetInt(st.BalanceOf("0xALICE"))) != 0 {
+		t.Errorf("100 genesis tokens convert to %s, want the balance %s", current.FloatString(0), st.BalanceOf("0xALICE"))
+	}
+
+	// The returned value is a copy
+	st.CumulativeMultiplier().SetInt64(0)
+	if st.CumulativeMultiplier().Cmp(want) != 0 {
+		t.Error("modifying the returned multiplier changed the token's")
+	}
+}
+
+func TestDollarsToCentsRat(t *testing.T) {
+	for _, test := range []struct {
+		dollars *big.Rat
+		want    int64
+	}{
+		{big.NewRat(12345, 100), 12345},
+		{big.NewRat(1, 3), 33},
+		{big.NewRat(2, 3), 67},
+		// Half a cent rounds to the even cent
+		{big.NewRat(1, 200), 0},
+		{big.NewRat(3, 200), 2},
+		{big.NewRat(-3, 200), -2},
+	} {
+		if got := dollarsToCents(test.dollars); got.Cmp(big.NewInt(test.want)) != 0 {
+			t.Errorf("dollarsToCents(%s) = %s, want %d", test.dollars.RatString(), got, test.want)
+		}
+	}
+}
+
+func TestDollarStringToRat(t *testing.T) {
+	for s, want := range map[string]*big.Rat{
+		"$1234.56":   big.NewRat(123456, 100),
+		"$1,234.5":   big.NewRat(12345, 10),
+		"0.1":        big.NewRat(1, 10),
+		"-$0.005":    big.NewRat(-5, 1000),
+		"$-0.005":    big.NewRat(-5, 1000),
+		"$.25":       big.NewRat(1, 4),
+		"  $7  ":     big.NewRat(7, 1),
+		"$0.1000001": big.NewRat(1000001, 10000000),
+	} {
+		got, err := DollarStringToRat(s)
+		if err != nil || got.Cmp(want) != 0 {
+			t.Errorf("DollarStringToRat(%q) = %v, %v, want %s", s, got, err, want.RatString())
+		}
+	}
+	for _, s := range []string{"", "$", "$.", "$1.", "1.2.3", "$1e3", "abc", "$ 1"} {
+		if got, err := DollarStringToRat(s); err == nil {
+			t.Errorf("DollarStringToRat(%q) = %s, want an error", s, got.RatString())
+		}
+	}
+}
+
+func TestFormatTokens(t *testing.T) {
+	precision := PrecisionFromDecimals(6)
+	for _, tc := range []struct {
+		raw          int64
+		decimals     int
+		thousandsSep bool
+		want         string
+	}{
+		{0, 2, false, "0.00"},
+		{0, 0, false, "0"},
+		{1, 6, false, "0.000001"},
+		{1_234_567, 9, false, "1.234567"},
+		{1_234_567, -1, false, "1"},
+		{1_234_499, 3, false, "1.234"},
+		{1_234_500, 3, false, "1.235"},
+		{999_500, 3, false, "1.000"},
+		{-1_234_500, 3, false, "-1.235"},
+		{-400, 3, false, "0.000"},
+		{999_000_000, 2, true, "999.00"},
+		{1_000_000_000, 2, true, "1,000.00"},
+		{1_000_000_000_000, 0, true, "1,000,000"},
+		{1_000_000_000_000, 0, false, "1000000"},
+		{-1_234_567_890_000, 1, true, "-1,234,567.9"},
+	} {
+		if got := FormatTokens(big.NewInt(tc.raw), precision, tc.decimals, tc.thousandsSep); got != tc.want {
+			t.Errorf("FormatTokens(%d, %d, %t) = %q, want %q", tc.raw, tc.decimals, tc.thousandsSep, got, tc.want)
+		}
+	}
+}
+
+func TestFormatDollars(t *testing.T) {
+	for cents, want := range map[int64]string{
+		0:            "$0.00",
+		5:            "$0.05",
+		-50:          "-$0.50",
+		99_999:       "$999.99",
+		100_000:      "$1,000.00",
+		123_456:      "$1,234.56",
+		100_000_000:  "$1,000,000.00",
+		-123_456_789: "-$1,234,567.89",
+	} {
+		if got := FormatDollars(big.NewInt(cents)); got != want {
+			t.Errorf("FormatDollars(%d) = %q, want %q", cents, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync/atomic"
+)
+
+// tokenSeq numbers tokens as they are created, so lockTokens can order tokens that share a
+// ticker
+var tokenSeq atomic.Uint64
+
+// lockTokens write-locks every distinct non-nil token in a fixed order, by ticker and then by
+// creation order, so that operations locking the same tokens in different roles, such as
+// Merge(a, b) and Merge(b, a), cannot deadlock. It returns a function that unlocks them.
+func lockTokens(tokens ...*StockToken) (unlock func()) {
+	locked := make([]*StockToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t != nil && !slices.Contains(locked, t) {
+			locked = append(locked, t)
+		}
+	}
+	slices.SortFunc(locked, func(a, b *StockToken) int {
+		return cmp.Or(
+			cmp.Compare(a.ticker, b.ticker),
+			cmp.Compare(a.seq, b.seq),
+		)
+	})
+
+	for _, t := range locked {
+		t.mu.Lock()
+	}
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].mu.Unlock()
+		}
+	}
+}
+
+// StockMerger converts the rebased token into Acquirer shares at ExchangeRatio acquirer
+// shares per target share in a stock-for-stock deal
+type StockMerger struct {
+	Acquirer      *StockToken
+	ExchangeRatio *big.Rat
+}
+
+// ApplyMerger mints balance * ratio acquirer shares to every holder of target, rounded down,
+// then zeroes all target balances and its total supply
+func ApplyMerger(target, acquirer *StockToken, ratio *big.Rat) error {
+	if target == nil {
+		return errors.New("merger token is nil")
+	}
+
+	defer target.emitEvents()
+	if acquirer != nil {
+		defer acquirer.emitEvents()
+	}
+	defer lockTokens(target, acquirer)()
+	_, err := applyMerger(target, acquirer, ratio)
+	return err
+}
+
+// Merge absorbs acquiree into acquirer: every acquiree holder receives balance * ratio acquirer
+// shares, rounded down, and the acquiree is left with no balances and zero supply. It fails
+// if the acquirer is paused. Besides the usual mint and burn events, a MergerEvent is sent to
+// the merger hooks of both tokens.
+func Merge(acquiree, acquirer *StockToken, ratio *big.Rat) error {
+	if acquiree == nil || acquirer == nil {
+		return errors.New("merger token is nil")
+	}
+
+	defer acquiree.emitEvents()
+	defer acquirer.emitEvents()
+	defer lockTokens(acquiree, acquirer)()
+
+	retired := new(big.Int).Set(acquiree.totalSupply)
+	issued, err := applyMerger(acquiree, acquirer, ratio)
+	if err != nil {
+		return err
+	}
+
+	event := MergerEvent{
+		Acquiree:  acquiree.ticker,
+		Acquirer:  acquirer.ticker,
+		Ratio:     new(big.Rat).Set(ratio),
+		Retired:   retired,
+		Issued:    issued,
+		Timestamp: acquiree.now(),
+	}
+	acquiree.hooks.recordMerger(event)
+	acquirer.hooks.recordMerger(event)
+	return nil
+}
+
+// applyMerger is ApplyMerger for callers that already hold target.mu and acquirer.mu, taken
+// together with lockTokens. It returns the number of acquirer shares minted.
+func applyMerger(target, acquirer *StockToken, ratio *big.Rat) (*big.Int, error) {
+	if target == nil || acquirer == nil {
+		return nil, errors.New("merger token is nil")
+	}
+	if target == acquirer {
+		return nil, errors.New("a token cannot merge into itself")
+	}
+	if ratio == nil || ratio.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: exchange ratio must be positive", ErrInvalidAmount)
+	}
+
+	if acquirer.isPaused {
+		return nil, fmt.Errorf("%w: acquirer %s", ErrTokenPaused, acquirer.ticker)
+	}
+
+	// Staked target balances are converted too, into unstaked acquirer shares
+	issued := big.NewInt(0)
+	for _, balances := range []map[string]*big.Int{target.balances, target.stakedBalances} {
+		for _, balance := range balances {
+			shares := new(big.Int).Mul(balance, ratio.Num())
+			issued.Add(issued, shares.Div(shares, ratio.Denom()))
+		}
+	}
+	if err := acquirer.checkSupplyCap(issued); err != nil {
+		return nil, err
+	}
+
+	for _, balances := range []map[string]*big.Int{target.balances, target.stakedBalances} {
+		for _, address := range sortedAddresses(balances) {
+			balance := balances[address]
+			shares := new(big.Int).Mul(balance, ratio.Num())
+			shares.Div(shares, ratio.Denom())
+
+			// A balance too small to earn a whole raw unit is cancelled without adding the
+			// holder to the acquirer
+			if shares.Sign() > 0 {
+				acquirer.credit(address, shares)
+				acquirer.totalSupply.Add(acquirer.totalSupply, shares)
+				acquirer.hooks.record("mint", "", address, shares, acquirer.now())
+			}
+
+			if balance.Sign() > 0 {
+				target.hooks.record("burn", address, "", balance, target.now())
+			}
+		}
+	}
+	target.setBalances(make(map[string]*big.Int))
+	target.stakedBalances = nil
+	target.totalSupply.SetInt64(0)
+	target.allowances = nil
+	return issued, nil
+}
+
+// MergeFrom absorbs other, a separate instance of the same token, at par: every balance and
+// staked balance of other is added to the holder's balance here, along with its supply and
+// vesting schedules, and other is left with no balances, allowances or supply. The tickers
+// and precisions must match, otherwise ErrTokenMismatch is returned, and neither token may be
+// paused.
+func (t *StockToken) MergeFrom(other *StockToken) error {
+	if other == nil {
+		return errors.New("merger token is nil")
+	}
+	if other == t {
+		return errors.New("a token cannot merge into itself")
+	}
+
+	defer t.emitEvents()
+	defer other.emitEvents()
+	defer lockTokens(t, other)()
+	if t.ticker != other.ticker || t.Precision.Cmp(other.Precision) != 0 {
+		return fmt.Errorf("%w: cannot merge %s with precision %s into %s with precision %s", ErrTokenMismatch, other.ticker, other.Precision, t.ticker, t.Precision)
+	}
+	if t.isPaused || other.isPaused {
+		return ErrTokenPaused
+	}
+	if err := t.checkSupplyCap(other.totalSupply); err != nil {
+		return err
+	}
+
+	for _, address := range other.holders {
+		balance := other.balances[address]
+		t.credit(address, balance)
+		if balance.Sign() > 0 {
+			t.hooks.record("mint", "", address, balance, t.now())
+			other.hooks.record("burn", address, "", balance, other.now())
+		}
+	}
+	for _, address := range sortedAddresses(other.stakedBalances) {
+		if t.stakedBalances == nil {
+			t.stakedBalances = make(map[string]*big.Int)
+		}
+		t.checkpointStaked(address)
+		if t.stakedBalances[address] == nil {
+			t.stakedBalances[address] = big.NewInt(0)
+		}
+		t.stakedBalances[address].Add(t.stakedBalances[address], other.stakedBalances[address])
+	}
+	for address, schedules := range other.vestingSchedules {
+		if t.vestingSchedules == nil {
+			t.vestingSchedules = make(map[string][]*VestingSchedule)
+		}
+		t.vestingSchedules[address] = append(t.vestingSchedules[address], schedules...)
+	}
+	t.totalSupply.Add(t.totalSupply, other.totalSupply)
+
+	other.setBalances(make(map[string]*big.Int))
+	other.stakedBalances = nil
+	other.vestingSchedules = nil
+	other.allowances = nil
+	other.totalSupply = big.NewInt(0)
+	return nil
+}
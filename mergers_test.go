@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpposingMergersDoNotDeadlock(t *testing.T) {
+	a, err := NewStockToken("AAA", "A Corp", defaultDecimals, "$10.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewStockToken("BBB", "B Corp", defaultDecimals, "$10.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.LaxAddressValidation, b.LaxAddressValidation = true, true
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(4)
+			go func() { defer wg.Done(); Merge(a, b, big.NewRat(1, 1)) }()
+			go func() { defer wg.Done(); Merge(b, a, big.NewRat(1, 1)) }()
+			go func() { defer wg.Done(); a.Rebase(StockMerger{Acquirer: b, ExchangeRatio: big.NewRat(1, 1)}) }()
+			go func() { defer wg.Done(); b.MergeFrom(a) }()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("opposing mergers deadlocked")
+	}
+	checkSane(t, a)
+	checkSane(t, b)
+}
+
+func TestLockTokensOrdersSameTickerByCreation(t *testing.T) {
+	a, b := newTestToken(t), newTestToken(t)
+	c := a.Clone()
+	data, err := a.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadStockToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(a.seq < b.seq && b.seq < c.seq && c.seq < d.seq) {
+		t.Errorf("sequence ids %d, %d, %d, %d, want them increasing in creation order", a.seq, b.seq, c.seq, d.seq)
+	}
+
+	// Same-ticker tokens locked in opposite orders still take the locks in one order
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(2)
+			go func() { defer wg.Done(); lockTokens(a, b, c)() }()
+			go func() { defer wg.Done(); lockTokens(c, b, a)() }()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("same-ticker tokens deadlocked")
+	}
+}
+
+func TestFailedStockMergerRollsBackAcquirer(t *testing.T) {
+	target, acquirer := newTestToken(t), newTestToken(t)
+	mustMint(t, target, "0xALICE", 10)
+	mustMint(t, acquirer, "0xBOB", 1)
+	// The acquirer's cap only fails the merger after its shares are counted
+	acquirer.maxSupply = tokens(5)
+	if err := target.Rebase(StockMerger{Acquirer: acquirer, ExchangeRatio: big.NewRat(1, 1)}); err == nil {
+		t.Fatal("merger above the acquirer's cap succeeded")
+	}
+	checkBalance(t, target, "0xALICE", tokens(10))
+	checkBalance(t, acquirer, "0xALICE", big.NewInt(0))
+	checkSane(t, target)
+	checkSane(t, acquirer)
+}
+
+func TestApplyMergerTwoForOne(t *testing.T) {
+	target, err := NewStockToken("TWTR", "Twitter", defaultDecimals, "$50.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.LaxAddressValidation = true
+	acquirer := newTestToken(t)
+	mustMint(t, target, "0xALICE", 60)
+	mustMint(t, target, "0xBOB", 40)
+	mustMint(t, acquirer, "0xBOB", 5)
+
+	// Two target shares for each acquirer share
+	if err := ApplyMerger(target, acquirer, big.NewRat(1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if gained := new(big.Int).Sub(acquirer.TotalSupply(), tokens(5)); gained.Cmp(tokens(50)) != 0 {
+		t.Errorf("acquirer gained %s, want %s", gained, tokens(50))
+	}
+	checkBalance(t, acquirer, "0xALICE", tokens(30))
+	checkBalance(t, acquirer, "0xBOB", tokens(25))
+	checkHolders(t, target.SortedHolders(), target.balances)
+	if target.TotalSupply().Sign() != 0 || target.TotalHolders() != 0 {
+		t.Errorf("target left with supply %s and %d holders", target.TotalSupply(), target.TotalHolders())
+	}
+	checkSane(t, target)
+	checkSane(t, acquirer)
+}
+
+func TestStockMergerRebase(t *testing.T) {
+	target := newTestToken(t)
+	acquirer, err := NewStockToken("X", "X Corp", defaultDecimals, "$200.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquirer.LaxAddressValidation = true
+	mustMint(t, target, "0xALICE", 100)
+
+	if err := target.Rebase(StockMerger{Acquirer: acquirer, ExchangeRatio: big.NewRat(1, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, acquirer, "0xALICE", tokens(50))
+	if target.TotalSupply().Sign() != 0 {
+		t.Errorf("target supply = %s, want 0", target.TotalSupply())
+	}
+	// The merged-away holders leave the index as well as the balances
+	checkHolders(t, target.SortedHolders(), target.balances)
+	checkSane(t, target)
+}
+
+func TestMergePreservesValue(t *testing.T) {
+	acquiree, err := NewStockToken("AAA", "A Corp", defaultDecimals, "$75.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquirer, err := NewStockToken("BBB", "B Corp", defaultDecimals, "$100.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquiree.LaxAddressValidation, acquirer.LaxAddressValidation = true, true
+	for address, amount := range map[string]string{"0xALICE": "10", "0xBOB": "3.333333", "0xCAROL": "0.000001"} {
+		if err := acquiree.MintFractional(address, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustMint(t, acquirer, "0xDAVE", 5)
+
+	var events []MergerEvent
+	for _, st := range []*StockToken{acquiree, acquirer} {
+		st.RegisterMergerHook(func(event MergerEvent) { events = append(events, event) })
+	}
+	value := func() *big.Int {
+		total := new(big.Int).Mul(acquiree.TotalSupply(), acquiree.SharePrice())
+		return total.Add(total, new(big.Int).Mul(acquirer.TotalSupply(), acquirer.SharePrice()))
+	}
+	before := value()
+
+	// 0.75 BBB at $100 for each AAA at $75
+	if err := Merge(acquiree, acquirer, big.NewRat(3, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of the three holders loses less than one raw BBB unit to rounding
+	lost := new(big.Int).Sub(before, value())
+	if lost.Sign() < 0 || lost.Cmp(new(big.Int).Mul(big.NewInt(3), acquirer.SharePrice())) >= 0 {
+		t.Errorf("merger changed the total value by %s cent-units, want under 3 raw BBB", lost)
+	}
+	checkBalance(t, acquirer, "0xALICE", big.NewInt(7_500_000))
+	checkBalance(t, acquirer, "0xBOB", big.NewInt(2_499_999))
+	// Carol's single raw unit is worth less than one raw BBB unit
+	checkHolders(t, acquirer.SortedHolders(), acquirer.balances, "0xALICE", "0xBOB", "0xDAVE")
+	if acquiree.TotalSupply().Sign() != 0 || len(acquiree.balances) != 0 {
+		t.Errorf("acquiree left with supply %s and %d balances", acquiree.TotalSupply(), len(acquiree.balances))
+	}
+	if len(events) != 2 || events[0].Issued.Cmp(big.NewInt(9_999_999)) != 0 || events[0].Retired.Cmp(big.NewInt(13_333_334)) != 0 {
+		t.Errorf("merger events = %+v, want one per token issuing 9999999 for 13333334", events)
+	}
+	checkSane(t, acquiree)
+	checkSane(t, acquirer)
+}
+
+func TestMergeIntoPausedAcquirer(t *testing.T) {
+	acquiree, acquirer := newTestToken(t), newTestToken(t)
+	mustMint(t, acquiree, "0xALICE", 10)
+	if err := acquirer.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(acquiree, acquirer, big.NewRat(3, 4)); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("merge into a paused acquirer: err = %v, want %v", err, ErrTokenPaused)
+	}
+	checkBalance(t, acquiree, "0xALICE", tokens(10))
+	checkBalance(t, acquirer, "0xALICE", big.NewInt(0))
+}
+
+func TestMergeFrom(t *testing.T) {
+	st := newTestToken(t)
+	other := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	mustMint(t, other, "0xBOB", 3)
+	mustMint(t, other, "0xCAROL", 7)
+	mustMint(t, other, "0xDAVE", 4)
+	if err := other.Stake("0xDAVE", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := other.Vest("0xERIN", "6", start, start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	wantSupply := new(big.Int).Add(st.TotalSupply(), other.TotalSupply())
+
+	if err := st.MergeFrom(other); err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalSupply().Cmp(wantSupply) != 0 {
+		t.Errorf("merged supply = %s, want %s", st.TotalSupply(), wantSupply)
+	}
+	// 0xBOB held on both sides, the rest on one; 0xDAVE's balance is all staked
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE", "0xBOB", "0xCAROL", "0xERIN")
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkBalance(t, st, "0xBOB", tokens(8))
+	checkBalance(t, st, "0xCAROL", tokens(7))
+	if staked := st.StakedBalanceOf("0xDAVE"); staked.Cmp(tokens(4)) != 0 {
+		t.Errorf("merged staked balance = %s, want %s", staked, tokens(4))
+	}
+	if vested, err := st.VestedBalance("0xERIN", start.Add(time.Hour)); err != nil || vested.Cmp(tokens(6)) != 0 {
+		t.Errorf("merged grant vests %v, %v, want %s", vested, err, tokens(6))
+	}
+	checkSane(t, st)
+
+	if other.TotalSupply().Sign() != 0 || len(other.SortedHolders()) != 0 || len(other.balances) != 0 {
+		t.Errorf("merged-away token kept supply %s and holders %v", other.TotalSupply(), other.SortedHolders())
+	}
+	if staked := other.StakedBalanceOf("0xDAVE"); staked.Sign() != 0 {
+		t.Errorf("merged-away token kept staked balance %s", staked)
+	}
+	checkSane(t, other)
+}
+
+func TestMergeFromRejectsMismatchedTokens(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 1)
+	precise, err := NewStockToken("TSLA", "Tesla, Inc.", 18, "$100.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]*StockToken{"precision mismatch": precise, "other ticker": other} {
+		if err := st.MergeFrom(token); !errors.Is(err, ErrTokenMismatch) {
+			t.Errorf("merging a %s: err = %v, want %v", name, err, ErrTokenMismatch)
+		}
+	}
+
+	paused := newTestToken(t)
+	mustMint(t, paused, "0xBOB", 1)
+	if err := paused.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MergeFrom(paused); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("merging a paused token: err = %v, want %v", err, ErrTokenPaused)
+	}
+	if err := paused.MergeFrom(st); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("merging into a paused token: err = %v, want %v", err, ErrTokenPaused)
+	}
+	checkHolders(t, st.SortedHolders(), st.balances, "0xALICE")
+	checkHolders(t, paused.SortedHolders(), paused.balances, "0xBOB")
+}
@@ -0,0 +1,22 @@
+package main
+
+// TokenMetadata is a copy of a token's name, symbol and decimals
+type TokenMetadata struct {
+	Name     string
+	Symbol   string
+	Decimals uint
+}
+
+// Metadata returns the token's name, symbol and decimals
+func (t *StockToken) Metadata() TokenMetadata {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return TokenMetadata{Name: t.Name, Symbol: t.Symbol, Decimals: t.Decimals}
+}
+
+// Metadata returns the wrapper's name, symbol and decimals
+func (ow *OndoWrappedStock) Metadata() TokenMetadata {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return TokenMetadata{Name: ow.Name, Symbol: ow.Symbol, Decimals: ow.Decimals}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	st, err := NewStockToken("BRK.B", "Berkshire Hathaway", 8, "$400.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.LaxAddressValidation = true
+	ow := NewOndoWrappedStock(st)
+	want := TokenMetadata{Name: "Berkshire Hathaway", Symbol: "BRK.B", Decimals: 8}
+	if got := st.Metadata(); got != want {
+		t.Fatalf("Metadata = %+v, want %+v", got, want)
+	}
+	if st.Precision.Cmp(PrecisionFromDecimals(8)) != 0 {
+		t.Errorf("precision = %s, want 10^8", st.Precision)
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadStockToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Metadata(); got != want {
+		t.Errorf("loaded Metadata = %+v, want %+v", got, want)
+	}
+	if loaded.Precision.Cmp(st.Precision) != 0 {
+		t.Errorf("loaded precision = %s, want %s", loaded.Precision, st.Precision)
+	}
+
+	wantWrapped := TokenMetadata{Name: "Ondo Wrapped Berkshire Hathaway", Symbol: "owBRK.B", Decimals: 8}
+	if data, err = json.Marshal(ow); err != nil {
+		t.Fatal(err)
+	}
+	loadedWrapper, err := LoadOndoWrappedStock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loadedWrapper.Metadata(); got != wantWrapped {
+		t.Errorf("loaded wrapper Metadata = %+v, want %+v", got, wantWrapped)
+	}
+}
+
+func TestWrapperNameIsCopied(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	st.Name = "Tesla Motors"
+	st.Symbol = "TSLAQ"
+	want := TokenMetadata{Name: "Ondo Wrapped Tesla, Inc.", Symbol: "owTSLA", Decimals: defaultDecimals}
+	if got := ow.Metadata(); got != want {
+		t.Errorf("wrapper Metadata after renaming the underlying = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// BulkSetBalances replaces every balance with the provided data, e.g. when migrating from an
+// external ledger. Staked balances are kept, and totalSupply is recalculated from the new
+// balances plus the staked ones. The import is recorded in RebaseHistory as a "bulk_import"
+// with the change to every balance. Nothing changes on error. No transfer events are emitted
+// for the imported balances.
+func (t *StockToken) BulkSetBalances(balances map[string]*big.Int) error {
+	imported := make(map[string]*big.Int, len(balances))
+	for address, balance := range balances {
+		if balance == nil || balance.Sign() < 0 {
+			return fmt.Errorf("%w: negative or missing balance for %s", ErrInvalidAmount, address)
+		}
+		imported[address] = new(big.Int).Set(balance)
+	}
+
+	event, err := t.bulkSetBalances(imported)
+	if err != nil {
+		return err
+	}
+	t.publishRebase(event)
+	return nil
+}
+
+// bulkSetBalances performs BulkSetBalances under the write lock
+func (t *StockToken) bulkSetBalances(imported map[string]*big.Int) (RebaseEvent, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addresses := sortedAddresses(imported)
+	if err := t.checkAddresses(addresses...); err != nil {
+		return RebaseEvent{}, err
+	}
+	if t.isPaused {
+		return RebaseEvent{}, ErrTokenPaused
+	}
+
+	totalSupply := big.NewInt(0)
+	for _, balances := range []map[string]*big.Int{imported, t.stakedBalances} {
+		for _, balance := range balances {
+			totalSupply.Add(totalSupply, balance)
+		}
+	}
+	if totalSupply.Cmp(t.totalSupply) > 0 {
+		if err := t.checkSupplyCap(new(big.Int).Sub(totalSupply, t.totalSupply)); err != nil {
+			return RebaseEvent{}, err
+		}
+	}
+
+	event := RebaseEvent{
+		ActionType:      "bulk_import",
+		Timestamp:       t.now(),
+		PreTotalSupply:  t.totalSupply,
+		PostTotalSupply: new(big.Int).Set(totalSupply),
+		BalanceDiff:     balanceDiff(t.balances, imported),
+	}
+	t.setBalances(imported)
+	t.totalSupply = totalSupply
+	t.RebaseHistory = append(t.RebaseHistory, event)
+	return event, nil
+}
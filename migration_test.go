@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestBulkSetBalancesKeepsStaked(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.Stake("0xALICE", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xBOB": tokens(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.TotalSupply(), tokens(7); got.Cmp(want) != 0 {
+		t.Errorf("total supply = %s, want %s", got, want)
+	}
+	if got := st.StakedBalanceOf("0xALICE"); got.Cmp(tokens(4)) != 0 {
+		t.Errorf("staked balance = %s, want %s", got, tokens(4))
+	}
+	checkBalance(t, st, "0xALICE", big.NewInt(0))
+	checkSane(t, st)
+}
+
+func TestBulkSetBalancesRecordsImport(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	ch := make(chan RebaseEvent, 1)
+	st.SubscribeToRebase(ch)
+
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xALICE": tokens(4), "0xBOB": tokens(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.RebaseHistory) != 1 {
+		t.Fatalf("rebase history has %d entries, want 1", len(st.RebaseHistory))
+	}
+	event := st.RebaseHistory[0]
+	if event.ActionType != "bulk_import" {
+		t.Errorf("action type = %q, want bulk_import", event.ActionType)
+	}
+	if event.PreTotalSupply.Cmp(tokens(10)) != 0 || event.PostTotalSupply.Cmp(tokens(7)) != 0 {
+		t.Errorf("supply went from %s to %s, want %s to %s", event.PreTotalSupply, event.PostTotalSupply, tokens(10), tokens(7))
+	}
+	if got := event.BalanceDiff["0xALICE"]; got.Cmp(tokens(-6)) != 0 {
+		t.Errorf("0xALICE diff = %s, want %s", got, tokens(-6))
+	}
+	if got := event.BalanceDiff["0xBOB"]; got.Cmp(tokens(3)) != 0 {
+		t.Errorf("0xBOB diff = %s, want %s", got, tokens(3))
+	}
+	if len(ch) != 1 {
+		t.Error("bulk import was not published to rebase subscribers")
+	}
+}
+
+func TestBulkSetBalancesRejects(t *testing.T) {
+	st := newTestToken(t)
+	st.LaxAddressValidation = false
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xREECE": tokens(1)}); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("invalid address: err = %v, want ErrInvalidAddress", err)
+	}
+
+	st = newTestToken(t)
+	st.maxSupply = tokens(5)
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xALICE": tokens(6)}); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("import above the cap: err = %v, want ErrSupplyCap", err)
+	}
+
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xALICE": tokens(1)}); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("import while paused: err = %v, want ErrTokenPaused", err)
+	}
+	if got := st.TotalSupply(); got.Sign() != 0 || len(st.RebaseHistory) != 0 {
+		t.Errorf("rejected imports left supply %s and %d history entries", got, len(st.RebaseHistory))
+	}
+}
+
+func TestBulkSetBalancesImportsHundred(t *testing.T) {
+	st := newTestToken(t)
+	st.LaxAddressValidation = false
+	imported := make(map[string]*big.Int)
+	total := big.NewInt(0)
+	for i := 1; i <= 100; i++ {
+		address := fmt.Sprintf("0x%040x", i)
+		imported[address] = tokens(int64(i))
+		total.Add(total, imported[address])
+	}
+
+	if err := st.BulkSetBalances(imported); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SanityCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalSupply().Cmp(total) != 0 {
+		t.Errorf("total supply = %s, want %s", st.TotalSupply(), total)
+	}
+	if st.TotalHolders() != 100 {
+		t.Errorf("TotalHolders = %d, want 100", st.TotalHolders())
+	}
+	for address, balance := range imported {
+		checkBalance(t, st, address, balance)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !race
+
+package main
+
+// raceEnabled reports whether the race detector is on, which slows code down too much for
+// timing tests
+const raceEnabled = false
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// PriceOracle supplies the current share price, in cents, for a ticker
+type PriceOracle interface {
+	CurrentPrice(ticker string) (*big.Int, error)
+}
+
+// StaticOracle always reports the same price, e.g. for tests
+type StaticOracle struct {
+	PriceCents *big.Int
+}
+
+// CurrentPrice returns the fixed price for any ticker
+func (o StaticOracle) CurrentPrice(ticker string) (*big.Int, error) {
+	if o.PriceCents == nil {
+		return nil, errors.New("static oracle has no price")
+	}
+	return new(big.Int).Set(o.PriceCents), nil
+}
+
+// FuncOracle adapts an ordinary function to a PriceOracle
+type FuncOracle func(ticker string) (*big.Int, error)
+
+// CurrentPrice calls f(ticker)
+func (f FuncOracle) CurrentPrice(ticker string) (*big.Int, error) {
+	return f(ticker)
+}
+
+// AttachOracle sets the oracle used by RefreshPrice. While one is attached, every dividend
+// rebase refreshes the price first and pays at that price. A nil oracle detaches it.
+func (t *StockToken) AttachOracle(o PriceOracle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.oracle = o
+}
+
+// RefreshPrice sets the share price to the attached oracle's current price
+func (t *StockToken) RefreshPrice() error {
+	t.mu.RLock()
+	oracle := t.oracle
+	t.mu.RUnlock()
+	if oracle == nil {
+		return errors.New("no price oracle attached")
+	}
+
+	// The oracle is called without the lock, since it may be slow or read the token
+	price, err := oracle.CurrentPrice(t.ticker)
+	if err != nil {
+		return fmt.Errorf("refresh %s price: %w", t.ticker, err)
+	}
+	if price == nil || price.Sign() <= 0 {
+		return fmt.Errorf("%w: oracle price for %s must be positive", ErrInvalidAmount, t.ticker)
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setSharePrice(price)
+	return nil
+}
+
+// refreshDividendPrice refreshes the share price from the oracle before a dividend and returns
+// the action repriced at it. Other actions, or any action when no oracle is attached, are
+// returned unchanged.
+func (t *StockToken) refreshDividendPrice(action RebaseAction) (RebaseAction, error) {
+	switch action.(type) {
+	case Dividend, CappedDividend, CompoundDividend, DividendWithRecord:
+	default:
+		return action, nil
+	}
+
+	t.mu.RLock()
+	attached := t.oracle != nil
+	t.mu.RUnlock()
+	if !attached {
+		return action, nil
+	}
+
+	if err := t.RefreshPrice(); err != nil {
+		return nil, err
+	}
+	price := t.SharePrice()
+
+	switch v := action.(type) {
+	case Dividend:
+		v.sharePrice = price
+		return v, nil
+	case CappedDividend:
+		v.Dividend.sharePrice = price
+		return v, nil
+	case DividendWithRecord:
+		v.Dividend.sharePrice = price
+		return v, nil
+	case CompoundDividend:
+		dividends := make([]Dividend, len(v.Dividends))
+		for i, dividend := range v.Dividends {
+			dividend.sharePrice = price
+			dividends[i] = dividend
+		}
+		return CompoundDividend{Dividends: dividends}, nil
+	}
+	return action, nil
+}
+
+// SyncWithOracle prices the wrapped token with the oracle's price, in cents, for the wrapper's
+// ticker, and mints or burns underlying in the wrapper's custody so it backs the wrapped supply
+// at that price. The exchange rate becomes the underlying raw units worth the oracle price at
+// the underlying's share price. Minting is subject to the underlying's pause and supply cap,
+// and burning to its pause. It refuses to sync while nothing is wrapped. The sync is recorded
+// in the wrapper's event log as "oracle_sync".
+func (ow *OndoWrappedStock) SyncWithOracle(oracle PriceOracle, st *StockToken) error {
+	if oracle == nil || st == nil {
+		return errors.New("oracle and underlying token must not be nil")
+	}
+
+	// The oracle is called without the locks, since it may be slow or read the tokens
+	priceCents, err := oracle.CurrentPrice(ow.ticker)
+	if err != nil {
+		return fmt.Errorf("sync %s with oracle: %w", ow.ticker, err)
+	}
+	if priceCents == nil || priceCents.Sign() <= 0 {
+		return fmt.Errorf("%w: oracle price for %s must be positive", ErrInvalidAmount, ow.ticker)
+	}
+
+	rate, custody, err := ow.syncWithOracle(priceCents, st)
+	if err != nil {
+		return err
+	}
+	ow.EventLog.append("oracle_sync", ow.now(), map[string]string{
+		"price":   priceCents.String(),
+		"rate":    rate.String(),
+		"custody": custody.String(),
+	})
+	return nil
+}
+
+// syncWithOracle applies SyncWithOracle's price under both locks and returns the exchange rate
+// and the custody balance it leaves
+func (ow *OndoWrappedStock) syncWithOracle(priceCents *big.Int, st *StockToken) (rate, implied *big.Int, err error) {
+	defer st.emitEvents()
+	defer ow.emitEvents()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+
+	if ow.totalSupply.Sign() == 0 {
+		return nil, nil, fmt.Errorf("no %s wrapped to back at the oracle price", ow.ticker)
+	}
+	if st.sharePrice.Sign() == 0 {
+		return nil, nil, ErrZeroPrice
+	}
+
+	// Underlying raw units per whole wrapped token = price * Precision / share price
+	rate = new(big.Int).Mul(priceCents, ow.Precision)
+	rate.Div(rate, st.sharePrice)
+	if rate.Sign() == 0 {
+		return nil, nil, fmt.Errorf("%w: oracle price of %s is worth no %s", ErrInvalidAmount, formatCents(priceCents), st.ticker)
+	}
+
+	custody := big.NewInt(0)
+	if balance := st.balances[ow.ticker]; balance != nil {
+		custody.Set(balance)
+	}
+	implied = new(big.Int).Mul(ow.totalSupply, rate)
+	implied.Div(implied, ow.Precision)
+
+	switch delta := new(big.Int).Sub(implied, custody); delta.Sign() {
+	case 1:
+		if err := st.checkMint(delta, ow.ticker); err != nil {
+			return nil, nil, err
+		}
+		st.mint(ow.ticker, delta)
+	case -1:
+		if st.isPaused {
+			return nil, nil, ErrTokenPaused
+		}
+		delta.Neg(delta)
+		st.debit(ow.ticker, delta)
+		st.totalSupply.Sub(st.totalSupply, delta)
+		st.hooks.record("burn", ow.ticker, "", delta, st.now())
+	}
+
+	ow.exchangeRate = rate
+	ow.recordRate(st.now())
+	return rate, implied, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newSyncWrapper returns a wrapper holding 10 wrapped tokens for 0xALICE at a rate of one
+func newSyncWrapper(tb testing.TB) (*StockToken, *OndoWrappedStock) {
+	tb.Helper()
+	st := newTestToken(tb)
+	ow := NewOndoWrappedStock(st)
+	mustMint(tb, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		tb.Fatal(err)
+	}
+	return st, ow
+}
+
+func TestSyncWithOracle(t *testing.T) {
+	st, ow := newSyncWrapper(t)
+	custody := func() *big.Int { return st.BalanceOf(ow.ticker) }
+
+	clock := newFakeClock()
+	ow.Clock = clock
+
+	// $150 is worth 1.5 underlying tokens at $100 a share
+	rate := new(big.Int).Div(tokens(3), big.NewInt(2))
+	if err := ow.SyncWithOracle(StaticOracle{PriceCents: big.NewInt(15000)}, st); err != nil {
+		t.Fatal(err)
+	}
+	if ow.exchangeRate.Cmp(rate) != 0 {
+		t.Errorf("exchange rate = %s, want %s", ow.exchangeRate, rate)
+	}
+	if custody().Cmp(tokens(15)) != 0 {
+		t.Errorf("custody = %s, want %s", custody(), tokens(15))
+	}
+	checkSane(t, st)
+	if entries := ow.Filter("oracle_sync", time.Time{}); len(entries) != 1 || entries[0].Fields["rate"] != rate.String() || !entries[0].BlockTime.Equal(clock.Now()) {
+		t.Errorf("oracle_sync entries = %v, want one at rate %s stamped %s", entries, rate, clock.Now())
+	}
+	if last := ow.RateHistory[len(ow.RateHistory)-1]; last.Rate.Cmp(rate) != 0 {
+		t.Errorf("last recorded rate = %s, want %s", last.Rate, rate)
+	}
+
+	// A lower price burns the excess custody
+	if err := ow.SyncWithOracle(StaticOracle{PriceCents: big.NewInt(5000)}, st); err != nil {
+		t.Fatal(err)
+	}
+	if custody().Cmp(tokens(5)) != 0 || st.TotalSupply().Cmp(tokens(5)) != 0 {
+		t.Errorf("custody = %s and supply = %s, want both %s", custody(), st.TotalSupply(), tokens(5))
+	}
+	checkSane(t, st)
+}
+
+func TestSyncWithOracleRespectsCapAndPause(t *testing.T) {
+	st, ow := newSyncWrapper(t)
+	st.maxSupply = tokens(12)
+	double := StaticOracle{PriceCents: big.NewInt(20000)}
+	if err := ow.SyncWithOracle(double, st); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("sync above the cap: err = %v, want ErrSupplyCap", err)
+	}
+
+	st.maxSupply = nil
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.SyncWithOracle(double, st); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("mint while paused: err = %v, want ErrTokenPaused", err)
+	}
+	if err := ow.SyncWithOracle(StaticOracle{PriceCents: big.NewInt(5000)}, st); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("burn while paused: err = %v, want ErrTokenPaused", err)
+	}
+
+	if ow.exchangeRate.Cmp(tokens(1)) != 0 || st.BalanceOf(ow.ticker).Cmp(tokens(10)) != 0 {
+		t.Errorf("failed syncs changed the rate to %s and custody to %s", ow.exchangeRate, st.BalanceOf(ow.ticker))
+	}
+	if err := ow.SyncWithOracle(StaticOracle{PriceCents: big.NewInt(0)}, st); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("zero price: err = %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestSyncWithOracleNeedsWrappedSupply(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.SyncWithOracle(StaticOracle{PriceCents: big.NewInt(15000)}, st); err == nil {
+		t.Error("SyncWithOracle succeeded with nothing wrapped")
+	}
+	if ow.exchangeRate.Cmp(tokens(1)) != 0 || len(ow.RateHistory) != 0 || len(ow.Filter("oracle_sync", time.Time{})) != 0 {
+		t.Errorf("refused sync changed the rate to %s", ow.exchangeRate)
+	}
+	checkBalance(t, st, ow.ticker, big.NewInt(0))
+}
+
+func TestRefreshPriceFromFuncOracle(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	if err := st.RefreshPrice(); err == nil {
+		t.Error("RefreshPrice without an oracle succeeded")
+	}
+
+	// Each call moves the price up by $10, from $100
+	calls := 0
+	st.AttachOracle(FuncOracle(func(ticker string) (*big.Int, error) {
+		if ticker != "TSLA" {
+			t.Errorf("oracle asked for %q", ticker)
+		}
+		calls++
+		return big.NewInt(10000 + int64(calls)*1000), nil
+	}))
+
+	if err := st.RefreshPrice(); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.SharePrice(); got.Cmp(big.NewInt(11000)) != 0 {
+		t.Errorf("share price = %s, want 11000", got)
+	}
+
+	// The dividend refreshes the price to $120 first, so $6 a share pays 5% and not 6%
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(600), sharePrice: big.NewInt(10000)}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("oracle called %d times, want 2", calls)
+	}
+	checkBalance(t, st, "0xALICE", tokens(105))
+
+	// Other actions do not consult the oracle
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("a split called the oracle, %d calls", calls)
+	}
+}
+
+func TestRefreshPriceRejectsOracleFailures(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	failure := errors.New("feed down")
+	for _, oracle := range []PriceOracle{
+		FuncOracle(func(string) (*big.Int, error) { return nil, failure }),
+		FuncOracle(func(string) (*big.Int, error) { return big.NewInt(0), nil }),
+		StaticOracle{},
+	} {
+		st.AttachOracle(oracle)
+		if err := st.RefreshPrice(); err == nil {
+			t.Errorf("RefreshPrice with %T succeeded", oracle)
+		}
+		// A dividend is not paid at a stale price when the refresh fails
+		if err := st.Rebase(Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}); err == nil {
+			t.Errorf("dividend with a failing %T oracle succeeded", oracle)
+		}
+		checkBalance(t, st, "0xALICE", tokens(10))
+	}
+	if got := st.SharePrice(); got.Cmp(big.NewInt(10000)) != 0 {
+		t.Errorf("share price = %s after failed refreshes, want 10000", got)
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// stockTokenJSON is the persisted form of a StockToken. Amounts are decimal strings so
+// no precision is lost to JSON numbers.
+type stockTokenJSON struct {
+	Ticker             string                       `json:"ticker"`
+	Name               string                       `json:"name,omitempty"`
+	Symbol             string                       `json:"symbol,omitempty"`
+	Owner              string                       `json:"owner"`
+	LaxAddresses       bool                         `json:"laxAddresses,omitempty"`
+	Paused             bool                         `json:"paused,omitempty"`
+	Precision          string                       `json:"precision"`
+	TotalSupply        string                       `json:"totalSupply"`
+	MaxSupply          string                       `json:"maxSupply,omitempty"`
+	Balances           map[string]string            `json:"balances"`
+	StakedBalances     map[string]string            `json:"stakedBalances,omitempty"`
+	YieldMultiplier    string                       `json:"yieldMultiplier,omitempty"`
+	RebaseMultiplier   string                       `json:"rebaseMultiplier"`
+	SharePrice         string                       `json:"sharePrice"`
+	FloorPrice         string                       `json:"floorPrice,omitempty"`
+	Allowances         map[string]map[string]string `json:"allowances,omitempty"`
+	FeeRecipient       string                       `json:"feeRecipient,omitempty"`
+	DustAddress        string                       `json:"dustAddress,omitempty"`
+	TreasuryAddress    string                       `json:"treasuryAddress,omitempty"`
+	FlatFee            string                       `json:"flatFee,omitempty"`
+	FeeBps             uint                         `json:"feeBps,omitempty"`
+	FeeSplits          []FeeSplit                   `json:"feeSplits,omitempty"`
+	WithholdingTaxBps  map[string]uint              `json:"withholdingTaxBps,omitempty"`
+	TaxWithheld        map[string]string            `json:"taxWithheld,omitempty"`
+	UnclaimedDividends map[string]string            `json:"unclaimedDividends,omitempty"`
+	AppliedActions     []string                     `json:"appliedActions,omitempty"`
+	TransferLockups    map[string]time.Time         `json:"transferLockups,omitempty"`
+	VestingSchedules   map[string][]vestingJSON     `json:"vestingSchedules,omitempty"`
+	RebaseHistory      []rebaseEventJSON            `json:"rebaseHistory,omitempty"`
+	RebaseCount        int                          `json:"rebaseCount"`
+	SplitCount         int                          `json:"splitCount"`
+	DividendCount      int                          `json:"dividendCount"`
+}
+
+// vestingJSON is the persisted form of a VestingSchedule, with its times in unix seconds
+type vestingJSON struct {
+	TotalAmount string `json:"totalAmount"`
+	StartTime   string `json:"startTime"`
+	EndTime     string `json:"endTime"`
+}
+
+// rebaseEventJSON is the persisted form of a RebaseEvent. Balance diffs may be negative.
+type rebaseEventJSON struct {
+	ActionType      string            `json:"actionType"`
+	Timestamp       time.Time         `json:"timestamp"`
+	PreTotalSupply  string            `json:"preTotalSupply"`
+	PostTotalSupply string            `json:"postTotalSupply"`
+	BalanceDiff     map[string]string `json:"balanceDiff,omitempty"`
+	Actions         []string          `json:"actions,omitempty"`
+	DividendYield   string            `json:"dividendYield,omitempty"`
+}
+
+// MarshalJSON encodes the token's metadata and ledger: owner, address validation mode, pause
+// state, balances, staked balances and yield multiplier, supply and cap, price, allowances,
+// fee and tax settings, dust and treasury addresses, unclaimed dividends, transfer lockups,
+// vesting schedules, rebase history and counters. Hooks, rebase subscribers, a running
+// scheduler, the price feed, balance snapshots and issued instruments (rights, warrants,
+// notes and subscriptions) are not included.
+func (t *StockToken) MarshalJSON() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	data := stockTokenJSON{
+		Ticker:             t.ticker,
+		Name:               t.Name,
+		Symbol:             t.Symbol,
+		Owner:              t.owner,
+		LaxAddresses:       t.LaxAddressValidation,
+		Paused:             t.isPaused,
+		Precision:          t.Precision.String(),
+		TotalSupply:        t.totalSupply.String(),
+		Balances:           amountStrings(t.balances),
+		RebaseMultiplier:   t.rebaseMultiplier.String(),
+		SharePrice:         t.sharePrice.String(),
+		FeeRecipient:       t.FeeRecipient,
+		DustAddress:        t.dustAddress,
+		TreasuryAddress:    t.treasuryAddress,
+		FeeBps:             t.feeBps,
+		FeeSplits:          t.feeSplits,
+		WithholdingTaxBps:  t.withholdingTaxBps,
+		TaxWithheld:        amountStrings(t.TaxWithheld),
+		UnclaimedDividends: amountStrings(t.UnclaimedDividends),
+		RebaseCount:        t.rebaseCount,
+		SplitCount:         t.splitCount,
+		DividendCount:      t.dividendCount,
+	}
+	if t.maxSupply != nil {
+		data.MaxSupply = t.maxSupply.String()
+	}
+	if len(t.stakedBalances) > 0 {
+		data.StakedBalances = amountStrings(t.stakedBalances)
+	}
+	if t.YieldMultiplier != nil {
+		data.YieldMultiplier = t.YieldMultiplier.String()
+	}
+	if t.floorPrice != nil {
+		data.FloorPrice = t.floorPrice.String()
+	}
+	if t.flatFee != nil {
+		data.FlatFee = t.flatFee.String()
+	}
+	if len(t.allowances) > 0 {
+		data.Allowances = make(map[string]map[string]string, len(t.allowances))
+		for owner, spenders := range t.allowances {
+			data.Allowances[owner] = amountStrings(spenders)
+		}
+	}
+	for actionID := range t.appliedActions {
+		data.AppliedActions = append(data.AppliedActions, actionID)
+	}
+	sort.Strings(data.AppliedActions)
+	if len(t.transferRestrictions) > 0 {
+		data.TransferLockups = t.transferRestrictions
+	}
+	if len(t.vestingSchedules) > 0 {
+		data.VestingSchedules = make(map[string][]vestingJSON, len(t.vestingSchedules))
+		for address, schedules := range t.vestingSchedules {
+			for _, s := range schedules {
+				data.VestingSchedules[address] = append(data.VestingSchedules[address], vestingJSON{
+					TotalAmount: s.TotalAmount.String(),
+					StartTime:   s.StartTime.String(),
+					EndTime:     s.EndTime.String(),
+				})
+			}
+		}
+	}
+	for _, event := range t.RebaseHistory {
+		encoded := rebaseEventJSON{
+			ActionType:      event.ActionType,
+			Timestamp:       event.Timestamp,
+			PreTotalSupply:  event.PreTotalSupply.String(),
+			PostTotalSupply: event.PostTotalSupply.String(),
+			BalanceDiff:     amountStrings(event.BalanceDiff),
+			Actions:         event.Actions,
+		}
+		if event.DividendYield != nil {
+			encoded.DividendYield = event.DividendYield.String()
+		}
+		data.RebaseHistory = append(data.RebaseHistory, encoded)
+	}
+
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON replaces the token's ledger with one encoded by MarshalJSON. The balances and
+// staked balances must add up to the total supply. Nothing changes on error. Fields that
+// MarshalJSON does not encode are left as they are.
+func (t *StockToken) UnmarshalJSON(b []byte) error {
+	var data stockTokenJSON
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	if data.Ticker == "" {
+		return errors.New("token ticker is empty")
+	}
+	if data.Owner == "" {
+		return errors.New("token owner is empty")
+	}
+	precision, err := parsePrecision(data.Precision)
+	if err != nil {
+		return err
+	}
+
+	totalSupply, err := parseAmount("total supply", data.TotalSupply)
+	if err != nil {
+		return err
+	}
+	balances, err := parseAmounts("balance", data.Balances)
+	if err != nil {
+		return err
+	}
+	var stakedBalances map[string]*big.Int
+	if len(data.StakedBalances) > 0 {
+		if stakedBalances, err = parseAmounts("staked balance", data.StakedBalances); err != nil {
+			return err
+		}
+	}
+	var yieldMultiplier *big.Rat
+	if data.YieldMultiplier != "" {
+		var ok bool
+		yieldMultiplier, ok = new(big.Rat).SetString(data.YieldMultiplier)
+		if !ok || yieldMultiplier.Sign() < 0 {
+			return fmt.Errorf("invalid yield multiplier %q", data.YieldMultiplier)
+		}
+	}
+	sum := big.NewInt(0)
+	for _, amounts := range []map[string]*big.Int{balances, stakedBalances} {
+		for _, amount := range amounts {
+			sum.Add(sum, amount)
+		}
+	}
+	if sum.Cmp(totalSupply) != 0 {
+		return fmt.Errorf("balances and staked balances add up to %s but total supply is %s", sum, totalSupply)
+	}
+	rebaseMultiplier, ok := new(big.Rat).SetString(data.RebaseMultiplier)
+	if !ok || rebaseMultiplier.Sign() <= 0 {
+		return fmt.Errorf("invalid rebase multiplier %q", data.RebaseMultiplier)
+	}
+	sharePrice, err := parseAmount("share price", data.SharePrice)
+	if err != nil {
+		return err
+	}
+
+	var maxSupply, floorPrice, flatFee *big.Int
+	if data.MaxSupply != "" {
+		if maxSupply, err = parseAmount("max supply", data.MaxSupply); err != nil {
+			return err
+		}
+	}
+	if data.FloorPrice != "" {
+		if floorPrice, err = parseAmount("floor price", data.FloorPrice); err != nil {
+			return err
+		}
+	}
+	if data.FlatFee != "" {
+		if flatFee, err = parseAmount("flat fee", data.FlatFee); err != nil {
+			return err
+		}
+	}
+
+	var allowances map[string]map[string]*big.Int
+	if len(data.Allowances) > 0 {
+		allowances = make(map[string]map[string]*big.Int, len(data.Allowances))
+		for owner, spenders := range data.Allowances {
+			if allowances[owner], err = parseAmounts("allowance", spenders); err != nil {
+				return err
+			}
+		}
+	}
+
+	var taxWithheld map[string]*big.Int
+	if len(data.TaxWithheld) > 0 {
+		if taxWithheld, err = parseAmounts("tax withheld", data.TaxWithheld); err != nil {
+			return err
+		}
+	}
+
+	var unclaimedDividends map[string]*big.Int
+	if len(data.UnclaimedDividends) > 0 {
+		if unclaimedDividends, err = parseAmounts("unclaimed dividend", data.UnclaimedDividends); err != nil {
+			return err
+		}
+	}
+
+	var appliedActions map[string]bool
+	if len(data.AppliedActions) > 0 {
+		appliedActions = make(map[string]bool, len(data.AppliedActions))
+		for _, actionID := range data.AppliedActions {
+			appliedActions[actionID] = true
+		}
+	}
+
+	var vestingSchedules map[string][]*VestingSchedule
+	if len(data.VestingSchedules) > 0 {
+		vestingSchedules = make(map[string][]*VestingSchedule, len(data.VestingSchedules))
+		for address, schedules := range data.VestingSchedules {
+			for _, s := range schedules {
+				totalAmount, err := parseAmount("vesting amount", s.TotalAmount)
+				if err != nil {
+					return fmt.Errorf("%s: %w", address, err)
+				}
+				startTime, err := parseAmount("vesting start", s.StartTime)
+				if err != nil {
+					return fmt.Errorf("%s: %w", address, err)
+				}
+				endTime, err := parseAmount("vesting end", s.EndTime)
+				if err != nil {
+					return fmt.Errorf("%s: %w", address, err)
+				}
+				if endTime.Cmp(startTime) <= 0 {
+					return fmt.Errorf("%s: vesting must end after it starts", address)
+				}
+				vestingSchedules[address] = append(vestingSchedules[address], &VestingSchedule{
+					TotalAmount: totalAmount,
+					StartTime:   startTime,
+					EndTime:     endTime,
+				})
+			}
+		}
+	}
+
+	var history []RebaseEvent
+	for i, event := range data.RebaseHistory {
+		preTotalSupply, err := parseAmount("pre-rebase supply", event.PreTotalSupply)
+		if err != nil {
+			return fmt.Errorf("rebase %d: %w", i, err)
+		}
+		postTotalSupply, err := parseAmount("post-rebase supply", event.PostTotalSupply)
+		if err != nil {
+			return fmt.Errorf("rebase %d: %w", i, err)
+		}
+		diff := make(map[string]*big.Int, len(event.BalanceDiff))
+		for address, s := range event.BalanceDiff {
+			change, ok := new(big.Int).SetString(s, 10)
+			if !ok {
+				return fmt.Errorf("rebase %d: invalid balance diff %q for %s", i, s, address)
+			}
+			diff[address] = change
+		}
+		var yield *big.Rat
+		if event.DividendYield != "" {
+			var ok bool
+			yield, ok = new(big.Rat).SetString(event.DividendYield)
+			if !ok || yield.Sign() < 0 {
+				return fmt.Errorf("rebase %d: invalid dividend yield %q", i, event.DividendYield)
+			}
+		}
+		history = append(history, RebaseEvent{
+			ActionType:      event.ActionType,
+			Timestamp:       event.Timestamp,
+			PreTotalSupply:  preTotalSupply,
+			PostTotalSupply: postTotalSupply,
+			BalanceDiff:     diff,
+			Actions:         event.Actions,
+			DividendYield:   yield,
+		})
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Precision = precision
+	t.Name = data.Name
+	t.Symbol = data.Symbol
+	t.Decimals = uint(precisionDecimals(precision))
+	t.ticker = data.Ticker
+	t.owner = data.Owner
+	t.LaxAddressValidation = data.LaxAddresses
+	t.isPaused = data.Paused
+	t.totalSupply = totalSupply
+	t.maxSupply = maxSupply
+	t.setBalances(balances)
+	t.stakedBalances = stakedBalances
+	t.YieldMultiplier = yieldMultiplier
+	t.rebaseMultiplier = rebaseMultiplier
+	t.sharePrice = sharePrice
+	t.floorPrice = floorPrice
+	t.allowances = allowances
+	t.FeeRecipient = data.FeeRecipient
+	t.dustAddress = data.DustAddress
+	t.treasuryAddress = data.TreasuryAddress
+	t.flatFee = flatFee
+	t.feeBps = data.FeeBps
+	t.feeSplits = data.FeeSplits
+	t.withholdingTaxBps = data.WithholdingTaxBps
+	t.TaxWithheld = taxWithheld
+	t.UnclaimedDividends = unclaimedDividends
+	t.appliedActions = appliedActions
+	t.transferRestrictions = data.TransferLockups
+	t.vestingSchedules = vestingSchedules
+	t.RebaseHistory = history
+	t.rebaseCount = data.RebaseCount
+	t.splitCount = data.SplitCount
+	t.dividendCount = data.DividendCount
+	return nil
+}
+
+// LoadStockToken creates a token from JSON produced by MarshalJSON, with an empty event log
+func LoadStockToken(data []byte) (*StockToken, error) {
+	log := newEventLog()
+	t := &StockToken{seq: tokenSeq.Add(1), EventLog: log, hooks: eventHooks{log: log}}
+	if err := t.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ondoWrappedStockJSON is the persisted form of an OndoWrappedStock
+type ondoWrappedStockJSON struct {
+	Ticker         string                       `json:"ticker"`
+	Name           string                       `json:"name,omitempty"`
+	Symbol         string                       `json:"symbol,omitempty"`
+	Precision      string                       `json:"precision"`
+	TotalSupply    string                       `json:"totalSupply"`
+	Balances       map[string]string            `json:"balances"`
+	ExchangeRate   string                       `json:"exchangeRate"`
+	Treasury       string                       `json:"treasury,omitempty"`
+	Allowances     map[string]map[string]string `json:"allowances,omitempty"`
+	FeeBps         uint64                       `json:"feeBps,omitempty"`
+	FeeRecipient   string                       `json:"feeRecipient,omitempty"`
+	TransferFeeBps uint64                       `json:"transferFeeBps,omitempty"`
+	RoundingMode   RoundingMode                 `json:"roundingMode,omitempty"`
+	RoundingDust   string                       `json:"roundingDust,omitempty"`
+}
+
+// MarshalJSON encodes the wrapper's metadata, balances, supply, exchange rate, treasury,
+// allowances, protocol and transfer fees, rounding mode and rounding dust
+func (ow *OndoWrappedStock) MarshalJSON() ([]byte, error) {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	data := ondoWrappedStockJSON{
+		Ticker:         ow.ticker,
+		Name:           ow.Name,
+		Symbol:         ow.Symbol,
+		Precision:      ow.Precision.String(),
+		TotalSupply:    ow.totalSupply.String(),
+		Balances:       amountStrings(ow.balances),
+		ExchangeRate:   ow.exchangeRate.String(),
+		Treasury:       ow.treasury,
+		FeeBps:         ow.FeeBasisPoints,
+		FeeRecipient:   ow.FeeRecipient,
+		TransferFeeBps: ow.TransferFeeBps,
+		RoundingMode:   ow.DefaultRoundingMode,
+	}
+	if ow.roundingDust != nil && ow.roundingDust.Sign() != 0 {
+		data.RoundingDust = ow.roundingDust.String()
+	}
+	if len(ow.allowances) > 0 {
+		data.Allowances = make(map[string]map[string]string, len(ow.allowances))
+		for owner, spenders := range ow.allowances {
+			data.Allowances[owner] = amountStrings(spenders)
+		}
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON replaces the wrapper's state with one encoded by MarshalJSON. Nothing changes on error.
+func (ow *OndoWrappedStock) UnmarshalJSON(b []byte) error {
+	var data ondoWrappedStockJSON
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	if data.Ticker == "" {
+		return errors.New("wrapper ticker is empty")
+	}
+	precision, err := parsePrecision(data.Precision)
+	if err != nil {
+		return err
+	}
+
+	totalSupply, err := parseAmount("total supply", data.TotalSupply)
+	if err != nil {
+		return err
+	}
+	balances, err := parseAmounts("balance", data.Balances)
+	if err != nil {
+		return err
+	}
+	exchangeRate, err := parseAmount("exchange rate", data.ExchangeRate)
+	if err != nil {
+		return err
+	}
+	if exchangeRate.Sign() == 0 {
+		return fmt.Errorf("%w: exchange rate must be positive", ErrInvalidAmount)
+	}
+	if data.FeeBps > bpsDenominator || data.FeeBps > 0 && data.FeeRecipient == "" {
+		return fmt.Errorf("invalid wrapper fee of %d bps to %q", data.FeeBps, data.FeeRecipient)
+	}
+	if data.TransferFeeBps > bpsDenominator || data.TransferFeeBps > 0 && data.FeeRecipient == "" {
+		return fmt.Errorf("invalid wrapper transfer fee of %d bps to %q", data.TransferFeeBps, data.FeeRecipient)
+	}
+
+	var allowances map[string]map[string]*big.Int
+	if len(data.Allowances) > 0 {
+		allowances = make(map[string]map[string]*big.Int, len(data.Allowances))
+		for owner, spenders := range data.Allowances {
+			if allowances[owner], err = parseAmounts("allowance", spenders); err != nil {
+				return err
+			}
+		}
+	}
+	if data.RoundingMode < RoundDown || data.RoundingMode > RoundHalfEven {
+		return fmt.Errorf("invalid rounding mode %d", data.RoundingMode)
+	}
+	var roundingDust *big.Int
+	if data.RoundingDust != "" {
+		var ok bool
+		if roundingDust, ok = new(big.Int).SetString(data.RoundingDust, 10); !ok {
+			return fmt.Errorf("invalid rounding dust %q", data.RoundingDust)
+		}
+	}
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	ow.Precision = precision
+	ow.Name = data.Name
+	ow.Symbol = data.Symbol
+	ow.Decimals = uint(precisionDecimals(precision))
+	ow.ticker = data.Ticker
+	ow.totalSupply = totalSupply
+	ow.setBalances(balances)
+	ow.exchangeRate = exchangeRate
+	ow.treasury = data.Treasury
+	ow.allowances = allowances
+	ow.DefaultRoundingMode = data.RoundingMode
+	ow.roundingDust = roundingDust
+	ow.FeeBasisPoints = data.FeeBps
+	ow.FeeRecipient = data.FeeRecipient
+	ow.TransferFeeBps = data.TransferFeeBps
+	return nil
+}
+
+// LoadOndoWrappedStock creates a wrapper from JSON produced by MarshalJSON, with an empty event log
+// and rate history
+func LoadOndoWrappedStock(data []byte) (*OndoWrappedStock, error) {
+	log := newEventLog()
+	ow := &OndoWrappedStock{MaxRateHistory: defaultMaxRateHistory, EventLog: log, hooks: eventHooks{log: log}}
+	if err := ow.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+// amountStrings converts amounts to decimal strings, keeping the same keys
+func amountStrings(amounts map[string]*big.Int) map[string]string {
+	if amounts == nil {
+		return nil
+	}
+	result := make(map[string]string, len(amounts))
+	for key, amount := range amounts {
+		result[key] = amount.String()
+	}
+	return result
+}
+
+// parseAmounts parses decimal strings produced by amountStrings. The result is never nil.
+func parseAmounts(field string, amounts map[string]string) (map[string]*big.Int, error) {
+	result := make(map[string]*big.Int, len(amounts))
+	for key, s := range amounts {
+		amount, err := parseAmount(field, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		result[key] = amount
+	}
+	return result, nil
+}
+
+// parseAmount parses a non-negative decimal integer; field names the value in errors
+func parseAmount(field, s string) (*big.Int, error) {
+	amount, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s %q", field, s)
+	}
+	if amount.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %s must be non-negative", ErrInvalidAmount, field)
+	}
+	return amount, nil
+}
+
+// parsePrecision parses a precision and checks that it is a power of ten
+func parsePrecision(s string) (*big.Int, error) {
+	precision, ok := new(big.Int).SetString(s, 10)
+	if !ok || precision.Sign() <= 0 || PrecisionFromDecimals(uint(precisionDecimals(precision))).Cmp(precision) != 0 {
+		return nil, fmt.Errorf("invalid precision %q", s)
+	}
+	return precision, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// populatedToken returns a token with something set in every persisted field
+func populatedToken(t *testing.T) *StockToken {
+	t.Helper()
+	st := newTestToken(t)
+	st.maxSupply = tokens(1000)
+	st.YieldMultiplier = big.NewRat(3, 2)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	if err := st.Stake("0xBOB", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Approve("0xALICE", "0xBOB", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetFloorPrice(big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	st.FeeRecipient = "0xFEES"
+	if err := st.SetTransactionFee(big.NewInt(1), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetWithholdingTaxBps("0xALICE", 1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetTransferRestriction("0xBOB", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// roundTrip encodes st, loads it into a new token and checks that encoding that gives the
+// same JSON
+func roundTrip(t *testing.T, st *StockToken) *StockToken {
+	t.Helper()
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadStockToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("round trip changed the encoding:\n%s\n%s", data, again)
+	}
+	return loaded
+}
+
+func TestStockTokenRoundTrip(t *testing.T) {
+	st := populatedToken(t)
+	loaded := roundTrip(t, st)
+
+	for _, address := range st.Holders() {
+		checkBalance(t, loaded, address, st.BalanceOf(address))
+	}
+	if got, want := loaded.StakedBalanceOf("0xBOB"), st.StakedBalanceOf("0xBOB"); got.Cmp(want) != 0 {
+		t.Errorf("staked balance = %s, want %s", got, want)
+	}
+	if got, want := loaded.TotalSupply(), st.TotalSupply(); got.Cmp(want) != 0 {
+		t.Errorf("total supply = %s, want %s", got, want)
+	}
+	if got, want := loaded.Allowance("0xALICE", "0xBOB"), st.Allowance("0xALICE", "0xBOB"); got.Cmp(want) != 0 {
+		t.Errorf("allowance = %s, want %s", got, want)
+	}
+	checkSane(t, loaded)
+}
+
+func TestStockTokenRoundTripKeepsLockups(t *testing.T) {
+	st := populatedToken(t)
+	loaded := roundTrip(t, st)
+	if err := loaded.Interact("0xBOB", "0xALICE", tokens(1), nil); !errors.Is(err, ErrTransferRestricted) {
+		t.Errorf("transfer during a persisted lockup: err = %v, want ErrTransferRestricted", err)
+	}
+}
+
+func TestUnmarshalRejectsSupplyMismatch(t *testing.T) {
+	st := populatedToken(t)
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supply := `"totalSupply":"` + st.TotalSupply().String() + `"`
+	tampered := strings.Replace(string(data), supply, `"totalSupply":"1"`, 1)
+	if tampered == string(data) {
+		t.Fatal("total supply not found in the encoding")
+	}
+	if _, err := LoadStockToken([]byte(tampered)); err == nil {
+		t.Error("loading balances that do not add up to the total supply succeeded")
+	}
+}
+
+func TestStockTokenRoundTripKeepsHistory(t *testing.T) {
+	st := populatedToken(t)
+	if err := st.BulkSetBalances(map[string]*big.Int{"0xALICE": tokens(1)}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := roundTrip(t, st)
+	if len(loaded.RebaseHistory) != 2 {
+		t.Fatalf("loaded %d history entries, want 2", len(loaded.RebaseHistory))
+	}
+	for i, event := range loaded.RebaseHistory {
+		want := st.RebaseHistory[i]
+		if event.ActionType != want.ActionType || !event.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("entry %d = %s at %s, want %s at %s", i, event.ActionType, event.Timestamp, want.ActionType, want.Timestamp)
+		}
+	}
+	if got := loaded.RebaseHistory[0].DividendYield; got == nil || got.Cmp(big.NewRat(1, 100)) != 0 {
+		t.Errorf("dividend yield = %v, want 1/100", got)
+	}
+	if loaded.RebaseHistory[1].DividendYield != nil {
+		t.Errorf("import dividend yield = %s, want nil", loaded.RebaseHistory[1].DividendYield)
+	}
+	// The import lowered 0xALICE's balance, so its diff is negative
+	if got, want := loaded.RebaseHistory[1].BalanceDiff["0xALICE"], st.RebaseHistory[1].BalanceDiff["0xALICE"]; got.Sign() >= 0 || got.Cmp(want) != 0 {
+		t.Errorf("0xALICE diff = %s, want %s", got, want)
+	}
+}
+
+func TestStockTokenRoundTripKeepsDustAddress(t *testing.T) {
+	st := populatedToken(t)
+	st.SetDustAddress("0xDUST")
+	loaded := roundTrip(t, st)
+	if err := loaded.Rebase(StockSplit{Numerator: big.NewInt(3), Denominator: big.NewInt(7)}); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.BalanceOf("0xDUST").Sign() == 0 {
+		t.Error("split dust did not go to the persisted dust address")
+	}
+}
+
+func TestStockTokenRoundTripKeepsAddressMode(t *testing.T) {
+	for _, lax := range []bool{false, true} {
+		st := newTestToken(t)
+		st.LaxAddressValidation = lax
+		if got := roundTrip(t, st).LaxAddressValidation; got != lax {
+			t.Errorf("LaxAddressValidation = %t after a round trip, want %t", got, lax)
+		}
+	}
+}
+
+func TestStockTokenRoundTripKeepsVesting(t *testing.T) {
+	st := populatedToken(t)
+	now := time.Now()
+	if err := st.Vest("0xCAROL", "5", now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	loaded := roundTrip(t, st)
+	if err := loaded.Interact("0xCAROL", "0xALICE", tokens(5), nil); !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("transferring a persisted unvested grant: err = %v, want ErrBalanceLocked", err)
+	}
+}
+
+func TestStockTokenRoundTripKeepsTreasury(t *testing.T) {
+	st := populatedToken(t)
+	if err := st.SetTreasuryAddress("0xTREASURY"); err != nil {
+		t.Fatal(err)
+	}
+	loaded := roundTrip(t, st)
+	if err := loaded.Rebase(DilutionAction{NewSharesIssued: tokens(1)}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, loaded, "0xTREASURY", tokens(1))
+}
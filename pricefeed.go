@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PriceRecord is a share price update together with where it came from
+type PriceRecord struct {
+	PriceCents    *big.Int
+	Source        string
+	FeedTimestamp time.Time
+	RecordedAt    time.Time
+}
+
+// SetMaxPriceAge rejects external prices older than maxAge. Zero disables the check.
+func (t *StockToken) SetMaxPriceAge(maxAge time.Duration) error {
+	if maxAge < 0 {
+		return errors.New("max price age must be non-negative")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxPriceAge = maxAge
+	return nil
+}
+
+// SetPriceFeedKey requires external prices to be signed by key. A nil key disables verification.
+func (t *StockToken) SetPriceFeedKey(key ed25519.PublicKey) error {
+	if key != nil && len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key length %d", len(key))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.priceFeedKey = key
+	return nil
+}
+
+// RecordExternalPrice updates the share price from an off-chain data feed. The price is
+// rejected if its timestamp is in the future, not after the last recorded price's, or older
+// than the max price age, or, when a feed key is configured, if signature does not verify
+// over PriceFeedMessage. Requiring newer timestamps stops a signed price being replayed.
+func (t *StockToken) RecordExternalPrice(priceCents *big.Int, source string, feedTimestamp time.Time, signature []byte) error {
+	if priceCents == nil || priceCents.Sign() <= 0 {
+		return fmt.Errorf("%w: price must be positive", ErrInvalidAmount)
+	}
+	if source == "" {
+		return errors.New("price source is empty")
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if feedTimestamp.After(now) {
+		return fmt.Errorf("%s price is timestamped %s in the future", source, feedTimestamp.Sub(now))
+	}
+	if n := len(t.priceHistory); n > 0 && !feedTimestamp.After(t.priceHistory[n-1].FeedTimestamp) {
+		return fmt.Errorf("%w: %s price is not newer than the last recorded price", ErrStalePrice, source)
+	}
+	if t.maxPriceAge > 0 && now.Sub(feedTimestamp) > t.maxPriceAge {
+		return fmt.Errorf("%w: %s price is %s old", ErrStalePrice, source, now.Sub(feedTimestamp))
+	}
+	if t.priceFeedKey != nil && !ed25519.Verify(t.priceFeedKey, PriceFeedMessage(t.ticker, priceCents, source, feedTimestamp), signature) {
+		return fmt.Errorf("invalid signature on %s price", source)
+	}
+
+	t.setSharePrice(priceCents)
+	t.priceHistory = append(t.priceHistory, PriceRecord{
+		PriceCents:    new(big.Int).Set(priceCents),
+		Source:        source,
+		FeedTimestamp: feedTimestamp,
+		RecordedAt:    now,
+	})
+	return nil
+}
+
+// SetSharePrice updates the share price outside of a rebase, e.g. for an end-of-day mark to
+// market. price is a dollar string such as "$101.25" and must be positive.
+func (t *StockToken) SetSharePrice(price string) error {
+	cents, err := parsePositiveDollars(price)
+	if err != nil {
+		return err
+	}
+
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setSharePrice(cents)
+	return nil
+}
+
+// setSharePrice replaces the share price and queues a price update event. The caller must hold t.mu.
+func (t *StockToken) setSharePrice(priceCents *big.Int) {
+	t.hooks.recordPrice(t.ticker, t.sharePrice, priceCents, t.now())
+	t.sharePrice = new(big.Int).Set(priceCents)
+}
+
+// PriceHistory returns the external prices recorded so far, oldest first
+func (t *StockToken) PriceHistory() []PriceRecord {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	history := make([]PriceRecord, len(t.priceHistory))
+	copy(history, t.priceHistory)
+	return history
+}
+
+// PriceFeedMessage is the message a price feed signs for ticker:
+// "<ticker>|<priceCents>|<source>|<unix seconds>". Including the ticker stops a price signed
+// for one token being recorded on another.
+func PriceFeedMessage(ticker string, priceCents *big.Int, source string, feedTimestamp time.Time) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%s|%d", ticker, priceCents, source, feedTimestamp.Unix()))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// signedFeed returns a token on a fake clock that only accepts prices signed by the returned key
+func signedFeed(t *testing.T) (*StockToken, *fakeClock, ed25519.PrivateKey) {
+	t.Helper()
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetPriceFeedKey(public); err != nil {
+		t.Fatal(err)
+	}
+	return st, clock, private
+}
+
+func TestRecordExternalPriceSigned(t *testing.T) {
+	st, clock, key := signedFeed(t)
+	price, at := big.NewInt(12345), clock.Now().Add(-time.Second)
+	signature := ed25519.Sign(key, PriceFeedMessage("TSLA", price, "feed", at))
+	if err := st.RecordExternalPrice(price, "feed", at, signature); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.SharePrice(); got.Cmp(price) != 0 {
+		t.Errorf("share price = %s, want %s", got, price)
+	}
+}
+
+func TestRecordExternalPriceRejectsOtherTicker(t *testing.T) {
+	st, clock, key := signedFeed(t)
+	price, at := big.NewInt(12345), clock.Now()
+	signature := ed25519.Sign(key, PriceFeedMessage("AAPL", price, "feed", at))
+	if err := st.RecordExternalPrice(price, "feed", at, signature); err == nil {
+		t.Error("price signed for another ticker was accepted")
+	}
+}
+
+func TestRecordExternalPriceRejectsReplay(t *testing.T) {
+	st, clock, key := signedFeed(t)
+	high, low := big.NewInt(20000), big.NewInt(5000)
+	first := clock.Now()
+	lowSignature := ed25519.Sign(key, PriceFeedMessage("TSLA", low, "feed", first))
+	if err := st.RecordExternalPrice(low, "feed", first, lowSignature); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	later := clock.Now()
+	if err := st.RecordExternalPrice(high, "feed", later, ed25519.Sign(key, PriceFeedMessage("TSLA", high, "feed", later))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaying the older signed price must not take the price back down
+	if err := st.RecordExternalPrice(low, "feed", first, lowSignature); !errors.Is(err, ErrStalePrice) {
+		t.Errorf("replayed price: err = %v, want ErrStalePrice", err)
+	}
+	if got := st.SharePrice(); got.Cmp(high) != 0 {
+		t.Errorf("share price = %s after a replay, want %s", got, high)
+	}
+}
+
+func TestRecordExternalPriceRejectsFuture(t *testing.T) {
+	st, clock, key := signedFeed(t)
+	price, at := big.NewInt(12345), clock.Now().Add(time.Hour)
+	signature := ed25519.Sign(key, PriceFeedMessage("TSLA", price, "feed", at))
+	if err := st.RecordExternalPrice(price, "feed", at, signature); err == nil {
+		t.Error("price timestamped in the future was accepted")
+	}
+}
+
+func TestRecordExternalPriceRejectsStale(t *testing.T) {
+	st, clock, key := signedFeed(t)
+	if err := st.SetMaxPriceAge(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	price, at := big.NewInt(12345), clock.Now().Add(-time.Hour)
+	signature := ed25519.Sign(key, PriceFeedMessage("TSLA", price, "feed", at))
+	if err := st.RecordExternalPrice(price, "feed", at, signature); !errors.Is(err, ErrStalePrice) {
+		t.Errorf("hour-old price: err = %v, want ErrStalePrice", err)
+	}
+}
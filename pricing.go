@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ConvertToStable values an address's holdings in stablecoin base units.
+// stablePerDollar is the number of stablecoin base units per US dollar
+// (e.g. 1_000_000 for USDC, which has stablePrecision 1_000_000).
+func (t *StockToken) ConvertToStable(address string, stablePrecision int64, stablePerDollar *big.Int) (*big.Int, error) {
+	if stablePrecision <= 0 {
+		return nil, fmt.Errorf("%w: stable precision must be positive", ErrInvalidAmount)
+	}
+	if stablePerDollar == nil || stablePerDollar.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: stable per dollar must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	balance := t.balances[address]
+	if balance == nil {
+		return big.NewInt(0), nil
+	}
+
+	// balance * sharePrice / precision * stablePerDollar / 100, divided once at the end to keep precision
+	value := new(big.Int).Mul(balance, t.sharePrice)
+	value.Mul(value, stablePerDollar)
+	value.Div(value, new(big.Int).Mul(t.Precision, big.NewInt(100)))
+	return value, nil
+}
+
+// SharePriceInCurrency converts the share price into cents of another currency.
+// fxRateBps is units of the target currency per US dollar, in basis points (0.92 EUR/USD = 9200).
+func (t *StockToken) SharePriceInCurrency(fxRateBps int64, targetCurrencyCode string) (*big.Int, error) {
+	if err := validateFxRate(fxRateBps, targetCurrencyCode); err != nil {
+		return nil, err
+	}
+
+	price := t.SharePrice()
+	price.Mul(price, big.NewInt(fxRateBps))
+	price.Div(price, big.NewInt(bpsDenominator))
+	return price, nil
+}
+
+// BalanceInCurrency values an address's holdings in cents of another currency
+func (t *StockToken) BalanceInCurrency(address string, fxRateBps int64, targetCurrencyCode string) (*big.Int, error) {
+	if err := validateFxRate(fxRateBps, targetCurrencyCode); err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	balance := t.balances[address]
+	if balance == nil {
+		return big.NewInt(0), nil
+	}
+
+	value := new(big.Int).Mul(balance, t.sharePrice)
+	value.Mul(value, big.NewInt(fxRateBps))
+	value.Div(value, new(big.Int).Mul(t.Precision, big.NewInt(bpsDenominator)))
+	return value, nil
+}
+
+func validateFxRate(fxRateBps int64, currencyCode string) error {
+	if fxRateBps <= 0 {
+		return fmt.Errorf("%w: fx rate must be positive", ErrInvalidAmount)
+	}
+	if len(currencyCode) != 3 || strings.IndexFunc(currencyCode, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return fmt.Errorf("invalid currency code: %q", currencyCode)
+	}
+	return nil
+}
+
+// DollarValueOf returns the value of an address's holdings in cents
+func DollarValueOf(st *StockToken, address string) (*big.Int, error) {
+	if st == nil {
+		return nil, errors.New("token is nil")
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	value := new(big.Int)
+	if balance := st.balances[address]; balance != nil {
+		value.Mul(balance, st.sharePrice)
+	}
+	value.Div(value, st.Precision)
+	return value, nil
+}
+
+// ValueOf returns the value of an address's balance at the current share price, in cents
+func (t *StockToken) ValueOf(address string) (*big.Int, error) {
+	return DollarValueOf(t, address)
+}
+
+// ValueOfFormatted is ValueOf as a dollar string such as "$1234.56"
+func (t *StockToken) ValueOfFormatted(address string) (string, error) {
+	value, err := t.ValueOf(address)
+	if err != nil {
+		return "", err
+	}
+	return formatCents(value), nil
+}
+
+// ValueOf returns the value in cents of an address's wrapped balance: the underlying it
+// converts to at the current exchange rate, valued at st's share price. st must be the
+// token ow wraps.
+func (ow *OndoWrappedStock) ValueOf(st *StockToken, address string) (*big.Int, error) {
+	if st == nil {
+		return nil, errors.New("token is nil")
+	}
+	if ow.ticker != "ow"+st.ticker {
+		return nil, fmt.Errorf("%s does not wrap %s", ow.ticker, st.ticker)
+	}
+
+	price := st.SharePrice()
+	ow.mu.RLock()
+	value := new(big.Int)
+	if wrapped := ow.balances[address]; wrapped != nil {
+		value.Mul(wrapped, ow.exchangeRate)
+	}
+	ow.mu.RUnlock()
+	value.Mul(value, price)
+	value.Div(value, new(big.Int).Mul(ow.Precision, st.Precision))
+	return value, nil
+}
+
+// ValueOfFormatted is ValueOf as a dollar string such as "$1234.56"
+func (ow *OndoWrappedStock) ValueOfFormatted(st *StockToken, address string) (string, error) {
+	value, err := ow.ValueOf(st, address)
+	if err != nil {
+		return "", err
+	}
+	return formatCents(value), nil
+}
+
+// TotalDollarValue returns the value of the entire supply in cents
+func TotalDollarValue(st *StockToken) (*big.Int, error) {
+	if st == nil {
+		return nil, errors.New("token is nil")
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	value := new(big.Int).Mul(st.totalSupply, st.sharePrice)
+	value.Div(value, st.Precision)
+	return value, nil
+}
+
+// TotalValue returns the market capitalization in cents: the total supply at the current
+// share price
+func (t *StockToken) TotalValue() (*big.Int, error) {
+	return TotalDollarValue(t)
+}
+
+// TotalHolderValue returns TotalValue, the value in cents of every holder's balance, staked
+// ones included. It checks the ledger first and panics if SanityCheck would fail, so tests can
+// use it as an assertion point.
+func (t *StockToken) TotalHolderValue() *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if err := t.sanityCheck(); err != nil {
+		panic(fmt.Sprintf("%s ledger is inconsistent: %v", t.ticker, err))
+	}
+	value := new(big.Int).Mul(t.totalSupply, t.sharePrice)
+	return value.Div(value, t.Precision)
+}
+
+// TotalValue returns the value in cents of the whole wrapped supply: the underlying it
+// converts to at the current exchange rate, valued at st's share price. st must be the token
+// ow wraps.
+func (ow *OndoWrappedStock) TotalValue(st *StockToken) (*big.Int, error) {
+	if st == nil {
+		return nil, errors.New("token is nil")
+	}
+	if ow.ticker != "ow"+st.ticker {
+		return nil, fmt.Errorf("%s does not wrap %s", ow.ticker, st.ticker)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	return ow.totalValue(st), nil
+}
+
+// totalValue is TotalValue for callers that hold st.mu and ow.mu
+func (ow *OndoWrappedStock) totalValue(st *StockToken) *big.Int {
+	value := new(big.Int).Mul(ow.totalSupply, ow.exchangeRate)
+	value.Mul(value, st.sharePrice)
+	return value.Div(value, new(big.Int).Mul(ow.Precision, st.Precision))
+}
+
+// CombinedTotalValue returns the value in cents of everything held in st and ow. The
+// underlying held by the wrapper backs the wrapped supply, so it is counted once, through
+// ow.TotalValue, rather than again as part of st's supply. Wrapping therefore leaves the
+// combined value unchanged, apart from rounding.
+func CombinedTotalValue(st *StockToken, ow *OndoWrappedStock) (*big.Int, error) {
+	if st == nil || ow == nil {
+		return nil, errors.New("token is nil")
+	}
+	if ow.ticker != "ow"+st.ticker {
+		return nil, fmt.Errorf("%s does not wrap %s", ow.ticker, st.ticker)
+	}
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	unwrapped := new(big.Int).Set(st.totalSupply)
+	if custody := st.balances[ow.ticker]; custody != nil {
+		unwrapped.Sub(unwrapped, custody)
+	}
+	value := unwrapped.Mul(unwrapped, st.sharePrice)
+	value.Div(value, st.Precision)
+	return value.Add(value, ow.totalValue(st)), nil
+}
+
+// PriceImpact estimates the fractional price change caused by trading tradeAmountTokens, using
+// tradeAmount / (totalSupply + tradeAmount). Buys move the price up and sells move it down.
+func (t *StockToken) PriceImpact(tradeAmountTokens *big.Int, isBuy bool) (*big.Rat, error) {
+	if tradeAmountTokens == nil || tradeAmountTokens.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: trade amount must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.priceImpact(tradeAmountTokens, isBuy)
+}
+
+// priceImpact is PriceImpact for callers that already hold t.mu
+func (t *StockToken) priceImpact(tradeAmountTokens *big.Int, isBuy bool) (*big.Rat, error) {
+	if t.totalSupply.Sign() == 0 {
+		return nil, errors.New("no supply to trade against")
+	}
+
+	depth := new(big.Int).Add(t.totalSupply, tradeAmountTokens)
+	impact := new(big.Rat).SetFrac(tradeAmountTokens, depth)
+	if !isBuy {
+		impact.Neg(impact)
+	}
+	return impact, nil
+}
+
+// PriceAfterImpact returns the share price in cents after applying PriceImpact
+func (t *StockToken) PriceAfterImpact(tradeAmountTokens *big.Int, isBuy bool) (*big.Int, error) {
+	if tradeAmountTokens == nil || tradeAmountTokens.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: trade amount must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	impact, err := t.priceImpact(tradeAmountTokens, isBuy)
+	if err != nil {
+		return nil, err
+	}
+
+	// price * (1 + impact), rounded down to whole cents
+	factor := new(big.Rat).Add(big.NewRat(1, 1), impact)
+	price := new(big.Rat).Mul(new(big.Rat).SetInt(t.sharePrice), factor)
+	return new(big.Int).Quo(price.Num(), price.Denom()), nil
+}
+
+// ExchangeRate returns how many b tokens one a token is worth at current prices
+func ExchangeRate(a, b *StockToken) (*big.Rat, error) {
+	if a == nil || b == nil {
+		return nil, errors.New("token is nil")
+	}
+
+	// Read one price at a time so a and b are never locked together
+	priceA, priceB := a.SharePrice(), b.SharePrice()
+	if priceA.Sign() == 0 || priceB.Sign() == 0 {
+		return nil, ErrZeroPrice
+	}
+	return new(big.Rat).SetFrac(priceA, priceB), nil
+}
+
+// ImpliedSwap returns how many b units are worth amountA units of a, rounded down
+func ImpliedSwap(amountA *big.Int, a, b *StockToken) (*big.Int, error) {
+	if amountA == nil || amountA.Sign() < 0 {
+		return nil, fmt.Errorf("%w: swap amount must be non-negative", ErrInvalidAmount)
+	}
+	rate, err := ExchangeRate(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	amountB := new(big.Int).Mul(amountA, rate.Num())
+	return amountB.Div(amountB, rate.Denom()), nil
+}
+
+// PortfolioValue sums the value in cents of address's holdings across tokens. The per-token
+// values are returned in the same order as tokens for itemized reporting.
+func PortfolioValue(address string, tokens []*StockToken) (*big.Int, []*big.Int, error) {
+	total := big.NewInt(0)
+	itemized := make([]*big.Int, 0, len(tokens))
+	for _, st := range tokens {
+		value, err := DollarValueOf(st, address)
+		if err != nil {
+			return nil, nil, err
+		}
+		total.Add(total, value)
+		itemized = append(itemized, value)
+	}
+	return total, itemized, nil
+}
+
+// PortfolioValueWithWrapped is PortfolioValue plus address's wrapped positions, each valued
+// through its exchange rate at the price of the token it wraps
+func PortfolioValueWithWrapped(address string, tokens []*StockToken, wrappers []*OndoWrappedStock) (*big.Int, error) {
+	total, _, err := PortfolioValue(address, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ow := range wrappers {
+		st := wrappedUnderlying(ow, tokens)
+		if st == nil {
+			return nil, fmt.Errorf("no underlying token provided for %s", ow.ticker)
+		}
+
+		ow.mu.RLock()
+		value := new(big.Int)
+		if wrapped := ow.balances[address]; wrapped != nil {
+			// wrapped * exchangeRate / precision underlying tokens, valued at the underlying price
+			value.Mul(wrapped, ow.exchangeRate)
+		}
+		ow.mu.RUnlock()
+		value.Mul(value, st.SharePrice())
+		value.Div(value, new(big.Int).Mul(ow.Precision, st.Precision))
+		total.Add(total, value)
+	}
+	return total, nil
+}
+
+// wrappedUnderlying finds the token that ow wraps among tokens
+func wrappedUnderlying(ow *OndoWrappedStock, tokens []*StockToken) *StockToken {
+	for _, st := range tokens {
+		if st != nil && ow.ticker == "ow"+st.ticker {
+			return st
+		}
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestConvertToStable(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.SetSharePrice("$50.00"); err != nil {
+		t.Fatal(err)
+	}
+	mustMint(t, st, "0xALICE", 10)
+
+	// USDC has 6 decimals and one USDC per dollar
+	value, err := st.ConvertToStable("0xALICE", 1_000_000, big.NewInt(1_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Cmp(big.NewInt(500_000_000)) != 0 {
+		t.Errorf("ConvertToStable = %s, want 500000000", value)
+	}
+
+	if value, err := st.ConvertToStable("0xNOBODY", 1_000_000, big.NewInt(1_000_000)); err != nil || value.Sign() != 0 {
+		t.Errorf("ConvertToStable for a non-holder = %v, %v, want 0", value, err)
+	}
+	if _, err := st.ConvertToStable("0xALICE", 0, big.NewInt(1_000_000)); err == nil {
+		t.Error("ConvertToStable accepted a zero stable precision")
+	}
+	if _, err := st.ConvertToStable("0xALICE", 1_000_000, nil); err == nil {
+		t.Error("ConvertToStable accepted a nil rate")
+	}
+}
+
+func TestSharePriceInCurrency(t *testing.T) {
+	st := newTestToken(t)
+	price, err := st.SharePriceInCurrency(9200, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price.Cmp(big.NewInt(9200)) != 0 {
+		t.Errorf("$100 in EUR = %s cents, want 9200", price)
+	}
+
+	mustMint(t, st, "0xALICE", 3)
+	value, err := st.BalanceInCurrency("0xALICE", 9200, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Cmp(big.NewInt(27600)) != 0 {
+		t.Errorf("3 shares in EUR = %s cents, want 27600", value)
+	}
+
+	for _, code := range []string{"eur", "EU", "EURO", ""} {
+		if _, err := st.SharePriceInCurrency(9200, code); err == nil {
+			t.Errorf("SharePriceInCurrency accepted currency code %q", code)
+		}
+	}
+	if _, err := st.SharePriceInCurrency(0, "EUR"); err == nil {
+		t.Error("SharePriceInCurrency accepted a zero fx rate")
+	}
+}
+
+func TestDollarValueOf(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.MintFractional("0xBOB", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The manual calculation main once did for the initial balance
+	sharePrice := float64(st.SharePrice().Int64()) / 100
+	manual := float64(st.BalanceOf("0xALICE").Int64()) / float64(st.Precision.Int64()) * sharePrice
+	value, err := DollarValueOf(st, "0xALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Int64() != int64(manual*100) {
+		t.Errorf("DollarValueOf = %s cents, want %.0f", value, manual*100)
+	}
+
+	total, err := TotalDollarValue(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Cmp(big.NewInt(125_000)) != 0 {
+		t.Errorf("TotalDollarValue = %s cents, want 125000", total)
+	}
+	if value, err := DollarValueOf(st, "0xNOBODY"); err != nil || value.Sign() != 0 {
+		t.Errorf("DollarValueOf for a non-holder = %v, %v, want 0", value, err)
+	}
+	if _, err := DollarValueOf(nil, "0xALICE"); err == nil {
+		t.Error("DollarValueOf accepted a nil token")
+	}
+}
+
+func TestPriceImpact(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+
+	// Buying 10% of the supply moves the price 10 / 110, about 9%
+	impact, err := st.PriceImpact(tokens(10), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impact.Cmp(big.NewRat(1, 11)) != 0 {
+		t.Errorf("buy impact = %s, want 1/11", impact.RatString())
+	}
+	if f, _ := impact.Float64(); f < 0.09 || f > 0.092 {
+		t.Errorf("buy impact = %f, want about 0.09", f)
+	}
+	if sell, err := st.PriceImpact(tokens(10), false); err != nil || sell.Cmp(big.NewRat(-1, 11)) != 0 {
+		t.Errorf("sell impact = %v, %v, want -1/11", sell, err)
+	}
+
+	price, err := st.PriceAfterImpact(tokens(10), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// $100 * 12/11 rounded down to whole cents
+	if price.Cmp(big.NewInt(10909)) != 0 {
+		t.Errorf("price after a buy = %s cents, want 10909", price)
+	}
+
+	if _, err := newTestToken(t).PriceImpact(tokens(1), true); err == nil {
+		t.Error("PriceImpact succeeded with no supply")
+	}
+	if _, err := st.PriceImpact(big.NewInt(0), true); err == nil {
+		t.Error("PriceImpact accepted a zero trade")
+	}
+}
+
+func TestImpliedSwapRoundTrip(t *testing.T) {
+	tsla := newTestToken(t)
+	aapl, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$37.37", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := ExchangeRate(tsla, aapl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.Cmp(big.NewRat(10000, 3737)) != 0 {
+		t.Errorf("ExchangeRate = %s, want 10000/3737", rate.RatString())
+	}
+
+	for _, amount := range []*big.Int{tokens(1), tokens(1234), big.NewInt(999_999)} {
+		swapped, err := ImpliedSwap(amount, tsla, aapl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := ImpliedSwap(swapped, aapl, tsla)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each leg rounds down by less than one unit of its output token
+		lost := new(big.Int).Sub(amount, back)
+		if lost.Sign() < 0 || lost.Cmp(big.NewInt(2)) > 0 {
+			t.Errorf("%s round-tripped to %s", amount, back)
+		}
+	}
+
+	if _, err := ImpliedSwap(big.NewInt(-1), tsla, aapl); err == nil {
+		t.Error("ImpliedSwap accepted a negative amount")
+	}
+	if _, err := ExchangeRate(tsla, nil); err == nil {
+		t.Error("ExchangeRate accepted a nil token")
+	}
+}
+
+func TestPortfolioValue(t *testing.T) {
+	var tokenList []*StockToken
+	want := big.NewInt(0)
+	for i, price := range []string{"$100.00", "$12.34", "$0.50"} {
+		st, err := NewStockToken(fmt.Sprintf("T%d", i), "Token", defaultDecimals, price, "0xOWNER")
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.LaxAddressValidation = true
+		mustMint(t, st, "0xALICE", uint64(i+1))
+		value, err := DollarValueOf(st, "0xALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.Add(want, value)
+		tokenList = append(tokenList, st)
+	}
+
+	total, itemized, err := PortfolioValue("0xALICE", tokenList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// $100 + 2 * $12.34 + 3 * $0.50
+	if total.Cmp(want) != 0 || total.Cmp(big.NewInt(12618)) != 0 {
+		t.Errorf("PortfolioValue = %s cents, want %s", total, want)
+	}
+	for i, value := range []int64{10000, 2468, 150} {
+		if itemized[i].Cmp(big.NewInt(value)) != 0 {
+			t.Errorf("item %d = %s cents, want %d", i, itemized[i], value)
+		}
+	}
+	if _, _, err := PortfolioValue("0xALICE", []*StockToken{nil}); err == nil {
+		t.Error("PortfolioValue accepted a nil token")
+	}
+}
+
+func TestValueOfUnchangedBySplit(t *testing.T) {
+	for _, price := range []string{"$100.00", "$123.45"} {
+		st, err := NewStockToken("TSLA", "Tesla, Inc.", defaultDecimals, price, "0xOWNER")
+		if err != nil {
+			t.Fatal(err)
+		}
+		st.LaxAddressValidation = true
+		ow := NewOndoWrappedStock(st)
+		if err := st.MintFractional("0xALICE", "13.333333"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ow.Wrap(st, "0xALICE", tokens(3), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := st.ValueOf("0xALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrappedValue, err := ow.ValueOf(st, "0xALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+			t.Fatal(err)
+		}
+		after, err := st.ValueOf("0xALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrappedAfter, err := ow.ValueOf(st, "0xALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Halving an odd price in cents loses half a cent on each of the doubled shares, and
+		// each value is itself rounded down to the cent
+		tolerance := new(big.Int).Div(st.BalanceOf("0xALICE"), tokens(2))
+		tolerance.Add(tolerance, big.NewInt(1))
+		for _, v := range [][2]*big.Int{{value, after}, {wrappedValue, wrappedAfter}} {
+			if diff := new(big.Int).Sub(v[0], v[1]); diff.Sign() < 0 || diff.Cmp(tolerance) > 0 {
+				t.Errorf("at %s a 2:1 split changed a value from %s to %s cents", price, v[0], v[1])
+			}
+		}
+		if price == "$100.00" && (value.Cmp(after) != 0 || wrappedValue.Cmp(wrappedAfter) != 0) {
+			t.Errorf("at an even price the split changed values %s, %s to %s, %s", value, wrappedValue, after, wrappedAfter)
+		}
+	}
+}
+
+func TestValueOfFormatted(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	if err := st.MintFractional("0xALICE", "12.3456"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := st.ValueOfFormatted("0xALICE"); err != nil || got != "$1234.56" {
+		t.Errorf("ValueOfFormatted = %q, %v, want $1234.56", got, err)
+	}
+	if got, err := ow.ValueOfFormatted(st, "0xALICE"); err != nil || got != "$0.00" {
+		t.Errorf("wrapped ValueOfFormatted with no wrapped balance = %q, %v, want $0.00", got, err)
+	}
+	other, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ow.ValueOf(other, "0xALICE"); err == nil {
+		t.Error("wrapped ValueOf accepted a token it does not wrap")
+	}
+}
+
+func TestTotalHolderValue(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 3)
+	mustMint(t, st, "0xCAROL", 7)
+	if err := st.Stake("0xCAROL", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetSharePrice("$123.45"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every holder's value, staked balances included, adds up to the total
+	sum := big.NewInt(0)
+	for _, address := range st.Holders() {
+		value, err := st.ValueOf(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum.Add(sum, value)
+	}
+	sum.Add(sum, new(big.Int).Div(new(big.Int).Mul(st.StakedBalanceOf("0xCAROL"), st.SharePrice()), st.Precision))
+	total := st.TotalHolderValue()
+	if total.Cmp(sum) != 0 || total.Cmp(big.NewInt(246900)) != 0 {
+		t.Errorf("TotalHolderValue = %s, want the holders' sum %s and 246900", total, sum)
+	}
+	if value, err := st.TotalValue(); err != nil || value.Cmp(total) != 0 {
+		t.Errorf("TotalValue = %v, %v, want %s", value, err, total)
+	}
+
+	// A corrupted ledger panics
+	st.totalSupply.Add(st.totalSupply, big.NewInt(1))
+	defer func() {
+		if recover() == nil {
+			t.Error("TotalHolderValue did not panic on an inconsistent ledger")
+		}
+	}()
+	st.TotalHolderValue()
+}
+
+func TestCombinedTotalValue(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	combined := func() *big.Int {
+		t.Helper()
+		value, err := CombinedTotalValue(st, ow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+	before := combined()
+	if before.Cmp(big.NewInt(100_000)) != 0 {
+		t.Fatalf("combined value = %s, want 100000", before)
+	}
+
+	// Wrapping half the supply moves value into the wrapper without counting it twice
+	if err := ow.Wrap(st, "0xALICE", tokens(5), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := combined(); got.Cmp(before) != 0 {
+		t.Errorf("combined value after wrapping = %s, want %s", got, before)
+	}
+
+	// A split leaves the value alone and a 10% stock dividend adds 10% on both sides
+	if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if got := combined(); got.Cmp(before) != 0 {
+		t.Errorf("combined value after a split = %s, want %s", got, before)
+	}
+	if err := ow.RebasePassthrough(st, Dividend{cashAmount: big.NewInt(500), sharePrice: big.NewInt(5000)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := combined(); got.Cmp(big.NewInt(110_000)) != 0 {
+		t.Errorf("combined value after a 10%% dividend = %s, want 110000", got)
+	}
+	wrapped, err := ow.TotalValue(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrapped.Cmp(big.NewInt(55_000)) != 0 {
+		t.Errorf("wrapped value after the dividend = %s, want 55000", wrapped)
+	}
+
+	other, err := NewStockToken("AAPL", "Apple Inc.", defaultDecimals, "$150.00", "0xOWNER")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CombinedTotalValue(other, ow); err == nil {
+		t.Error("CombinedTotalValue accepted a token the wrapper does not wrap")
+	}
+}
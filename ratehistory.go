@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// defaultMaxRateHistory is the number of exchange rates a new wrapper keeps
+const defaultMaxRateHistory = 1000
+
+// RateEntry is one exchange rate recorded by UpdateExchangeRate, with the wrapped supply it
+// was computed for
+type RateEntry struct {
+	Timestamp   time.Time
+	Rate        *big.Int
+	TotalSupply *big.Int
+}
+
+// recordRate appends the current exchange rate to RateHistory as of now, dropping the oldest
+// entries beyond MaxRateHistory. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) recordRate(now time.Time) {
+	ow.RateHistory = append(ow.RateHistory, RateEntry{
+		Timestamp:   now,
+		Rate:        new(big.Int).Set(ow.exchangeRate),
+		TotalSupply: new(big.Int).Set(ow.totalSupply),
+	})
+	if ow.MaxRateHistory > 0 && len(ow.RateHistory) > ow.MaxRateHistory {
+		ow.RateHistory = append([]RateEntry(nil), ow.RateHistory[len(ow.RateHistory)-ow.MaxRateHistory:]...)
+	}
+}
+
+// RateAtTime returns the exchange rate in force at t, the rate of the last entry recorded at
+// or before t. It fails if no rate was recorded by then.
+func (ow *OndoWrappedStock) RateAtTime(t time.Time) (*big.Int, error) {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	i := ow.rateIndex(t)
+	if i < 0 {
+		return nil, fmt.Errorf("no exchange rate recorded at or before %s", t.Format(time.RFC3339))
+	}
+	return new(big.Int).Set(ow.RateHistory[i].Rate), nil
+}
+
+// rateIndex returns the index of the last entry recorded at or before t, or -1 if there is
+// none. The caller must hold ow.mu.
+func (ow *OndoWrappedStock) rateIndex(t time.Time) int {
+	return sort.Search(len(ow.RateHistory), func(i int) bool {
+		return ow.RateHistory[i].Timestamp.After(t)
+	}) - 1
+}
+
+// AverageRate returns the time-weighted average exchange rate between from and to. Each rate
+// counts for as long as it was in force within the window. A window that starts before the
+// first recorded rate is averaged from that rate onwards.
+func (ow *OndoWrappedStock) AverageRate(from, to time.Time) (*big.Int, error) {
+	if to.Before(from) {
+		return nil, errors.New("rate window ends before it starts")
+	}
+
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+
+	last := ow.rateIndex(to)
+	if last < 0 {
+		return nil, fmt.Errorf("no exchange rate recorded at or before %s", to.Format(time.RFC3339))
+	}
+	first := max(ow.rateIndex(from), 0)
+	start := from
+	if ow.RateHistory[first].Timestamp.After(start) {
+		start = ow.RateHistory[first].Timestamp
+	}
+	if !to.After(start) {
+		return new(big.Int).Set(ow.RateHistory[last].Rate), nil
+	}
+
+	// Sum rate * nanoseconds in force, then divide by the window length
+	sum := big.NewInt(0)
+	for i := first; i <= last; i++ {
+		begin, end := start, to
+		if i > first {
+			begin = ow.RateHistory[i].Timestamp
+		}
+		if i < last {
+			end = ow.RateHistory[i+1].Timestamp
+		}
+		weight := big.NewInt(int64(end.Sub(begin)))
+		sum.Add(sum, weight.Mul(weight, ow.RateHistory[i].Rate))
+	}
+	return sum.Div(sum, big.NewInt(int64(to.Sub(start)))), nil
+}
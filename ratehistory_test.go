@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newRateHistory returns a wrapper whose exchange rate was recorded after each of ten 1%
+// dividends, paid an hour apart from start on the underlying's clock
+func newRateHistory(t *testing.T, start time.Time) *OndoWrappedStock {
+	t.Helper()
+	clock := &fakeClock{now: start}
+	st := newTestToken(t)
+	st.Clock = clock
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 100)
+	if err := ow.Wrap(st, "0xALICE", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			clock.Advance(time.Hour)
+		}
+		if err := ow.RebasePassthrough(st, Dividend{cashAmount: big.NewInt(100), sharePrice: big.NewInt(10000)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ow.RateHistory) != 10 {
+		t.Fatalf("rate history has %d entries, want 10", len(ow.RateHistory))
+	}
+	for i, entry := range ow.RateHistory {
+		if want := start.Add(time.Duration(i) * time.Hour); !entry.Timestamp.Equal(want) {
+			t.Fatalf("rate %d recorded at %s, want %s", i, entry.Timestamp, want)
+		}
+	}
+	return ow
+}
+
+func TestAverageRateIsMeanOfEvenlySpacedRates(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ow := newRateHistory(t, start)
+
+	// Each rate is in force for an hour, so the time-weighted average is the plain mean
+	sum := big.NewInt(0)
+	for i, entry := range ow.RateHistory {
+		if i > 0 && entry.Rate.Cmp(ow.RateHistory[i-1].Rate) <= 0 {
+			t.Errorf("rate %d = %s did not grow from %s", i, entry.Rate, ow.RateHistory[i-1].Rate)
+		}
+		sum.Add(sum, entry.Rate)
+	}
+	mean := sum.Div(sum, big.NewInt(10))
+	average, err := ow.AverageRate(start, start.Add(10*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average.Cmp(mean) != 0 {
+		t.Errorf("AverageRate = %s, want the mean %s", average, mean)
+	}
+
+	// A window within a single entry averages to that entry's rate
+	average, err = ow.AverageRate(start.Add(90*time.Minute), start.Add(100*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average.Cmp(ow.RateHistory[1].Rate) != 0 {
+		t.Errorf("AverageRate within the second entry = %s, want %s", average, ow.RateHistory[1].Rate)
+	}
+	if _, err := ow.AverageRate(start, start.Add(-time.Hour)); err == nil {
+		t.Error("AverageRate accepted a window ending before it starts")
+	}
+	if _, err := ow.AverageRate(start.Add(-2*time.Hour), start.Add(-time.Hour)); err == nil {
+		t.Error("AverageRate accepted a window before the first rate")
+	}
+}
+
+func TestRateAtTime(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ow := newRateHistory(t, start)
+	for offset, want := range map[time.Duration]int{0: 0, 30 * time.Minute: 0, 5 * time.Hour: 5, 100 * time.Hour: 9} {
+		rate, err := ow.RateAtTime(start.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate.Cmp(ow.RateHistory[want].Rate) != 0 {
+			t.Errorf("RateAtTime(+%s) = %s, want entry %d's %s", offset, rate, want, ow.RateHistory[want].Rate)
+		}
+	}
+	if _, err := ow.RateAtTime(start.Add(-time.Second)); err == nil {
+		t.Error("RateAtTime before the first entry succeeded")
+	}
+}
+
+func TestMaxRateHistory(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	if ow.MaxRateHistory != defaultMaxRateHistory {
+		t.Errorf("MaxRateHistory = %d, want %d", ow.MaxRateHistory, defaultMaxRateHistory)
+	}
+	ow.MaxRateHistory = 3
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := ow.RebasePassthrough(st, doubleSplit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the last three rates, 8, 16 and 32 underlying per wrapped token, are kept
+	if len(ow.RateHistory) != 3 {
+		t.Fatalf("rate history has %d entries, want 3", len(ow.RateHistory))
+	}
+	if ow.RateHistory[0].Rate.Cmp(tokens(8)) != 0 || ow.RateHistory[2].Rate.Cmp(tokens(32)) != 0 {
+		t.Errorf("kept rates %s..%s, want %s..%s", ow.RateHistory[0].Rate, ow.RateHistory[2].Rate, tokens(8), tokens(32))
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Subscription mints SharesPerPeriod to Address every PeriodDuration, e.g. for salary programs
+type Subscription struct {
+	ID              int
+	Address         string
+	SharesPerPeriod uint64
+	PeriodDuration  time.Duration
+	PaidThrough     time.Time // start of the first period not yet minted
+	Cancelled       bool
+}
+
+// AddSubscription schedules a recurring mint starting at startAt and returns its id.
+// The first payment becomes due one full period after startAt.
+func (t *StockToken) AddSubscription(address string, sharesPerPeriod uint64, periodDuration time.Duration, startAt time.Time) (subID int, err error) {
+	if err := t.checkAddresses(address); err != nil {
+		return 0, err
+	}
+	if sharesPerPeriod == 0 {
+		return 0, fmt.Errorf("%w: shares per period must be positive", ErrInvalidAmount)
+	}
+	if periodDuration <= 0 {
+		return 0, errors.New("subscription period must be positive")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subscriptions == nil {
+		t.subscriptions = make(map[int]*Subscription)
+	}
+	t.nextSubscriptionPlanID++
+	t.subscriptions[t.nextSubscriptionPlanID] = &Subscription{
+		ID:              t.nextSubscriptionPlanID,
+		Address:         address,
+		SharesPerPeriod: sharesPerPeriod,
+		PeriodDuration:  periodDuration,
+		PaidThrough:     startAt,
+	}
+	return t.nextSubscriptionPlanID, nil
+}
+
+// ProcessSubscriptions mints every payment that has fallen due by now and returns how many
+// payments were made. Payments are minted in subscription order. If the payments together
+// cannot be minted, none are.
+func (t *StockToken) ProcessSubscriptions(now time.Time) (count int, err error) {
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	type payment struct {
+		sub     *Subscription
+		periods uint64
+		shares  *big.Int
+	}
+	var payments []payment
+	var recipients []string
+	total := big.NewInt(0)
+	for _, id := range slices.Sorted(maps.Keys(t.subscriptions)) {
+		sub := t.subscriptions[id]
+		if sub.Cancelled || now.Before(sub.PaidThrough) {
+			continue
+		}
+
+		periods := uint64(now.Sub(sub.PaidThrough) / sub.PeriodDuration)
+		if periods == 0 {
+			continue
+		}
+
+		shares := new(big.Int).SetUint64(periods * sub.SharesPerPeriod)
+		shares.Mul(shares, t.Precision)
+		payments = append(payments, payment{sub, periods, shares})
+		recipients = append(recipients, sub.Address)
+		total.Add(total, shares)
+	}
+	if err := t.checkMint(total, recipients...); err != nil {
+		return 0, err
+	}
+
+	for _, p := range payments {
+		t.mint(p.sub.Address, p.shares)
+		p.sub.PaidThrough = p.sub.PaidThrough.Add(time.Duration(p.periods) * p.sub.PeriodDuration)
+		count += int(p.periods)
+	}
+	return count, nil
+}
+
+// CancelSubscription stops all future payments for a subscription
+func (t *StockToken) CancelSubscription(subID int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sub, ok := t.subscriptions[subID]
+	if !ok {
+		return fmt.Errorf("no subscription with id %d", subID)
+	}
+	if sub.Cancelled {
+		return fmt.Errorf("subscription %d is already cancelled", subID)
+	}
+	sub.Cancelled = true
+	return nil
+}
+
+// rebaseScheduler is a running StartRebaseScheduler goroutine
+type rebaseScheduler struct {
+	cancel    context.CancelFunc
+	done      chan struct{} // closed when the goroutine exits
+	goroutine atomic.Uint64 // id of the goroutine, which also runs OnRebase and the hooks
+}
+
+// StartRebaseScheduler applies action every interval on the token's Clock in a background
+// goroutine until ctx is cancelled or StopRebaseScheduler is called. Only one scheduler can
+// run per token. Applied rebases are logged like any other; a rebase that fails is recorded
+// in the event log under the "scheduler_error" topic and the scheduler carries on.
+func (t *StockToken) StartRebaseScheduler(ctx context.Context, action RebaseAction, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("rebase interval must be positive")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.scheduler != nil {
+		return errors.New("rebase scheduler is already running")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &rebaseScheduler{cancel: cancel, done: make(chan struct{})}
+	t.scheduler = s
+	clock := t.clock()
+
+	go func() {
+		s.goroutine.Store(goroutineID())
+		defer func() {
+			// Clear the scheduler whichever way the goroutine exits, so another can start
+			t.mu.Lock()
+			if t.scheduler == s {
+				t.scheduler = nil
+			}
+			t.mu.Unlock()
+			cancel()
+			close(s.done)
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-clock.After(interval):
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+			if err := t.Rebase(action); err != nil {
+				t.logSchedulerError(action, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopRebaseScheduler stops the running scheduler and waits for it to exit, letting a scheduled
+// rebase being applied finish first. No rebase is started after it returns. Called from the
+// scheduler's own goroutine, e.g. from OnRebase during a scheduled rebase, it returns without
+// waiting, as the scheduler cannot exit until the call returns.
+func (t *StockToken) StopRebaseScheduler() {
+	t.mu.Lock()
+	s := t.scheduler
+	t.scheduler = nil
+	t.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	// The lock is released first, since the scheduler may be waiting on it to finish a rebase
+	s.cancel()
+	if s.goroutine.Load() != goroutineID() {
+		<-s.done
+	}
+}
+
+// goroutineID returns the runtime's id for the calling goroutine, read from the "goroutine N"
+// header of its stack trace
+func goroutineID() uint64 {
+	var buf [64]byte
+	header := bytes.Fields(buf[:runtime.Stack(buf[:], false)])
+	if len(header) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(header[1]), 10, 64)
+	return id
+}
+
+// logSchedulerError records a failed scheduled rebase in the event log, if the token has one
+func (t *StockToken) logSchedulerError(action RebaseAction, err error) {
+	if t.EventLog == nil {
+		return
+	}
+	t.EventLog.append("scheduler_error", t.now(), map[string]string{
+		"action": rebaseActionType(action),
+		"error":  err.Error(),
+	})
+}
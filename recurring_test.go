@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var doubleSplit = StockSplit{Numerator: big.NewInt(2), Denominator: big.NewInt(1)}
+
+func TestRebaseSchedulerAppliesOnePerInterval(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 10)
+
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		clock.waitForTimers(t, 1)
+		clock.Advance(time.Hour)
+		waitFor(t, "scheduled rebase", func() bool { return st.RebaseCount() == i })
+	}
+	st.StopRebaseScheduler()
+
+	if got := st.RebaseCount(); got != 3 {
+		t.Errorf("RebaseCount = %d, want 3", got)
+	}
+	checkBalance(t, st, "0xALICE", tokens(80))
+	checkSane(t, st)
+}
+
+func TestRebaseSchedulerRejectsSecondScheduler(t *testing.T) {
+	st := newTestToken(t)
+	st.Clock = newFakeClock()
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer st.StopRebaseScheduler()
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err == nil {
+		t.Error("second scheduler started")
+	}
+}
+
+func TestRebaseSchedulerClearedOnContextCancel(t *testing.T) {
+	st := newTestToken(t)
+	st.Clock = newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := st.StartRebaseScheduler(ctx, doubleSplit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	waitFor(t, "scheduler to exit", func() bool {
+		st.mu.RLock()
+		defer st.mu.RUnlock()
+		return st.scheduler == nil
+	})
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err != nil {
+		t.Fatalf("restart after cancel: %v", err)
+	}
+	st.StopRebaseScheduler()
+}
+
+func TestRebaseSchedulerStopFromOnRebase(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 1)
+	stopped := make(chan struct{})
+	st.OnRebase = func(st *StockToken, action RebaseAction) {
+		st.StopRebaseScheduler()
+		close(stopped)
+	}
+
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	clock.waitForTimers(t, 1)
+	clock.Advance(time.Hour)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopRebaseScheduler from OnRebase deadlocked")
+	}
+
+	// No further rebase runs, however far the clock moves
+	clock.Advance(10 * time.Hour)
+	waitFor(t, "scheduler to exit", func() bool {
+		st.mu.RLock()
+		defer st.mu.RUnlock()
+		return st.scheduler == nil
+	})
+	if got := st.RebaseCount(); got != 1 {
+		t.Errorf("RebaseCount = %d, want 1", got)
+	}
+}
+
+func TestStopRebaseSchedulerWaitsForRunningRebase(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 1)
+	entered, release := make(chan struct{}), make(chan struct{})
+	st.OnRebase = func(*StockToken, RebaseAction) {
+		close(entered)
+		<-release
+	}
+
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	clock.waitForTimers(t, 1)
+	clock.Advance(time.Hour)
+	<-entered
+
+	// Stopped from another goroutine mid-rebase, it waits for the rebase to finish
+	stopped := make(chan struct{})
+	go func() {
+		st.StopRebaseScheduler()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("StopRebaseScheduler returned while a scheduled rebase was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopRebaseScheduler did not return after the rebase finished")
+	}
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	if st.scheduler != nil {
+		t.Error("scheduler still set after StopRebaseScheduler returned")
+	}
+}
+
+func TestRebaseSchedulerLogsFailures(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	invalid := StockSplit{Numerator: big.NewInt(0), Denominator: big.NewInt(1)}
+
+	if err := st.StartRebaseScheduler(context.Background(), invalid, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	clock.waitForTimers(t, 1)
+	clock.Advance(time.Minute)
+	waitFor(t, "scheduler error", func() bool { return len(st.Filter("scheduler_error", time.Time{})) == 1 })
+	st.StopRebaseScheduler()
+
+	entry := st.Filter("scheduler_error", time.Time{})[0]
+	if entry.Fields["action"] != "split" || entry.Fields["error"] == "" {
+		t.Errorf("scheduler_error fields = %v", entry.Fields)
+	}
+	if !entry.BlockTime.Equal(clock.Now()) {
+		t.Errorf("scheduler_error logged at %s, want the clock's %s", entry.BlockTime, clock.Now())
+	}
+}
+
+func TestRebaseSchedulerRejectsNonPositiveInterval(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.StartRebaseScheduler(context.Background(), doubleSplit, 0); err == nil {
+		t.Error("zero interval accepted")
+	}
+}
+
+func TestProcessSubscriptionsMonthly(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	const month = 30 * 24 * time.Hour
+	id, err := st.AddSubscription("0xALICE", 4, month, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(3*month + month/2)
+	count, err := st.ProcessSubscriptions(clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("paid %d periods, want 3", count)
+	}
+	checkBalance(t, st, "0xALICE", tokens(12))
+
+	// Nothing more is due until the fourth month ends
+	if count, err := st.ProcessSubscriptions(clock.Now()); err != nil || count != 0 {
+		t.Errorf("second run paid %d periods, %v, want none", count, err)
+	}
+	clock.Advance(month / 2)
+	if count, err := st.ProcessSubscriptions(clock.Now()); err != nil || count != 1 {
+		t.Errorf("fourth month paid %d periods, %v, want 1", count, err)
+	}
+
+	if err := st.CancelSubscription(id); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(month)
+	if count, err := st.ProcessSubscriptions(clock.Now()); err != nil || count != 0 {
+		t.Errorf("cancelled subscription paid %d periods, %v, want none", count, err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(16))
+}
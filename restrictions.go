@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Pause halts mints, burns, transfers, rebases, wraps and unwraps until Unpause is called.
+// Mints to the owner still succeed so shares can be issued in an emergency.
+func (t *StockToken) Pause() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isPaused {
+		return errors.New("token is already paused")
+	}
+	t.isPaused = true
+	return nil
+}
+
+// Unpause lifts a pause set by Pause
+func (t *StockToken) Unpause() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.isPaused {
+		return errors.New("token is not paused")
+	}
+	t.isPaused = false
+	return nil
+}
+
+// Paused reports whether the token is paused
+func (t *StockToken) Paused() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.isPaused
+}
+
+// SetFloorPrice halts transfers, wraps and unwraps while sharePrice is below minPriceCents.
+// A zero price removes the floor. Mint and Rebase are never affected.
+func (t *StockToken) SetFloorPrice(minPriceCents *big.Int) error {
+	if minPriceCents == nil || minPriceCents.Sign() < 0 {
+		return fmt.Errorf("%w: floor price must be non-negative", ErrInvalidAmount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if minPriceCents.Sign() == 0 {
+		t.floorPrice = nil
+		return nil
+	}
+	t.floorPrice = new(big.Int).Set(minPriceCents)
+	return nil
+}
+
+// FloorPrice returns the configured floor price in cents, or zero if none is set
+func (t *StockToken) FloorPrice() *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.floorPrice == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(t.floorPrice)
+}
+
+// floorBreached reports whether trading is currently halted by the floor price
+func (t *StockToken) floorBreached() bool {
+	return t.floorPrice != nil && t.sharePrice.Cmp(t.floorPrice) < 0
+}
+
+// SetTransferRestriction blocks transfers and wraps out of address until restrictedUntil, e.g.
+// for an IPO lockup
+func (t *StockToken) SetTransferRestriction(address string, restrictedUntil time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(address); err != nil {
+		return err
+	}
+	if t.transferRestrictions == nil {
+		t.transferRestrictions = make(map[string]time.Time)
+	}
+	t.transferRestrictions[address] = restrictedUntil
+	return nil
+}
+
+// ClearTransferRestriction lifts the lockup on address before it expires
+func (t *StockToken) ClearTransferRestriction(address string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.transferRestrictions[address]; !ok {
+		return fmt.Errorf("no transfer restriction for %s", address)
+	}
+	delete(t.transferRestrictions, address)
+	return nil
+}
+
+// checkTransferRestriction returns ErrTransferRestricted with the remaining lockup if from is locked at now
+func (t *StockToken) checkTransferRestriction(from string, now time.Time) error {
+	until, ok := t.transferRestrictions[from]
+	if !ok || !now.Before(until) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s locked for another %s", ErrTransferRestricted, from, until.Sub(now))
+}
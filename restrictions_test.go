@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTransferRestrictionExpires(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.SetTransferRestriction("0xALICE", clock.Now().Add(180*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := st.Interact("0xALICE", "0xBOB", tokens(1), nil)
+	if !errors.Is(err, ErrTransferRestricted) {
+		t.Fatalf("transfer during lockup: err = %v, want ErrTransferRestricted", err)
+	}
+
+	clock.Advance(180 * 24 * time.Hour)
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); err != nil {
+		t.Fatalf("transfer after lockup: %v", err)
+	}
+	checkBalance(t, st, "0xBOB", tokens(1))
+}
+
+func TestTransferRestrictionBlocksWrap(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.SetTransferRestriction("0xALICE", clock.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ow.Wrap(st, "0xALICE", tokens(1), nil); !errors.Is(err, ErrTransferRestricted) {
+		t.Errorf("Wrap during lockup: err = %v, want ErrTransferRestricted", err)
+	}
+	if err := st.Interact("0xALICE", "0xCONTRACT", tokens(1), ow); !errors.Is(err, ErrTransferRestricted) {
+		t.Errorf("auto-wrap during lockup: err = %v, want ErrTransferRestricted", err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+
+	clock.Advance(time.Hour)
+	if err := ow.Wrap(st, "0xALICE", tokens(1), nil); err != nil {
+		t.Errorf("Wrap after lockup: %v", err)
+	}
+}
+
+func TestClearTransferRestriction(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.SetTransferRestriction("0xALICE", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ClearTransferRestriction("0xALICE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); err != nil {
+		t.Errorf("transfer after clearing: %v", err)
+	}
+	if err := st.ClearTransferRestriction("0xALICE"); err == nil {
+		t.Error("clearing a missing restriction succeeded")
+	}
+}
+
+func TestSetTransferRestrictionValidatesAddress(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.SetTransferRestriction("", time.Now()); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("empty address: err = %v, want ErrInvalidAddress", err)
+	}
+
+	st.LaxAddressValidation = false
+	if err := st.SetTransferRestriction("0xALICE", time.Now()); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("shorthand address under strict validation: err = %v, want ErrInvalidAddress", err)
+	}
+	if err := st.SetTransferRestriction("0x52908400098527886E0F7030069857D2E4169EE7", time.Now()); err != nil {
+		t.Errorf("valid address: %v", err)
+	}
+}
+
+func TestFloorPrice(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(2), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetFloorPrice(big.NewInt(5000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetSharePrice("$40.00"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); !errors.Is(err, ErrFloorPriceBreached) {
+		t.Errorf("transfer below the floor: err = %v, want ErrFloorPriceBreached", err)
+	}
+	if err := ow.Wrap(st, "0xALICE", tokens(1), nil); !errors.Is(err, ErrFloorPriceBreached) {
+		t.Errorf("wrap below the floor: err = %v, want ErrFloorPriceBreached", err)
+	}
+	if err := ow.Unwrap(st, "0xCONTRACT", tokens(1), nil); !errors.Is(err, ErrFloorPriceBreached) {
+		t.Errorf("unwrap below the floor: err = %v, want ErrFloorPriceBreached", err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(8))
+
+	// Minting, burning and rebasing are not halted
+	mustMint(t, st, "0xALICE", 1)
+	if err := st.Burn("0xALICE", tokens(1)); err != nil {
+		t.Errorf("burn below the floor: %v", err)
+	}
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Errorf("rebase below the floor: %v", err)
+	}
+
+	if err := st.SetFloorPrice(big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	if st.FloorPrice().Sign() != 0 {
+		t.Errorf("FloorPrice = %s after removing it, want 0", st.FloorPrice())
+	}
+	if err := st.Interact("0xALICE", "0xBOB", tokens(1), nil); err != nil {
+		t.Errorf("transfer with the floor removed: %v", err)
+	}
+}
+
+func TestPauseHaltsMovements(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ow.Transfer("0xALICE", "0xCONTRACT", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Approve("0xALICE", "0xSPENDER", tokens(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	operations := []struct {
+		name string
+		run  func() error
+	}{
+		{"Interact", func() error { return st.Interact("0xALICE", "0xBOB", tokens(1), nil) }},
+		{"TransferFrom", func() error { return st.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", tokens(1)) }},
+		{"Burn", func() error { return st.Burn("0xALICE", tokens(1)) }},
+		{"Rebase", func() error { return st.Rebase(doubleSplit) }},
+		{"Mint", func() error { return st.Mint("0xALICE", 1) }},
+		{"Wrap", func() error { return ow.Wrap(st, "0xALICE", tokens(1), nil) }},
+		{"Unwrap", func() error { return ow.Unwrap(st, "0xALICE", tokens(1), nil) }},
+	}
+
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if !st.Paused() {
+		t.Error("Paused() = false after Pause")
+	}
+	if err := st.Pause(); err == nil {
+		t.Error("pausing twice succeeded")
+	}
+	for _, op := range operations {
+		if err := op.run(); !errors.Is(err, ErrTokenPaused) {
+			t.Errorf("%s while paused: err = %v, want ErrTokenPaused", op.name, err)
+		}
+	}
+	checkBalance(t, st, "0xALICE", tokens(6))
+	checkBalance(t, st, ow.ticker, tokens(4))
+
+	if err := st.Unpause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Unpause(); err == nil {
+		t.Error("unpausing twice succeeded")
+	}
+	for _, op := range operations {
+		if err := op.run(); err != nil {
+			t.Errorf("%s after unpause: %v", op.name, err)
+		}
+	}
+	checkSane(t, st)
+}
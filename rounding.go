@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RoundingMode selects how a division that does not come out even is rounded
+type RoundingMode int
+
+const (
+	// RoundDown truncates toward zero, the default
+	RoundDown RoundingMode = iota
+	// RoundUp rounds any remainder up
+	RoundUp
+	// RoundHalfUp rounds to the nearest integer, and a half up
+	RoundHalfUp
+	// RoundHalfEven rounds to the nearest integer, and a half to the even one
+	RoundHalfEven
+)
+
+func (m RoundingMode) String() string {
+	switch m {
+	case RoundDown:
+		return "down"
+	case RoundUp:
+		return "up"
+	case RoundHalfUp:
+		return "half_up"
+	case RoundHalfEven:
+		return "half_even"
+	default:
+		return fmt.Sprintf("RoundingMode(%d)", int(m))
+	}
+}
+
+// divRound returns num / den rounded with mode. num must be non-negative and den positive.
+func divRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	switch mode {
+	case RoundUp:
+		quo.Add(quo, big.NewInt(1))
+	case RoundHalfUp, RoundHalfEven:
+		c := rem.Lsh(rem, 1).Cmp(den)
+		if c > 0 || c == 0 && (mode == RoundHalfUp || quo.Bit(0) == 1) {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
+
+// DustBalance returns the underlying left in the wrapper by rounding unwrap payouts, in raw
+// units rounded toward zero: the sum of the exact amounts unwrapped less the sum actually
+// released. It is negative when rounding up has paid out more than the exact amounts.
+func (ow *OndoWrappedStock) DustBalance() *big.Int {
+	ow.mu.RLock()
+	defer ow.mu.RUnlock()
+	if ow.roundingDust == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Quo(ow.roundingDust, ow.Precision)
+}
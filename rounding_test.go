@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDivRound(t *testing.T) {
+	for _, tc := range []struct {
+		num, den int64
+		want     [4]int64 // indexed by RoundingMode
+	}{
+		{10, 5, [4]int64{2, 2, 2, 2}},
+		{11, 5, [4]int64{2, 3, 2, 2}},
+		{13, 5, [4]int64{2, 3, 3, 3}},
+		{5, 2, [4]int64{2, 3, 3, 2}},
+		{7, 2, [4]int64{3, 4, 4, 4}},
+		{1, 3, [4]int64{0, 1, 0, 0}},
+		{0, 3, [4]int64{0, 0, 0, 0}},
+	} {
+		for mode, want := range tc.want {
+			if got := divRound(big.NewInt(tc.num), big.NewInt(tc.den), RoundingMode(mode)); got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("divRound(%d, %d, %s) = %s, want %d", tc.num, tc.den, RoundingMode(mode), got, want)
+			}
+		}
+	}
+}
+
+func TestPartialUnwrapDust(t *testing.T) {
+	for _, mode := range []RoundingMode{RoundDown, RoundUp, RoundHalfUp, RoundHalfEven} {
+		t.Run(mode.String(), func(t *testing.T) {
+			st := newTestToken(t)
+			ow := NewOndoWrappedStock(st)
+			ow.DefaultRoundingMode = mode
+			mustMint(t, st, "0xCONTRACT", 10_000)
+			if err := ow.Wrap(st, "0xCONTRACT", tokens(10_000), nil); err != nil {
+				t.Fatal(err)
+			}
+			// A one-for-three stock dividend leaves the exchange rate at 1.333333
+			if err := ow.RebasePassthrough(st, Dividend{cashAmount: big.NewInt(1), sharePrice: big.NewInt(3)}); err != nil {
+				t.Fatal(err)
+			}
+			rate := new(big.Int).Set(ow.exchangeRate)
+			if rate.Cmp(big.NewInt(1_333_333)) != 0 {
+				t.Fatalf("exchange rate = %s, want 1333333", rate)
+			}
+
+			exact := big.NewInt(0)
+			received := big.NewInt(0)
+			for i := range int64(1000) {
+				amount := big.NewInt(1_000_003 + i*7919)
+				before := st.BalanceOf("0xBOB")
+				if err := ow.Unwrap(st, "0xBOB", amount, nil); err != nil {
+					t.Fatalf("unwrap %d: %v", i, err)
+				}
+				paid := new(big.Int).Sub(st.BalanceOf("0xBOB"), before)
+				received.Add(received, paid)
+
+				// Every payout is the exact amount rounded with the mode, so within one raw unit
+				amount.Mul(amount, rate)
+				exact.Add(exact, amount)
+				if diff := new(big.Int).Sub(amount, new(big.Int).Mul(paid, ow.Precision)); diff.CmpAbs(ow.Precision) >= 0 {
+					t.Fatalf("unwrap %d paid %s for an exact %s", i, paid, amount)
+				}
+			}
+
+			// The dust is everything the exact amounts owed that was not paid out
+			want := new(big.Int).Mul(received, ow.Precision)
+			want.Sub(exact, want).Quo(want, ow.Precision)
+			dust := ow.DustBalance()
+			if dust.Cmp(want) != 0 {
+				t.Errorf("dust = %s, want %s", dust, want)
+			}
+			switch mode {
+			case RoundDown:
+				if dust.Sign() <= 0 {
+					t.Errorf("rounding down left dust %s, want it positive", dust)
+				}
+			case RoundUp:
+				if dust.Sign() >= 0 {
+					t.Errorf("rounding up left dust %s, want it negative", dust)
+				}
+			default:
+				if dust.CmpAbs(big.NewInt(500)) > 0 {
+					t.Errorf("rounding to nearest left dust %s, want at most 500 either way", dust)
+				}
+			}
+			checkSane(t, st)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// SnapshotID identifies a balance snapshot taken by Snapshot
+type SnapshotID uint64
+
+// DividendWithRecord pays the embedded Dividend to the holders of record in the snapshot
+// RecordSnapshotID rather than to whoever holds tokens when the rebase runs. Entitlements come
+// from the snapshot balances and staked balances, and are credited to the holders' current
+// balances, so buying after the snapshot earns nothing and selling or unstaking after it does
+// not forfeit the dividend. Staked balances of record earn the staking yield.
+type DividendWithRecord struct {
+	Dividend
+	RecordSnapshotID SnapshotID
+}
+
+// checkpoint is a balance as it was when snapshot id was taken
+type checkpoint struct {
+	id      SnapshotID
+	balance *big.Int
+}
+
+// snapshotMark is the token-wide state NominalVsRealReturn measures a snapshot against
+type snapshotMark struct {
+	sharePrice       *big.Int
+	rebaseMultiplier *big.Rat
+	historyLen       int // entries in RebaseHistory when the snapshot was taken
+}
+
+// Snapshot starts a new balance snapshot and returns its id. Nothing is copied when it is
+// taken: each balance and staked balance is checkpointed the first time it changes afterwards,
+// so a snapshot costs nothing for holders whose balances never change.
+func (t *StockToken) Snapshot() SnapshotID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextSnapshotID++
+	t.snapshotMarks = append(t.snapshotMarks, snapshotMark{
+		sharePrice:       new(big.Int).Set(t.sharePrice),
+		rebaseMultiplier: new(big.Rat).Set(t.rebaseMultiplier),
+		historyLen:       len(t.RebaseHistory),
+	})
+	return t.nextSnapshotID
+}
+
+// BalanceAtSnapshot returns an address's balance when the snapshot was taken
+func (t *StockToken) BalanceAtSnapshot(address string, id SnapshotID) (*big.Int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if err := t.checkSnapshot(id); err != nil {
+		return nil, err
+	}
+	return valueAt(t.balanceCheckpoints[address], t.balances[address], id), nil
+}
+
+// StakedBalanceAtSnapshot returns an address's staked balance when the snapshot was taken
+func (t *StockToken) StakedBalanceAtSnapshot(address string, id SnapshotID) (*big.Int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if err := t.checkSnapshot(id); err != nil {
+		return nil, err
+	}
+	return valueAt(t.stakedCheckpoints[address], t.stakedBalances[address], id), nil
+}
+
+// SnapshotBalanceDiff compares the balances of two snapshots, id1 the earlier. added holds the
+// addresses with a balance only in id2, removed those with one only in id1, and changed those
+// with different balances in both, as [old, new]. Staked balances are not compared.
+func (t *StockToken) SnapshotBalanceDiff(id1, id2 SnapshotID) (added, removed map[string]*big.Int, changed map[string][2]*big.Int, err error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if err := t.checkSnapshot(id1); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := t.checkSnapshot(id2); err != nil {
+		return nil, nil, nil, err
+	}
+
+	before, _ := t.snapshotLedger(id1)
+	after, _ := t.snapshotLedger(id2)
+	added = make(map[string]*big.Int)
+	removed = make(map[string]*big.Int)
+	changed = make(map[string][2]*big.Int)
+	for address, balance := range after {
+		old, ok := before[address]
+		switch {
+		case !ok:
+			added[address] = balance
+		case old.Cmp(balance) != 0:
+			changed[address] = [2]*big.Int{old, balance}
+		}
+	}
+	for address, old := range before {
+		if _, ok := after[address]; !ok {
+			removed[address] = old
+		}
+	}
+	return added, removed, changed, nil
+}
+
+// checkSnapshot returns an error unless id was returned by Snapshot. The caller must hold t.mu.
+func (t *StockToken) checkSnapshot(id SnapshotID) error {
+	if id == 0 || id > t.nextSnapshotID {
+		return fmt.Errorf("no snapshot with id %d", id)
+	}
+	return nil
+}
+
+// valueAt returns a balance as it was at snapshot id, given its checkpoints and its current
+// value: the first checkpoint recorded for id or a later snapshot holds it, and if there is
+// none, it has not changed since
+func valueAt(checkpoints []checkpoint, current *big.Int, id SnapshotID) *big.Int {
+	i := sort.Search(len(checkpoints), func(i int) bool { return checkpoints[i].id >= id })
+	if i < len(checkpoints) {
+		return new(big.Int).Set(checkpoints[i].balance)
+	}
+	if current == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(current)
+}
+
+// snapshotLedger returns every non-zero balance and staked balance as they were at snapshot
+// id. The caller must hold t.mu.
+func (t *StockToken) snapshotLedger(id SnapshotID) (balances, staked map[string]*big.Int) {
+	materialize := func(checkpoints map[string][]checkpoint, current map[string]*big.Int) map[string]*big.Int {
+		result := make(map[string]*big.Int)
+		add := func(address string) {
+			if balance := valueAt(checkpoints[address], current[address], id); balance.Sign() > 0 {
+				result[address] = balance
+			}
+		}
+		for address := range current {
+			add(address)
+		}
+		for address := range checkpoints {
+			if _, ok := current[address]; !ok {
+				add(address)
+			}
+		}
+		return result
+	}
+	return materialize(t.balanceCheckpoints, t.balances), materialize(t.stakedCheckpoints, t.stakedBalances)
+}
+
+// checkpointBalance records address's balance for the latest snapshot before it changes,
+// unless it has already been recorded since that snapshot was taken. The caller must hold t.mu.
+func (t *StockToken) checkpointBalance(address string) {
+	if t.nextSnapshotID > 0 {
+		t.balanceCheckpoints = addCheckpoint(t.balanceCheckpoints, address, t.balances[address], t.nextSnapshotID)
+	}
+}
+
+// checkpointStaked is checkpointBalance for address's staked balance. The caller must hold t.mu.
+func (t *StockToken) checkpointStaked(address string) {
+	if t.nextSnapshotID > 0 {
+		t.stakedCheckpoints = addCheckpoint(t.stakedCheckpoints, address, t.stakedBalances[address], t.nextSnapshotID)
+	}
+}
+
+// checkpointAll checkpoints every balance and staked balance, before a change that touches
+// all of them such as a rebase or a wholesale replacement. The caller must hold t.mu.
+func (t *StockToken) checkpointAll() {
+	if t.nextSnapshotID == 0 || t.checkpointedAll == t.nextSnapshotID {
+		return
+	}
+	for address := range t.balances {
+		t.checkpointBalance(address)
+	}
+	for address := range t.stakedBalances {
+		t.checkpointStaked(address)
+	}
+	t.checkpointedAll = t.nextSnapshotID
+}
+
+// addCheckpoint appends current to address's checkpoints for snapshot id, unless one has
+// already been recorded for it, and returns the possibly new map
+func addCheckpoint(checkpoints map[string][]checkpoint, address string, current *big.Int, id SnapshotID) map[string][]checkpoint {
+	recorded := checkpoints[address]
+	if n := len(recorded); n > 0 && recorded[n-1].id >= id {
+		return checkpoints
+	}
+	if checkpoints == nil {
+		checkpoints = make(map[string][]checkpoint)
+	}
+	balance := big.NewInt(0)
+	if current != nil {
+		balance.Set(current)
+	}
+	checkpoints[address] = append(recorded, checkpoint{id, balance})
+	return checkpoints
+}
+
+// SnapshotBalances returns a copy of every balance for a later BalanceDiff
+func (t *StockToken) SnapshotBalances() map[string]*big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return copyAmounts(t.balances)
+}
+
+// BalanceDiff returns how much each address's balance changed since before was taken by
+// SnapshotBalances: positive for gains and negative for losses. An address missing from before
+// counts as having held nothing, and one missing now as holding nothing. Unchanged balances
+// are left out.
+func (t *StockToken) BalanceDiff(before map[string]*big.Int) map[string]*big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return balanceDiff(before, t.balances)
+}
+
+// balanceDiff returns after - before for every address whose balance changed
+func balanceDiff(before, after map[string]*big.Int) map[string]*big.Int {
+	diff := make(map[string]*big.Int)
+	for address, balance := range after {
+		delta := new(big.Int).Set(balance)
+		if old := before[address]; old != nil {
+			delta.Sub(delta, old)
+		}
+		if delta.Sign() != 0 {
+			diff[address] = delta
+		}
+	}
+	for address, old := range before {
+		if _, ok := after[address]; !ok && old.Sign() != 0 {
+			diff[address] = new(big.Int).Neg(old)
+		}
+	}
+	return diff
+}
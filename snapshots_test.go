@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// checkAtSnapshot fails unless address held balance and staked at snapshot id
+func checkAtSnapshot(t *testing.T, st *StockToken, address string, id SnapshotID, balance, staked *big.Int) {
+	t.Helper()
+	got, err := st.BalanceAtSnapshot(address, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(balance) != 0 {
+		t.Errorf("%s balance at snapshot %d = %s, want %s", address, id, got, balance)
+	}
+	if got, err = st.StakedBalanceAtSnapshot(address, id); err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(staked) != 0 {
+		t.Errorf("%s staked balance at snapshot %d = %s, want %s", address, id, got, staked)
+	}
+}
+
+func TestSnapshotBalances(t *testing.T) {
+	st := newTestToken(t)
+	zero := big.NewInt(0)
+	mustMint(t, st, "0xALICE", 10)
+	first := st.Snapshot()
+
+	if err := st.Interact("0xALICE", "0xBOB", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Stake("0xALICE", tokens(2)); err != nil {
+		t.Fatal(err)
+	}
+	second := st.Snapshot()
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Burn("0xBOB", tokens(8)); err != nil {
+		t.Fatal(err)
+	}
+	third := st.Snapshot()
+
+	checkAtSnapshot(t, st, "0xALICE", first, tokens(10), zero)
+	checkAtSnapshot(t, st, "0xBOB", first, zero, zero)
+	checkAtSnapshot(t, st, "0xALICE", second, tokens(4), tokens(2))
+	checkAtSnapshot(t, st, "0xBOB", second, tokens(4), zero)
+	checkAtSnapshot(t, st, "0xALICE", third, tokens(8), tokens(4))
+	checkAtSnapshot(t, st, "0xBOB", third, zero, zero)
+
+	if _, err := st.BalanceAtSnapshot("0xALICE", third+1); err == nil {
+		t.Error("balance at a snapshot not yet taken succeeded")
+	}
+	if _, err := st.BalanceAtSnapshot("0xALICE", 0); err == nil {
+		t.Error("balance at snapshot 0 succeeded")
+	}
+}
+
+func TestSnapshotSurvivesFailedRebase(t *testing.T) {
+	st := ledgerFixture(t)
+	id := st.Snapshot()
+	if err := st.Rebase(cappedDividend(st)); !errors.Is(err, ErrSupplyCap) {
+		t.Fatalf("dividend above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	st.maxSupply = nil
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+	checkAtSnapshot(t, st, "0xHOLDER09", id, tokens(10), big.NewInt(0))
+	checkBalance(t, st, "0xHOLDER09", tokens(20))
+}
+
+func TestDividendWithRecordPaysStakedHolders(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	mustMint(t, st, "0xBOB", 100)
+	if err := st.Stake("0xBOB", tokens(100)); err != nil {
+		t.Fatal(err)
+	}
+	record := st.Snapshot()
+
+	// Both sell out after the record date and still receive the dividend
+	if err := st.Interact("0xALICE", "0xCAROL", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Unstake("0xBOB", tokens(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Interact("0xBOB", "0xCAROL", tokens(100), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dividend := Dividend{cashAmount: big.NewInt(1000), sharePrice: big.NewInt(10000)}
+	if err := st.Rebase(DividendWithRecord{Dividend: dividend, RecordSnapshotID: record}); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkBalance(t, st, "0xBOB", tokens(10))
+	checkBalance(t, st, "0xCAROL", tokens(200))
+	checkSane(t, st)
+}
+
+func TestDividendWithRecordSkipsLateBuyers(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+	record := st.Snapshot()
+
+	// Alice sells half to Bob and Carol is minted in after the record date
+	if err := st.Interact("0xALICE", "0xBOB", tokens(50), nil); err != nil {
+		t.Fatal(err)
+	}
+	mustMint(t, st, "0xCAROL", 100)
+
+	dividend := Dividend{cashAmount: big.NewInt(1000), sharePrice: big.NewInt(10000)}
+	if err := st.Rebase(DividendWithRecord{Dividend: dividend, RecordSnapshotID: record}); err != nil {
+		t.Fatal(err)
+	}
+	// Alice is paid on the 100 she held at the record date, into her live balance
+	checkBalance(t, st, "0xALICE", tokens(60))
+	checkBalance(t, st, "0xBOB", tokens(50))
+	checkBalance(t, st, "0xCAROL", tokens(100))
+	checkSane(t, st)
+
+	if err := st.Rebase(DividendWithRecord{Dividend: dividend, RecordSnapshotID: record + 100}); err == nil {
+		t.Error("dividend with an unknown record snapshot succeeded")
+	}
+	checkBalance(t, st, "0xALICE", tokens(60))
+}
+
+func TestBalanceDiffAfterDividend(t *testing.T) {
+	st := newTestToken(t)
+	for address, amount := range map[string]string{"0xALICE": "10", "0xBOB": "3.333333", "0xCAROL": "0.5"} {
+		if err := st.MintFractional(address, amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := st.SnapshotBalances()
+
+	// $3.33 on $100 is a share ratio of 0.0333
+	if err := st.Rebase(Dividend{cashAmount: big.NewInt(333), sharePrice: big.NewInt(10000)}); err != nil {
+		t.Fatal(err)
+	}
+	diff := st.BalanceDiff(before)
+	shareRatio := big.NewInt(33_300)
+	for address, old := range before {
+		want := new(big.Int).Mul(old, shareRatio)
+		want.Div(want, st.Precision)
+		if diff[address] == nil || diff[address].Cmp(want) != 0 {
+			t.Errorf("%s delta = %v, want %s", address, diff[address], want)
+		}
+	}
+	if len(diff) != len(before) {
+		t.Errorf("diff has %d entries, want %d", len(diff), len(before))
+	}
+	// The rebase event carries the same diff
+	event := st.RebaseHistory[len(st.RebaseHistory)-1]
+	if len(event.BalanceDiff) != len(diff) {
+		t.Errorf("rebase event diff = %v, want %v", event.BalanceDiff, diff)
+	}
+	for address, delta := range diff {
+		if event.BalanceDiff[address].Cmp(delta) != 0 {
+			t.Errorf("rebase event delta for %s = %s, want %s", address, event.BalanceDiff[address], delta)
+		}
+	}
+
+	// New holders show their whole balance and departed ones the negative of their old one
+	before = st.SnapshotBalances()
+	carol := st.BalanceOf("0xCAROL")
+	if err := st.Interact("0xCAROL", "0xDAVE", carol, nil); err != nil {
+		t.Fatal(err)
+	}
+	diff = st.BalanceDiff(before)
+	if len(diff) != 2 || diff["0xDAVE"].Cmp(carol) != 0 || diff["0xCAROL"].Cmp(new(big.Int).Neg(carol)) != 0 {
+		t.Errorf("diff after moving 0xCAROL's balance = %v", diff)
+	}
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	st := newTestToken(b)
+	for i := 0; i < 10_000; i++ {
+		mustMint(b, st, fmt.Sprintf("0xHOLDER%05d", i), 10)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Taking a snapshot and moving one balance only checkpoints the two balances moved
+		st.Snapshot()
+		if err := st.Interact("0xHOLDER00000", "0xHOLDER00001", big.NewInt(1), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotBalanceDiff(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 5)
+	mustMint(t, st, "0xDAVE", 1)
+	first := st.Snapshot()
+
+	mustMint(t, st, "0xALICE", 2)
+	if err := st.Interact("0xBOB", "0xCAROL", tokens(5), nil); err != nil {
+		t.Fatal(err)
+	}
+	second := st.Snapshot()
+	// Changes after the second snapshot must not show up
+	mustMint(t, st, "0xDAVE", 1)
+
+	added, removed, changed, err := st.SnapshotBalanceDiff(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added["0xCAROL"].Cmp(tokens(5)) != 0 {
+		t.Errorf("added = %v, want 0xCAROL with %s", added, tokens(5))
+	}
+	if len(removed) != 1 || removed["0xBOB"].Cmp(tokens(5)) != 0 {
+		t.Errorf("removed = %v, want 0xBOB with %s", removed, tokens(5))
+	}
+	if len(changed) != 1 || changed["0xALICE"][0].Cmp(tokens(10)) != 0 || changed["0xALICE"][1].Cmp(tokens(12)) != 0 {
+		t.Errorf("changed = %v, want 0xALICE from %s to %s", changed, tokens(10), tokens(12))
+	}
+
+	if _, _, _, err := st.SnapshotBalanceDiff(first, second+1); err == nil {
+		t.Error("SnapshotBalanceDiff accepted an unknown snapshot")
+	}
+}
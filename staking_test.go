@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestStakingYield(t *testing.T) {
+	st := newTestToken(t)
+	st.YieldMultiplier = big.NewRat(3, 2)
+	mustMint(t, st, "0xALICE", 100)
+	mustMint(t, st, "0xBOB", 100)
+	if err := st.Stake("0xALICE", tokens(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Staked tokens cannot move until they are unstaked
+	if err := st.Interact("0xALICE", "0xCAROL", tokens(1), nil); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("transfer of staked tokens: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+	if err := st.Burn("0xALICE", tokens(1)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("burn of staked tokens: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+
+	// A 10% dividend pays the staker 1.5 times what the same unstaked balance earns
+	dividend := Dividend{cashAmount: big.NewInt(1000), sharePrice: big.NewInt(10000)}
+	if err := st.Rebase(dividend); err != nil {
+		t.Fatal(err)
+	}
+	if staked := st.StakedBalanceOf("0xALICE"); staked.Cmp(tokens(115)) != 0 {
+		t.Errorf("staked balance = %s, want %s", staked, tokens(115))
+	}
+	checkBalance(t, st, "0xBOB", tokens(110))
+
+	if err := st.Rebase(dividend); err != nil {
+		t.Fatal(err)
+	}
+	// Unstaking everything returns the stake and both dividends' yield: 115 + 17.25
+	if err := st.Unstake("0xALICE", st.StakedBalanceOf("0xALICE")); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", big.NewInt(132_250_000))
+	checkBalance(t, st, "0xBOB", tokens(121))
+	if _, ok := st.stakedBalances["0xALICE"]; ok {
+		t.Error("a fully unstaked balance was kept")
+	}
+	if err := st.Interact("0xALICE", "0xCAROL", tokens(1), nil); err != nil {
+		t.Errorf("transfer after unstaking: %v", err)
+	}
+	checkSane(t, st)
+}
+
+func TestStakeRejectsBadAmounts(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	for _, amount := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		if err := st.Stake("0xALICE", amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Stake(%v): err = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+		if err := st.Unstake("0xALICE", amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Unstake(%v): err = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+	}
+	if err := st.Stake("0xALICE", tokens(11)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("staking more than the balance: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+	if err := st.Stake("0xALICE", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Unstake("0xALICE", tokens(5)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("unstaking more than is staked: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+	checkBalance(t, st, "0xALICE", tokens(6))
+	checkSane(t, st)
+}
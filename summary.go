@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"text/tabwriter"
+)
+
+// summaryRow is one address's holdings captured for PrintSummary
+type summaryRow struct {
+	address      string
+	balance      *big.Int
+	value        *big.Int
+	wrapped      *big.Int
+	wrappedValue *big.Int
+}
+
+// PrintSummary writes a table of the token state and each address's holdings to w.
+// If ow is nil the wrapper columns and rows are omitted. The table is a snapshot taken
+// under the read locks before anything is written, so it may be stale by the time it prints.
+func (t *StockToken) PrintSummary(w io.Writer, ow *OndoWrappedStock, addresses ...string) error {
+	t.mu.RLock()
+	if ow != nil {
+		ow.mu.RLock()
+	}
+	sharePrice := new(big.Int).Set(t.sharePrice)
+	totalSupply := new(big.Int).Set(t.totalSupply)
+	var exchangeRate *big.Int
+	if ow != nil {
+		exchangeRate = new(big.Int).Set(ow.exchangeRate)
+	}
+
+	valueOf := func(balance *big.Int) *big.Int {
+		value := new(big.Int).Mul(balance, sharePrice)
+		return value.Div(value, t.Precision)
+	}
+	rows := make([]summaryRow, 0, len(addresses))
+	for _, address := range addresses {
+		row := summaryRow{address: address, balance: big.NewInt(0), wrapped: big.NewInt(0)}
+		if balance := t.balances[address]; balance != nil {
+			row.balance.Set(balance)
+		}
+		row.value = valueOf(row.balance)
+
+		if ow != nil {
+			if wrapped := ow.balances[address]; wrapped != nil {
+				row.wrapped.Set(wrapped)
+			}
+			row.wrappedValue = new(big.Int).Mul(row.wrapped, sharePrice)
+			row.wrappedValue.Mul(row.wrappedValue, exchangeRate)
+			row.wrappedValue.Div(row.wrappedValue, new(big.Int).Mul(ow.Precision, t.Precision))
+		}
+		rows = append(rows, row)
+	}
+
+	// Underlying held by the wrapper contract
+	wrapperBalance := big.NewInt(0)
+	if ow != nil && t.balances[ow.ticker] != nil {
+		wrapperBalance.Set(t.balances[ow.ticker])
+	}
+	if ow != nil {
+		ow.mu.RUnlock()
+	}
+	t.mu.RUnlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Ticker:\t%s\n", t.ticker)
+	fmt.Fprintf(tw, "Share price:\t$%.2f\n", float64(sharePrice.Int64())/100)
+	fmt.Fprintf(tw, "Total supply:\t%s ($%.2f)\n", formatTokens(totalSupply, t.Precision), float64(valueOf(totalSupply).Int64())/100)
+	if ow != nil {
+		fmt.Fprintf(tw, "Exchange rate:\t%s\n", formatTokens(exchangeRate, ow.Precision))
+	}
+	fmt.Fprintln(tw)
+
+	if ow == nil {
+		fmt.Fprintf(tw, "ADDRESS\t%s\tVALUE\n", t.ticker)
+	} else {
+		fmt.Fprintf(tw, "ADDRESS\t%s\tVALUE\t%s\tVALUE\n", t.ticker, ow.ticker)
+	}
+
+	for _, row := range rows {
+		if ow == nil {
+			fmt.Fprintf(tw, "%s\t%s\t$%.2f\n", row.address, formatTokens(row.balance, t.Precision), float64(row.value.Int64())/100)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t$%.2f\t%s\t$%.2f\n",
+			row.address,
+			formatTokens(row.balance, t.Precision),
+			float64(row.value.Int64())/100,
+			formatTokens(row.wrapped, ow.Precision),
+			float64(row.wrappedValue.Int64())/100)
+	}
+
+	if ow != nil {
+		fmt.Fprintf(tw, "%s (wrapper)\t%s\t$%.2f\t-\t-\n",
+			ow.ticker,
+			formatTokens(wrapperBalance, t.Precision),
+			float64(valueOf(wrapperBalance).Int64())/100)
+	}
+
+	// tabwriter buffers everything, so any write error from w surfaces here
+	return tw.Flush()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrintSummary(t *testing.T) {
+	st := newTestToken(t)
+	ow := NewOndoWrappedStock(st)
+	mustMint(t, st, "0xALICE", 10)
+	mustMint(t, st, "0xBOB", 3)
+	if err := ow.Wrap(st, "0xALICE", tokens(4), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := st.PrintSummary(&buf, ow, "0xALICE", "0xBOB"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"TSLA", "13.000000", "0xALICE", "6.000000", "4.000000", "0xBOB", "3.000000", "Exchange rate:", "(wrapper)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary is missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := st.PrintSummary(&buf, nil, "0xBOB"); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "Exchange rate:") || strings.Contains(out, "(wrapper)") || !strings.Contains(out, "0xBOB") {
+		t.Errorf("summary without a wrapper:\n%s", out)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestPrintSummaryReturnsWriteErrors(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.PrintSummary(failingWriter{}, nil); err == nil {
+		t.Error("PrintSummary ignored a write error")
+	}
+}
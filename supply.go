@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// TokenOption configures a token created by NewStockToken
+type TokenOption func(t *StockToken) error
+
+// WithMaxSupply caps the token's total supply at maxSupply raw units, however it grows: by
+// mints, splits, dividends, mergers and spinoffs. Wrapping checks the amount against it too. A
+// nil maxSupply leaves the supply uncapped.
+func WithMaxSupply(maxSupply *big.Int) TokenOption {
+	return func(t *StockToken) error {
+		if maxSupply != nil && maxSupply.Sign() < 0 {
+			return fmt.Errorf("%w: max supply must not be negative", ErrInvalidAmount)
+		}
+		t.maxSupply = copyAmount(maxSupply)
+		return nil
+	}
+}
+
+// MaxSupply returns the supply cap set by WithMaxSupply, or nil if the supply is uncapped
+func (t *StockToken) MaxSupply() *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return copyAmount(t.maxSupply)
+}
+
+// checkSupplyCap returns ErrSupplyCap if adding amount to the supply would exceed the supply cap.
+// The caller must hold t.mu.
+func (t *StockToken) checkSupplyCap(amount *big.Int) error {
+	if t.maxSupply == nil {
+		return nil
+	}
+	supply := new(big.Int).Add(t.totalSupply, amount)
+	if supply.Cmp(t.maxSupply) > 0 {
+		return fmt.Errorf("%w: supply would reach %s %s, above the cap of %s", ErrSupplyCap, formatTokens(supply, t.Precision), t.ticker, formatTokens(t.maxSupply, t.Precision))
+	}
+	return nil
+}
+
+// MintableRemaining returns how many more raw units can be minted before the supply reaches
+// the cap, zero once it has. It returns ErrNoCap if the supply is uncapped.
+func (t *StockToken) MintableRemaining() (*big.Int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.maxSupply == nil {
+		return nil, ErrNoCap
+	}
+	remaining := new(big.Int).Sub(t.maxSupply, t.totalSupply)
+	if remaining.Sign() < 0 {
+		remaining.SetInt64(0)
+	}
+	return remaining, nil
+}
+
+// checkMint returns an error if amount cannot be minted across recipients: while the token is
+// paused only the owner can receive new tokens, and the supply cap applies. Every path that
+// mints goes through it. The caller must hold t.mu.
+func (t *StockToken) checkMint(amount *big.Int, recipients ...string) error {
+	if t.isPaused {
+		for _, address := range recipients {
+			if address != t.owner {
+				return ErrTokenPaused
+			}
+		}
+	}
+	return t.checkSupplyCap(amount)
+}
+
+// SanityCheck returns an error if any balance is negative or the balances and staked balances
+// do not add up to the total supply. Either means a bug has corrupted the ledger.
+func (t *StockToken) SanityCheck() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sanityCheck()
+}
+
+// sanityCheck is SanityCheck for callers that hold t.mu
+func (t *StockToken) sanityCheck() error {
+	sum := big.NewInt(0)
+	for address, balance := range t.balances {
+		if balance.Sign() < 0 {
+			return fmt.Errorf("%s has a negative balance of %s", address, balance)
+		}
+		sum.Add(sum, balance)
+	}
+	for address, staked := range t.stakedBalances {
+		if staked.Sign() < 0 {
+			return fmt.Errorf("%s has a negative staked balance of %s", address, staked)
+		}
+		sum.Add(sum, staked)
+	}
+	if sum.Cmp(t.totalSupply) != 0 {
+		return fmt.Errorf("balances and staked balances add up to %s but total supply is %s", sum, t.totalSupply)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// mintPaths returns a way to reach each minting entry point on st, each minting to 0xALICE
+// unless noted
+func mintPaths(t *testing.T, st *StockToken) map[string]func() error {
+	t.Helper()
+	now := time.Now()
+	warrant, err := st.IssueWarrant("0xALICE", big.NewInt(1), tokens(1), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := st.IssueConvertibleNote("0xALICE", big.NewInt(10000), 0, now.Add(time.Hour), big.NewInt(10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.AddSubscription("0xALICE", 1, time.Hour, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.IssueRights(big.NewInt(100), big.NewRat(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetTreasuryAddress("0xTREASURY"); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]func() error{
+		"MintRaw":         func() error { return st.MintRaw("0xALICE", tokens(1)) },
+		"Vest":            func() error { return st.Vest("0xALICE", "1", now, now.Add(time.Hour)) },
+		"UniformSplit":    func() error { return st.UniformSplit(tokens(1)) },
+		"ExerciseRights":  func() error { return st.ExerciseRights("0xALICE", tokens(1)) },
+		"ExerciseWarrant": func() error { return st.ExerciseWarrant(warrant, now) },
+		"ConvertNote":     func() error { return st.ConvertNote(note, now) },
+		"ProcessSubscriptions": func() error {
+			_, err := st.ProcessSubscriptions(now)
+			return err
+		},
+		"Dilution": func() error { return st.Rebase(DilutionAction{NewSharesIssued: tokens(1)}) },
+	}
+}
+
+func TestEveryMintHonoursPause(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	paths := mintPaths(t, st)
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	for name, mint := range paths {
+		if err := mint(); !errors.Is(err, ErrTokenPaused) {
+			t.Errorf("%s while paused: err = %v, want ErrTokenPaused", name, err)
+		}
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkSane(t, st)
+}
+
+func TestWithMaxSupply(t *testing.T) {
+	st, err := NewStockToken("TSLA", "Tesla", defaultDecimals, "$100.00", "0xOWNER", WithMaxSupply(tokens(10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.LaxAddressValidation = true
+	if got := st.MaxSupply(); got.Cmp(tokens(10)) != 0 {
+		t.Errorf("MaxSupply = %s, want %s", got, tokens(10))
+	}
+	st.MaxSupply().SetInt64(0)
+	if err := st.MintRaw("0xALICE", tokens(10)); err != nil {
+		t.Fatalf("mint up to the cap: %v", err)
+	}
+	if err := st.MintRaw("0xALICE", big.NewInt(1)); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("mint above the cap: err = %v, want ErrSupplyCap", err)
+	}
+
+	// Wrapping more than the cap is refused before the balance is even looked at
+	ow := NewOndoWrappedStock(st)
+	if err := ow.Wrap(st, "0xALICE", tokens(11), nil); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("wrap above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Errorf("wrap of the whole capped supply: %v", err)
+	}
+	checkSane(t, st)
+
+	if _, err := NewStockToken("TSLA", "Tesla", defaultDecimals, "$100.00", "0xOWNER", WithMaxSupply(big.NewInt(-1))); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("negative cap: err = %v, want ErrInvalidAmount", err)
+	}
+	if got := newTestToken(t).MaxSupply(); got != nil {
+		t.Errorf("MaxSupply without the option = %s, want nil", got)
+	}
+}
+
+func TestEveryMintHonoursCap(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	paths := mintPaths(t, st)
+	st.maxSupply = tokens(10)
+	for name, mint := range paths {
+		if err := mint(); !errors.Is(err, ErrSupplyCap) {
+			t.Errorf("%s above the cap: err = %v, want ErrSupplyCap", name, err)
+		}
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkSane(t, st)
+}
+
+func TestPausedMintToOwner(t *testing.T) {
+	st := newTestToken(t)
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MintRaw("0xOWNER", tokens(1)); err != nil {
+		t.Fatalf("minting to the owner while paused: %v", err)
+	}
+	if err := st.MintRaw("0xALICE", tokens(1)); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("minting to another address while paused: err = %v, want ErrTokenPaused", err)
+	}
+	// A mint to several recipients is only allowed if all of them are the owner
+	if err := st.BatchMint([]MintEntry{{"0xOWNER", "1"}, {"0xOWNER", "1"}}); err != nil {
+		t.Errorf("batch mint to the owner alone while paused: %v", err)
+	}
+	if err := st.BatchMint([]MintEntry{{"0xOWNER", "1"}, {"0xALICE", "1"}}); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("batch mint including another address while paused: err = %v, want ErrTokenPaused", err)
+	}
+	// A uniform split is a rebase, and no rebase applies while paused
+	if err := st.UniformSplit(tokens(1)); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("uniform split while paused: err = %v, want ErrTokenPaused", err)
+	}
+	checkBalance(t, st, "0xOWNER", tokens(3))
+}
+
+func TestPausedSweepsRejected(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	if err := st.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ProportionalTransfer(100, "0xBOB"); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("ProportionalTransfer while paused: err = %v, want ErrTokenPaused", err)
+	}
+	if err := st.IssueRights(big.NewInt(100), big.NewRat(1, 1)); !errors.Is(err, ErrTokenPaused) {
+		t.Errorf("IssueRights while paused: err = %v, want ErrTokenPaused", err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+}
+
+func TestProcessSubscriptionsAllOrNothing(t *testing.T) {
+	st := newTestToken(t)
+	start := time.Now().Add(-time.Hour)
+	for _, address := range []string{"0xALICE", "0xBOB"} {
+		if _, err := st.AddSubscription(address, 5, time.Hour, start); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.maxSupply = tokens(7)
+	if _, err := st.ProcessSubscriptions(time.Now()); !errors.Is(err, ErrSupplyCap) {
+		t.Fatalf("err = %v, want ErrSupplyCap", err)
+	}
+	if got := st.TotalSupply(); got.Sign() != 0 {
+		t.Errorf("total supply = %s after a rejected run, want 0", got)
+	}
+
+	st.maxSupply = nil
+	if count, err := st.ProcessSubscriptions(time.Now()); err != nil || count != 2 {
+		t.Errorf("ProcessSubscriptions = %d, %v, want 2 payments", count, err)
+	}
+}
+
+func TestSupplyGrowthHonoursCap(t *testing.T) {
+	dividend := Dividend{cashAmount: big.NewInt(1000), sharePrice: big.NewInt(10000)}
+	for name, action := range map[string]RebaseAction{
+		"split":    doubleSplit,
+		"dividend": dividend,
+		"compound": CompoundDividend{Dividends: []Dividend{dividend, dividend}},
+	} {
+		st := newTestToken(t)
+		mustMint(t, st, "0xALICE", 10)
+		st.maxSupply = tokens(10)
+		if err := st.Rebase(action); !errors.Is(err, ErrSupplyCap) {
+			t.Errorf("%s above the cap: err = %v, want ErrSupplyCap", name, err)
+		}
+		checkBalance(t, st, "0xALICE", tokens(10))
+		checkSane(t, st)
+	}
+}
+
+func TestMergerHonoursAcquirerCap(t *testing.T) {
+	target, acquirer := newTestToken(t), newTestToken(t)
+	mustMint(t, target, "0xALICE", 10)
+	acquirer.maxSupply = tokens(15)
+	if err := Merge(target, acquirer, big.NewRat(2, 1)); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("Merge above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	if err := target.Rebase(StockMerger{Acquirer: acquirer, ExchangeRatio: big.NewRat(2, 1)}); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("StockMerger above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	checkBalance(t, target, "0xALICE", tokens(10))
+	checkBalance(t, acquirer, "0xALICE", big.NewInt(0))
+
+	acquirer.maxSupply = tokens(20)
+	if err := Merge(target, acquirer, big.NewRat(2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, acquirer, "0xALICE", tokens(20))
+}
+
+func TestSpinoffHonoursChildCap(t *testing.T) {
+	parent, child := newTestToken(t), newTestToken(t)
+	mustMint(t, parent, "0xALICE", 10)
+	child.maxSupply = tokens(4)
+	if err := Spinoff(parent, child, big.NewRat(1, 2)); !errors.Is(err, ErrSupplyCap) {
+		t.Errorf("Spinoff above the cap: err = %v, want ErrSupplyCap", err)
+	}
+	if got := child.TotalSupply(); got.Sign() != 0 {
+		t.Errorf("child supply = %s after a rejected spinoff, want 0", got)
+	}
+}
+
+func TestWrapUnaffectedByCap(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 10)
+	st.maxSupply = tokens(10)
+	ow := NewOndoWrappedStock(st)
+	// Wrapping moves existing tokens into custody, so it works even with the supply at the cap
+	if err := ow.Wrap(st, "0xALICE", tokens(10), nil); err != nil {
+		t.Fatalf("wrapping the whole supply at the cap: %v", err)
+	}
+	checkSane(t, st)
+}
+
+func TestMintableRemaining(t *testing.T) {
+	st := newTestToken(t)
+	if _, err := st.MintableRemaining(); !errors.Is(err, ErrNoCap) {
+		t.Fatalf("MintableRemaining without a cap: err = %v, want ErrNoCap", err)
+	}
+
+	st.maxSupply = tokens(1000)
+	mustMint(t, st, "0xALICE", 600)
+	remaining, err := st.MintableRemaining()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining.Cmp(tokens(400)) != 0 {
+		t.Errorf("MintableRemaining = %s, want %s", remaining, tokens(400))
+	}
+
+	mustMint(t, st, "0xBOB", 400)
+	if remaining, err = st.MintableRemaining(); err != nil || remaining.Sign() != 0 {
+		t.Errorf("MintableRemaining at the cap = %v, %v, want 0", remaining, err)
+	}
+
+	// A cap lowered below the supply leaves no headroom rather than a negative one
+	st.maxSupply = tokens(500)
+	if remaining, err = st.MintableRemaining(); err != nil || remaining.Sign() != 0 {
+		t.Errorf("MintableRemaining above the cap = %v, %v, want 0", remaining, err)
+	}
+}
+
+func TestSanityCheck(t *testing.T) {
+	for name, corrupt := range map[string]func(st *StockToken){
+		"supply too high":  func(st *StockToken) { st.totalSupply.Add(st.totalSupply, big.NewInt(1)) },
+		"balance too high": func(st *StockToken) { st.balances["0xALICE"].Add(st.balances["0xALICE"], big.NewInt(1)) },
+		"negative balance": func(st *StockToken) {
+			st.balances["0xBOB"].Neg(st.balances["0xBOB"])
+			st.totalSupply.Sub(st.totalSupply, tokens(10))
+		},
+		"negative staked": func(st *StockToken) { st.stakedBalances["0xALICE"] = big.NewInt(-1) },
+		"staked missing":  func(st *StockToken) { delete(st.stakedBalances, "0xBOB") },
+	} {
+		st := newTestToken(t)
+		mustMint(t, st, "0xALICE", 10)
+		mustMint(t, st, "0xBOB", 10)
+		if err := st.Stake("0xBOB", tokens(5)); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SanityCheck(); err != nil {
+			t.Fatalf("%s: healthy ledger failed the check: %v", name, err)
+		}
+		corrupt(st)
+		if err := st.SanityCheck(); err == nil {
+			t.Errorf("%s: SanityCheck passed", name)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// AccrueDividend credits a dividend of cashPerShare cents per share to those of addresses that
+// hold no tokens, so late entrants can claim it later with ClaimDividend. Each such address
+// accrues the cash the whole current supply would receive; ClaimDividend pays out its
+// balance's fraction of that. Addresses that hold tokens are skipped, as they are paid by the
+// dividend rebase itself.
+func (t *StockToken) AccrueDividend(cashPerShare *big.Int, addresses []string) error {
+	if cashPerShare == nil || cashPerShare.Sign() <= 0 {
+		return fmt.Errorf("%w: dividend per share must be positive", ErrInvalidAmount)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.checkAddresses(addresses...); err != nil {
+		return err
+	}
+
+	pool := new(big.Int).Mul(t.totalSupply, cashPerShare)
+	pool.Div(pool, t.Precision)
+	for _, address := range addresses {
+		if balance := t.balances[address]; balance != nil && balance.Sign() > 0 {
+			continue
+		}
+		if t.UnclaimedDividends == nil {
+			t.UnclaimedDividends = make(map[string]*big.Int)
+		}
+		if t.UnclaimedDividends[address] == nil {
+			t.UnclaimedDividends[address] = big.NewInt(0)
+		}
+		t.UnclaimedDividends[address].Add(t.UnclaimedDividends[address], pool)
+	}
+	return nil
+}
+
+// UnclaimedDividendOf returns the dividend cash in cents accrued to address and not yet claimed
+func (t *StockToken) UnclaimedDividendOf(address string) *big.Int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if unclaimed := t.UnclaimedDividends[address]; unclaimed != nil {
+		return new(big.Int).Set(unclaimed)
+	}
+	return big.NewInt(0)
+}
+
+// ClaimDividend pays out address's unclaimed dividend. It is owed its current balance's
+// fraction of the accrued cash, which is minted to it as shares at the current share price,
+// and the entry is cleared. It returns the shares minted.
+func (t *StockToken) ClaimDividend(address string) (*big.Int, error) {
+	defer t.emitEvents()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	unclaimed := t.UnclaimedDividends[address]
+	if unclaimed == nil || unclaimed.Sign() == 0 {
+		return nil, fmt.Errorf("no unclaimed dividend for %s", address)
+	}
+	balance := t.balances[address]
+	if balance == nil || balance.Sign() == 0 {
+		return nil, fmt.Errorf("%w: %s must hold %s to claim its dividend", ErrInsufficientBalance, address, t.ticker)
+	}
+	if t.sharePrice.Sign() == 0 {
+		return nil, ErrZeroPrice
+	}
+
+	// unclaimed * balance / totalSupply cents, converted to shares at the share price
+	shares := new(big.Int).Mul(unclaimed, balance)
+	shares.Mul(shares, t.Precision)
+	shares.Div(shares, new(big.Int).Mul(t.totalSupply, t.sharePrice))
+	if err := t.checkMint(shares, address); err != nil {
+		return nil, err
+	}
+
+	delete(t.UnclaimedDividends, address)
+	if shares.Sign() > 0 {
+		t.mint(address, shares)
+	}
+	return shares, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestClaimDividend(t *testing.T) {
+	st := newTestToken(t)
+	mustMint(t, st, "0xALICE", 100)
+
+	// A 50 cent dividend on 100 shares is a $50 pool, accrued only to the address without tokens
+	if err := st.AccrueDividend(big.NewInt(50), []string{"0xALICE", "0xBOB"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := st.UnclaimedDividendOf("0xALICE"); got.Sign() != 0 {
+		t.Errorf("holder accrued %s cents, want none", got)
+	}
+	if got := st.UnclaimedDividendOf("0xBOB"); got.Cmp(big.NewInt(5000)) != 0 {
+		t.Fatalf("unclaimed dividend = %s cents, want 5000", got)
+	}
+	if _, err := st.ClaimDividend("0xBOB"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("claim without a balance: err = %v, want %v", err, ErrInsufficientBalance)
+	}
+
+	// Holding a tenth of the supply, 0xBOB is owed $5, which is 0.05 shares at $100
+	if err := st.Interact("0xALICE", "0xBOB", tokens(10), nil); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := st.ClaimDividend("0xBOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares.Cmp(big.NewInt(50_000)) != 0 {
+		t.Errorf("claim minted %s raw shares, want 50000", shares)
+	}
+	checkBalance(t, st, "0xBOB", big.NewInt(10_050_000))
+	if got := st.UnclaimedDividendOf("0xBOB"); got.Sign() != 0 {
+		t.Errorf("unclaimed dividend after claiming = %s, want 0", got)
+	}
+	if _, err := st.ClaimDividend("0xBOB"); err == nil {
+		t.Error("a dividend was claimed twice")
+	}
+	checkSane(t, st)
+}
+
+func TestAccrueDividendRejectsBadAmounts(t *testing.T) {
+	st := newTestToken(t)
+	for _, amount := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+		if err := st.AccrueDividend(amount, []string{"0xBOB"}); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("AccrueDividend(%v): err = %v, want %v", amount, err, ErrInvalidAmount)
+		}
+	}
+	if len(st.UnclaimedDividends) != 0 {
+		t.Errorf("rejected dividends accrued %v", st.UnclaimedDividends)
+	}
+}
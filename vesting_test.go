@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newVestingToken returns a token on a fake clock where 0xALICE holds 10 free tokens and a
+// 100-token grant vesting linearly over 100 days from now
+func newVestingToken(t *testing.T) (*StockToken, *fakeClock) {
+	t.Helper()
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 10)
+	start := clock.Now()
+	if err := st.Vest("0xALICE", "100", start, start.Add(100*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return st, clock
+}
+
+// newLockedToken returns a token on a fake clock where 0xALICE holds 4 free tokens and a
+// 10-token grant that has not started vesting
+func newLockedToken(t *testing.T) *StockToken {
+	t.Helper()
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	mustMint(t, st, "0xALICE", 4)
+	start := clock.Now().Add(24 * time.Hour)
+	if err := st.Vest("0xALICE", "10", start, start.Add(100*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestVestedBalance(t *testing.T) {
+	st, clock := newVestingToken(t)
+	start := clock.Now()
+	for days, want := range map[int]*big.Int{-1: big.NewInt(0), 0: big.NewInt(0), 25: tokens(25), 100: tokens(100), 200: tokens(100)} {
+		got, err := st.VestedBalance("0xALICE", start.Add(time.Duration(days)*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(want) != 0 {
+			t.Errorf("vested after %d days = %s, want %s", days, got, want)
+		}
+	}
+	if err := st.Vest("0xALICE", "1", start, start); err == nil {
+		t.Error("a grant ending when it starts was accepted")
+	}
+}
+
+func TestVestingTransfers(t *testing.T) {
+	st, clock := newVestingToken(t)
+
+	// A quarter in, 25 of the grant plus the 10 free tokens can move
+	clock.Advance(25 * 24 * time.Hour)
+	if err := st.Interact("0xALICE", "0xBOB", tokens(30), nil); err != nil {
+		t.Fatalf("partially vested transfer: %v", err)
+	}
+	if err := st.Interact("0xALICE", "0xBOB", tokens(6), nil); !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("transfer into the locked tokens: err = %v, want %v", err, ErrBalanceLocked)
+	}
+	checkBalance(t, st, "0xALICE", tokens(80))
+
+	// Once the schedule has ended everything can move
+	clock.Advance(100 * 24 * time.Hour)
+	if err := st.Interact("0xALICE", "0xBOB", tokens(80), nil); err != nil {
+		t.Fatalf("transfer after the schedule ended: %v", err)
+	}
+	checkBalance(t, st, "0xBOB", tokens(110))
+	checkSane(t, st)
+}
+
+func TestVestingScalesWithRebase(t *testing.T) {
+	st, clock := newVestingToken(t)
+	clock.Advance(50 * 24 * time.Hour)
+	if err := st.Rebase(doubleSplit); err != nil {
+		t.Fatal(err)
+	}
+
+	// The grant doubles to 200 with 100 vested, and the 20 free tokens are on top of that
+	vested, err := st.VestedBalance("0xALICE", clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vested.Cmp(tokens(100)) != 0 {
+		t.Errorf("vested after the split = %s, want %s", vested, tokens(100))
+	}
+	if err := st.Interact("0xALICE", "0xBOB", tokens(121), nil); !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("transfer into the locked tokens: err = %v, want %v", err, ErrBalanceLocked)
+	}
+	if err := st.Interact("0xALICE", "0xBOB", tokens(120), nil); err != nil {
+		t.Errorf("transfer of the vested and free tokens: %v", err)
+	}
+}
+
+func TestTransactionFeeCannotSpendUnvested(t *testing.T) {
+	st := newLockedToken(t)
+	st.FeeRecipient = "0xFEES"
+	if err := st.SetTransactionFee(tokens(1), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending all 4 free tokens would take the 1-token fee from the unvested grant
+	if err := st.Interact("0xALICE", "0xBOB", tokens(4), nil); !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("transfer paying its fee from unvested tokens: err = %v, want %v", err, ErrBalanceLocked)
+	}
+	err := st.BatchTransfer([]TransferEntry{{"0xALICE", "0xBOB", tokens(2)}, {"0xALICE", "0xCAROL", tokens(1)}})
+	if !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("batch paying its fees from unvested tokens: err = %v, want %v", err, ErrBalanceLocked)
+	}
+	if err := st.Approve("0xALICE", "0xSPENDER", tokens(4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.TransferFrom("0xSPENDER", "0xALICE", "0xBOB", tokens(4)); !errors.Is(err, ErrBalanceLocked) {
+		t.Errorf("TransferFrom paying its fee from unvested tokens: err = %v, want %v", err, ErrBalanceLocked)
+	}
+	checkBalance(t, st, "0xALICE", tokens(14))
+
+	if err := st.Interact("0xALICE", "0xBOB", tokens(3), nil); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, st, "0xALICE", tokens(10))
+	checkBalance(t, st, "0xFEES", tokens(1))
+	checkSane(t, st)
+}
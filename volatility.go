@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// logPrecision is the fixed-point scale, 10^30, to which logRat rounds each step of its
+// series, so the rationals it works with stay small
+var logPrecision = new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+
+// RealizedVolatility returns the sample standard deviation of the log returns ln(p_i/p_(i-1))
+// between the last window prices in PriceHistory. It is per interval between recorded prices,
+// not annualised. window must be at least 3, so that there are two returns to compare, and
+// ErrInsufficientHistory is returned if fewer than window prices have been recorded.
+func (t *StockToken) RealizedVolatility(window int) (*big.Rat, error) {
+	if window < 3 {
+		return nil, fmt.Errorf("%w: volatility window must be at least 3 prices", ErrInvalidAmount)
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.priceHistory) < window {
+		return nil, fmt.Errorf("%w: %d prices recorded, %d needed", ErrInsufficientHistory, len(t.priceHistory), window)
+	}
+	records := t.priceHistory[len(t.priceHistory)-window:]
+
+	returns := make([]*big.Rat, 0, window-1)
+	mean := new(big.Rat)
+	for i := 1; i < window; i++ {
+		r := logRat(new(big.Rat).SetFrac(records[i].PriceCents, records[i-1].PriceCents))
+		returns = append(returns, r)
+		mean.Add(mean, r)
+	}
+	mean.Quo(mean, big.NewRat(int64(len(returns)), 1))
+
+	variance := new(big.Rat)
+	for _, r := range returns {
+		deviation := new(big.Rat).Sub(r, mean)
+		variance.Add(variance, deviation.Mul(deviation, deviation))
+	}
+	variance.Quo(variance, big.NewRat(int64(len(returns)-1), 1))
+
+	deviation := new(big.Float).SetPrec(128).SetRat(variance)
+	volatility, _ := deviation.Sqrt(deviation).Rat(nil)
+	return volatility, nil
+}
+
+// logRat returns the natural logarithm of x, which must be positive, to about 30 decimal
+// places. x is halved or doubled k times into [3/4, 3/2), where logSeries converges quickly,
+// and k ln 2 is added back.
+func logRat(x *big.Rat) *big.Rat {
+	x = new(big.Rat).Set(x)
+	two := big.NewRat(2, 1)
+	k := int64(0)
+	for x.Cmp(big.NewRat(3, 2)) >= 0 {
+		x.Quo(x, two)
+		k++
+	}
+	for x.Cmp(big.NewRat(3, 4)) < 0 {
+		x.Mul(x, two)
+		k--
+	}
+
+	result := logSeries(x)
+	if k != 0 {
+		result.Add(result, new(big.Rat).Mul(big.NewRat(k, 1), logSeries(two)))
+	}
+	return result
+}
+
+// logSeries returns ln x as the Taylor series 2 * sum z^(2n+1)/(2n+1), with z = (x-1)/(x+1),
+// rounding every term to logPrecision and stopping once the terms round to zero
+func logSeries(x *big.Rat) *big.Rat {
+	one := big.NewRat(1, 1)
+	z := new(big.Rat).Quo(new(big.Rat).Sub(x, one), new(big.Rat).Add(x, one))
+	zSquared := new(big.Rat).Mul(z, z)
+
+	sum := new(big.Rat)
+	power := roundToLogPrecision(z)
+	for n := int64(1); power.Sign() != 0; n += 2 {
+		term := roundToLogPrecision(new(big.Rat).Quo(power, big.NewRat(n, 1)))
+		if term.Sign() == 0 {
+			break
+		}
+		sum.Add(sum, term)
+		power = roundToLogPrecision(power.Mul(power, zSquared))
+	}
+	return sum.Mul(sum, big.NewRat(2, 1))
+}
+
+// roundToLogPrecision truncates r to a multiple of 1/logPrecision
+func roundToLogPrecision(r *big.Rat) *big.Rat {
+	scaled := new(big.Int).Mul(r.Num(), logPrecision)
+	scaled.Quo(scaled, r.Denom())
+	return new(big.Rat).SetFrac(scaled, logPrecision)
+}
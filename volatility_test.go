@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestLogRat(t *testing.T) {
+	for _, x := range []*big.Rat{big.NewRat(1, 1), big.NewRat(2, 1), big.NewRat(10200, 10000), big.NewRat(9900, 10200), big.NewRat(1, 1000), big.NewRat(1000000, 1)} {
+		want, _ := x.Float64()
+		want = math.Log(want)
+		got, _ := logRat(x).Float64()
+		if math.Abs(got-want) > 1e-12 {
+			t.Errorf("ln(%s) = %v, want %v", x.RatString(), got, want)
+		}
+	}
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	st := newTestToken(t)
+	clock := newFakeClock()
+	st.Clock = clock
+	prices := []int64{10000, 10200, 9900, 10100, 10400, 10300, 10600, 10500, 10800, 11000}
+	for i, cents := range prices {
+		if i == 2 {
+			if _, err := st.RealizedVolatility(3); !errors.Is(err, ErrInsufficientHistory) {
+				t.Errorf("volatility of two prices: err = %v, want ErrInsufficientHistory", err)
+			}
+		}
+		clock.Advance(time.Minute)
+		if err := st.RecordExternalPrice(big.NewInt(cents), "feed", clock.Now(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The sample standard deviation of the nine log returns
+	var returns []float64
+	mean := 0.0
+	for i := 1; i < len(prices); i++ {
+		r := math.Log(float64(prices[i]) / float64(prices[i-1]))
+		returns = append(returns, r)
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	want := math.Sqrt(variance / float64(len(returns)-1))
+
+	volatility, err := st.RealizedVolatility(len(prices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := volatility.Float64(); math.Abs(got-want) > want*1e-9 {
+		t.Errorf("RealizedVolatility = %v, want %v", got, want)
+	}
+
+	// A window over the last three prices only sees their two returns
+	volatility, err = st.RealizedVolatility(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1, r2 := math.Log(10800.0/10500), math.Log(11000.0/10800)
+	if got, want := volatility.FloatString(6), big.NewRat(int64(math.Round(math.Abs(r1-r2)/math.Sqrt2*1e9)), 1e9).FloatString(6); got != want {
+		t.Errorf("RealizedVolatility(3) = %s, want %s", got, want)
+	}
+
+	if _, err := st.RealizedVolatility(len(prices) + 1); !errors.Is(err, ErrInsufficientHistory) {
+		t.Errorf("window beyond the history: err = %v, want ErrInsufficientHistory", err)
+	}
+	if _, err := st.RealizedVolatility(2); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("window of two: err = %v, want ErrInvalidAmount", err)
+	}
+}